@@ -7,11 +7,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/handlers"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/metrics"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/monitor"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/services"
 	"github.com/Cubit-Studios/swarm-horde-bridge/pkg/logger"
@@ -35,9 +37,12 @@ func main() {
 
 	router := chi.NewRouter()
 	router.Use(middleware.RequestID)
+	// Keep the socket peer for the webhook IP allowlist before RealIP rewrites RemoteAddr
+	router.Use(handlers.PeerAddr)
 	router.Use(middleware.RealIP)
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
+	router.Use(metrics.Middleware)
 	router.Use(middleware.Timeout(60 * time.Second))
 
 	server := &http.Server{
@@ -50,10 +55,40 @@ func main() {
 	// Create services and handler
 	hordeService := services.NewHordeService(cfg, log)
 	swarmService := services.NewSwarmService(cfg, log)
-	jobStorage := services.NewJobStorage()
+	jobStorage, err := services.NewJobStorage(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open job storage")
+	}
+	defer jobStorage.Close()
+
+	outbox, err := services.NewSwarmOutbox(cfg, jobStorage)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open swarm outbox")
+	}
+	swarmQueue := services.NewSwarmQueue(cfg, log, swarmService, outbox)
+
+	intake, err := services.NewIntakeQueue(jobStorage)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open intake queue")
+	}
+	dispatcher, err := services.NewJobDispatcher(cfg, log, hordeService, swarmQueue, jobStorage, intake)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create job dispatcher")
+	}
+
+	if err := metrics.Register(metrics.NewJobsCollector(jobStorage)); err != nil {
+		log.Fatal().Err(err).Msg("failed to register job metrics")
+	}
+
+	// Initialize JobMonitor
+	commenter := services.NewReviewCommenter(cfg, log, swarmService)
+	voter := services.NewReviewVoter(cfg, log, swarmService)
+	jobMonitor := monitor.New(cfg, log, hordeService, jobStorage, swarmQueue, commenter, voter)
 
 	// Setup routes
-	handlers.SetupRoutes(router, cfg, log, hordeService, swarmService, jobStorage)
+	if err := handlers.SetupRoutes(router, cfg, log, hordeService, dispatcher, swarmQueue, jobStorage, intake, jobMonitor); err != nil {
+		log.Fatal().Err(err).Msg("failed to setup routes")
+	}
 
 	// Start server
 	go func() {
@@ -63,14 +98,18 @@ func main() {
 		}
 	}()
 
-	// Initialize JobMonitor
-	jobMonitor := monitor.New(cfg, log, jobStorage)
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Start JobMonitor in a goroutine
-	go jobMonitor.Start(ctx)
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	defer stopMonitor()
+
+	// Start job creation, JobMonitor and Swarm update delivery in goroutines
+	var workers sync.WaitGroup
+	for _, start := range []func(context.Context){dispatcher.Start, jobMonitor.Start, swarmQueue.Start} {
+		workers.Add(1)
+		go func(start func(context.Context)) {
+			defer workers.Done()
+			start(monitorCtx)
+		}(start)
+	}
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
@@ -78,12 +117,17 @@ func main() {
 	<-quit
 
 	log.Info().Msg("shutting down server")
-	ctx, cancel = context.WithTimeout(context.Background(), time.Duration(cfg.Timeouts.Shutdown)*time.Second)
+	stopMonitor()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Timeouts.Shutdown)*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatal().Err(err).Msg("server forced to shutdown")
 	}
 
+	// The workers write to the job storage, so it is closed only once they have stopped
+	workers.Wait()
+
 	log.Info().Msg("server exited properly")
 }
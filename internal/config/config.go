@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
 	"strconv"
+	"text/template"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -52,6 +54,9 @@ func loadEnvOverrides(cfg *Config) error {
 		}
 		cfg.Server.Port = p
 	}
+	if token := os.Getenv("API_TOKEN"); token != "" {
+		cfg.Server.APIToken = token
+	}
 
 	// Horde settings
 	if host := os.Getenv("HORDE_HOST"); host != "" {
@@ -67,11 +72,34 @@ func loadEnvOverrides(cfg *Config) error {
 		}
 		cfg.Horde.Timeout = t
 	}
+	if threshold := os.Getenv("HORDE_BREAKER_THRESHOLD"); threshold != "" {
+		t, err := strconv.Atoi(threshold)
+		if err != nil {
+			return fmt.Errorf("invalid HORDE_BREAKER_THRESHOLD value: %w", err)
+		}
+		cfg.Horde.Breaker.FailureThreshold = t
+	}
+	if timeout := os.Getenv("HORDE_BREAKER_OPEN_TIMEOUT"); timeout != "" {
+		t, err := strconv.Atoi(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid HORDE_BREAKER_OPEN_TIMEOUT value: %w", err)
+		}
+		cfg.Horde.Breaker.OpenTimeout = t
+	}
 
 	// Swarm settings
 	if host := os.Getenv("SWARM_HOST"); host != "" {
 		cfg.Swarm.Host = host
 	}
+	if user := os.Getenv("SWARM_USER"); user != "" {
+		cfg.Swarm.User = user
+	}
+	if ticket := os.Getenv("SWARM_TICKET"); ticket != "" {
+		cfg.Swarm.Ticket = ticket
+	}
+	if password := os.Getenv("SWARM_PASSWORD"); password != "" {
+		cfg.Swarm.Password = password
+	}
 	if timeout := os.Getenv("SWARM_TIMEOUT"); timeout != "" {
 		t, err := strconv.Atoi(timeout)
 		if err != nil {
@@ -79,6 +107,62 @@ func loadEnvOverrides(cfg *Config) error {
 		}
 		cfg.Swarm.Timeout = t
 	}
+	if attempts := os.Getenv("SWARM_OUTBOX_MAX_ATTEMPTS"); attempts != "" {
+		a, err := strconv.Atoi(attempts)
+		if err != nil {
+			return fmt.Errorf("invalid SWARM_OUTBOX_MAX_ATTEMPTS value: %w", err)
+		}
+		cfg.Swarm.Outbox.MaxAttempts = a
+	}
+	if retention := os.Getenv("SWARM_OUTBOX_DELIVERED_RETENTION"); retention != "" {
+		r, err := strconv.Atoi(retention)
+		if err != nil {
+			return fmt.Errorf("invalid SWARM_OUTBOX_DELIVERED_RETENTION value: %w", err)
+		}
+		cfg.Swarm.Outbox.DeliveredRetention = r
+	}
+	if disabled := os.Getenv("SWARM_LOG_EXCERPT_DISABLED"); disabled != "" {
+		d, err := strconv.ParseBool(disabled)
+		if err != nil {
+			return fmt.Errorf("invalid SWARM_LOG_EXCERPT_DISABLED value: %w", err)
+		}
+		cfg.Swarm.LogExcerpt.Disabled = d
+	}
+	if lines := os.Getenv("SWARM_LOG_EXCERPT_LINES"); lines != "" {
+		l, err := strconv.Atoi(lines)
+		if err != nil {
+			return fmt.Errorf("invalid SWARM_LOG_EXCERPT_LINES value: %w", err)
+		}
+		cfg.Swarm.LogExcerpt.MaxLines = l
+	}
+	if size := os.Getenv("SWARM_LOG_EXCERPT_BYTES"); size != "" {
+		b, err := strconv.Atoi(size)
+		if err != nil {
+			return fmt.Errorf("invalid SWARM_LOG_EXCERPT_BYTES value: %w", err)
+		}
+		cfg.Swarm.LogExcerpt.MaxBytes = b
+	}
+	if enabled := os.Getenv("SWARM_COMMENTS_ENABLED"); enabled != "" {
+		e, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return fmt.Errorf("invalid SWARM_COMMENTS_ENABLED value: %w", err)
+		}
+		cfg.Swarm.Comments.Enabled = e
+	}
+	if dryRun := os.Getenv("SWARM_REVIEW_DRY_RUN"); dryRun != "" {
+		d, err := strconv.ParseBool(dryRun)
+		if err != nil {
+			return fmt.Errorf("invalid SWARM_REVIEW_DRY_RUN value: %w", err)
+		}
+		cfg.Swarm.Review.DryRun = d
+	}
+	if enabled := os.Getenv("SWARM_ARTIFACTS_ENABLED"); enabled != "" {
+		e, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return fmt.Errorf("invalid SWARM_ARTIFACTS_ENABLED value: %w", err)
+		}
+		cfg.Swarm.Artifacts.Enabled = e
+	}
 
 	// Monitor settings
 	if interval := os.Getenv("MONITOR_INTERVAL"); interval != "" {
@@ -88,6 +172,34 @@ func loadEnvOverrides(cfg *Config) error {
 		}
 		cfg.Monitor.Interval = i
 	}
+	if eventDriven := os.Getenv("MONITOR_EVENT_DRIVEN"); eventDriven != "" {
+		b, err := strconv.ParseBool(eventDriven)
+		if err != nil {
+			return fmt.Errorf("invalid MONITOR_EVENT_DRIVEN value: %w", err)
+		}
+		cfg.Monitor.EventDriven = b
+	}
+	if interval := os.Getenv("MONITOR_RECONCILE_INTERVAL"); interval != "" {
+		i, err := strconv.Atoi(interval)
+		if err != nil {
+			return fmt.Errorf("invalid MONITOR_RECONCILE_INTERVAL value: %w", err)
+		}
+		cfg.Monitor.ReconcileInterval = i
+	}
+	if concurrency := os.Getenv("MONITOR_CONCURRENCY"); concurrency != "" {
+		c, err := strconv.Atoi(concurrency)
+		if err != nil {
+			return fmt.Errorf("invalid MONITOR_CONCURRENCY value: %w", err)
+		}
+		cfg.Monitor.Concurrency = c
+	}
+	if timeout := os.Getenv("MONITOR_JOB_TIMEOUT"); timeout != "" {
+		t, err := strconv.Atoi(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid MONITOR_JOB_TIMEOUT value: %w", err)
+		}
+		cfg.Monitor.JobTimeout = t
+	}
 
 	// Timeout settings
 	if clientTimeout := os.Getenv("TIMEOUT_HTTP_CLIENT"); clientTimeout != "" {
@@ -114,19 +226,65 @@ func loadEnvOverrides(cfg *Config) error {
 		cfg.Retry.MaxAttempts = a
 	}
 	if delay := os.Getenv("RETRY_INITIAL_DELAY"); delay != "" {
-		d, err := strconv.Atoi(delay)
+		d, err := strconv.ParseFloat(delay, 64)
 		if err != nil {
 			return fmt.Errorf("invalid RETRY_INITIAL_DELAY value: %w", err)
 		}
 		cfg.Retry.InitialDelay = d
 	}
 	if maxDelay := os.Getenv("RETRY_MAX_DELAY"); maxDelay != "" {
-		d, err := strconv.Atoi(maxDelay)
+		d, err := strconv.ParseFloat(maxDelay, 64)
 		if err != nil {
 			return fmt.Errorf("invalid RETRY_MAX_DELAY value: %w", err)
 		}
 		cfg.Retry.MaxDelay = d
 	}
+	if disable := os.Getenv("RETRY_DISABLE_JITTER"); disable != "" {
+		d, err := strconv.ParseBool(disable)
+		if err != nil {
+			return fmt.Errorf("invalid RETRY_DISABLE_JITTER value: %w", err)
+		}
+		cfg.Retry.DisableJitter = d
+	}
+
+	// Storage settings
+	if storageType := os.Getenv("STORAGE_TYPE"); storageType != "" {
+		cfg.Storage.Type = storageType
+	}
+	if path := os.Getenv("STORAGE_PATH"); path != "" {
+		cfg.Storage.Path = path
+	}
+	if retention := os.Getenv("STORAGE_RETENTION"); retention != "" {
+		r, err := strconv.Atoi(retention)
+		if err != nil {
+			return fmt.Errorf("invalid STORAGE_RETENTION value: %w", err)
+		}
+		cfg.Storage.Retention = r
+	}
+
+	// Webhook settings
+	if token := os.Getenv("WEBHOOK_TOKEN"); token != "" {
+		cfg.Webhook.Token = token
+	}
+	if secret := os.Getenv("WEBHOOK_HMAC_SECRET"); secret != "" {
+		cfg.Webhook.HMACSecret = secret
+	}
+	if window := os.Getenv("WEBHOOK_DEDUP_WINDOW"); window != "" {
+		w, err := strconv.Atoi(window)
+		if err != nil {
+			return fmt.Errorf("invalid WEBHOOK_DEDUP_WINDOW value: %w", err)
+		}
+		cfg.Webhook.DedupWindow = w
+	}
+
+	// Intake settings
+	if maxAge := os.Getenv("INTAKE_MAX_AGE"); maxAge != "" {
+		a, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return fmt.Errorf("invalid INTAKE_MAX_AGE value: %w", err)
+		}
+		cfg.Intake.MaxAge = a
+	}
 
 	// Log level
 	if level := os.Getenv("LOG_LEVEL"); level != "" {
@@ -147,6 +305,131 @@ func validate(cfg *Config) error {
 	if cfg.Server.Port <= 0 || cfg.Server.Port > 65535 {
 		return fmt.Errorf("invalid port number: %d", cfg.Server.Port)
 	}
+	if cfg.Horde.Breaker.FailureThreshold < 0 {
+		return fmt.Errorf("invalid horde breaker failure threshold: %d", cfg.Horde.Breaker.FailureThreshold)
+	}
+	if cfg.Retry.InitialDelay < 0 || cfg.Retry.MaxDelay < 0 {
+		return fmt.Errorf("invalid retry delay: initial %g, max %g", cfg.Retry.InitialDelay, cfg.Retry.MaxDelay)
+	}
+	if cfg.Swarm.User == "" && (cfg.Swarm.Ticket != "" || cfg.Swarm.Password != "") {
+		return fmt.Errorf("swarm user is required with a ticket or password")
+	}
+	switch cfg.Swarm.Comments.Previous {
+	case "", CommentPreviousEdit, CommentPreviousArchive:
+	default:
+		return fmt.Errorf("invalid swarm comments previous mode: %s", cfg.Swarm.Comments.Previous)
+	}
+	if cfg.Swarm.Comments.Enabled && !cfg.Swarm.HasCredentials() {
+		return fmt.Errorf("swarm comments require a swarm user and ticket or password")
+	}
+	if err := validateReview("swarm review", cfg.Swarm.Review, cfg.Swarm.HasCredentials()); err != nil {
+		return err
+	}
+	if cfg.Swarm.LogExcerpt.MaxLines < 0 || cfg.Swarm.LogExcerpt.MaxBytes < 0 {
+		return fmt.Errorf("invalid swarm log excerpt limits: %d lines, %d bytes", cfg.Swarm.LogExcerpt.MaxLines, cfg.Swarm.LogExcerpt.MaxBytes)
+	}
+	if cfg.Swarm.Artifacts.MaxLinks < 0 {
+		return fmt.Errorf("invalid swarm artifact max links: %d", cfg.Swarm.Artifacts.MaxLinks)
+	}
+	for _, pattern := range cfg.Swarm.Artifacts.Names {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("swarm artifacts: invalid name pattern %q: %w", pattern, err)
+		}
+	}
+	if cfg.Monitor.Concurrency < 0 {
+		return fmt.Errorf("invalid monitor concurrency: %d", cfg.Monitor.Concurrency)
+	}
+	switch cfg.Storage.Type {
+	case "", StorageTypeMemory, StorageTypeBolt:
+	default:
+		return fmt.Errorf("invalid storage type: %s", cfg.Storage.Type)
+	}
+	if _, err := cfg.Webhook.AllowedNetworks(); err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	if _, err := cfg.Webhook.TrustedProxyNetworks(); err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	if err := validateRoutes(cfg.Routes, cfg.Swarm.HasCredentials()); err != nil {
+		return err
+	}
+	if err := validateJobTemplates("job", cfg.Job); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateJobTemplates checks that job name and argument templates parse
+func validateJobTemplates(scope string, job JobConfig) error {
+	if _, err := template.New("name").Parse(job.Name); err != nil {
+		return fmt.Errorf("%s: invalid name template: %w", scope, err)
+	}
+	for i, arg := range job.Arguments {
+		if _, err := template.New("argument").Parse(arg); err != nil {
+			return fmt.Errorf("%s: invalid argument template %d: %w", scope, i, err)
+		}
+	}
+	return nil
+}
+
+// validateReview checks that review states are known and that review actions
+// that are not dry runs can authenticate with Swarm
+func validateReview(scope string, review ReviewConfig, swarmCredentials bool) error {
+	for _, state := range []string{review.PassState, review.FailState} {
+		if state != "" && !containsString(ReviewStates, state) {
+			return fmt.Errorf("%s: invalid review state: %s", scope, state)
+		}
+	}
+	if review.Enabled() && !review.DryRun && !swarmCredentials {
+		return fmt.Errorf("%s: review actions require a swarm user and ticket or password", scope)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRoutes checks that routes are uniquely named, complete and use valid
+// patterns and review settings
+func validateRoutes(routes []RouteConfig, swarmCredentials bool) error {
+	names := make(map[string]bool, len(routes))
+	for i, route := range routes {
+		if route.Name == "" {
+			return fmt.Errorf("route %d: name is required", i)
+		}
+		if names[route.Name] {
+			return fmt.Errorf("route %s: duplicate name", route.Name)
+		}
+		names[route.Name] = true
+
+		if route.StreamId == "" || route.TemplateId == "" {
+			return fmt.Errorf("route %s: stream_id and template_id are required", route.Name)
+		}
+		if err := validateJobTemplates("route "+route.Name, route.Job); err != nil {
+			return err
+		}
+		if route.Review != nil {
+			if err := validateReview("route "+route.Name+" review", *route.Review, swarmCredentials); err != nil {
+				return err
+			}
+		}
+
+		for _, pattern := range []string{
+			route.Match.Branch,
+			route.Match.Project,
+			route.Match.Test,
+		} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("route %s: invalid pattern %q: %w", route.Name, pattern, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -157,6 +440,14 @@ func setDefaults(cfg *Config) {
 		cfg.Server.Port = 8080
 	}
 
+	// Horde defaults
+	if cfg.Horde.Breaker.FailureThreshold == 0 {
+		cfg.Horde.Breaker.FailureThreshold = 5
+	}
+	if cfg.Horde.Breaker.OpenTimeout == 0 {
+		cfg.Horde.Breaker.OpenTimeout = 30
+	}
+
 	// Swarm defaults
 	if cfg.Swarm.Host == "" {
 		cfg.Swarm.Host = "http://localhost"
@@ -164,11 +455,50 @@ func setDefaults(cfg *Config) {
 	if cfg.Swarm.Timeout == 0 {
 		cfg.Swarm.Timeout = 30
 	}
+	if cfg.Swarm.MaxMessages == 0 {
+		cfg.Swarm.MaxMessages = 10
+	}
+	if cfg.Swarm.MaxMessageLength == 0 {
+		cfg.Swarm.MaxMessageLength = 255
+	}
+	if cfg.Swarm.Outbox.MaxAttempts == 0 {
+		cfg.Swarm.Outbox.MaxAttempts = 10
+	}
+	if cfg.Swarm.Outbox.InitialDelay == 0 {
+		cfg.Swarm.Outbox.InitialDelay = 5
+	}
+	if cfg.Swarm.Outbox.MaxDelay == 0 {
+		cfg.Swarm.Outbox.MaxDelay = 300
+	}
+	if cfg.Swarm.Outbox.DeliveredRetention == 0 {
+		cfg.Swarm.Outbox.DeliveredRetention = 168
+	}
+	if cfg.Swarm.LogExcerpt.MaxLines == 0 {
+		cfg.Swarm.LogExcerpt.MaxLines = 5
+	}
+	if cfg.Swarm.LogExcerpt.MaxBytes == 0 {
+		cfg.Swarm.LogExcerpt.MaxBytes = 2048
+	}
+	if cfg.Swarm.Artifacts.MaxLinks == 0 {
+		cfg.Swarm.Artifacts.MaxLinks = 5
+	}
+	if cfg.Swarm.Comments.Previous == "" {
+		cfg.Swarm.Comments.Previous = CommentPreviousEdit
+	}
 
 	// Monitor defaults
 	if cfg.Monitor.Interval == 0 {
 		cfg.Monitor.Interval = 30
 	}
+	if cfg.Monitor.ReconcileInterval == 0 {
+		cfg.Monitor.ReconcileInterval = 300
+	}
+	if cfg.Monitor.Concurrency == 0 {
+		cfg.Monitor.Concurrency = 4
+	}
+	if cfg.Monitor.JobTimeout == 0 {
+		cfg.Monitor.JobTimeout = 30
+	}
 
 	// Timeout defaults
 	if cfg.Timeouts.HTTPClient == 0 {
@@ -189,6 +519,47 @@ func setDefaults(cfg *Config) {
 		cfg.Retry.MaxDelay = 5
 	}
 
+	// Storage defaults
+	if cfg.Storage.Type == "" {
+		cfg.Storage.Type = StorageTypeMemory
+	}
+	if cfg.Storage.Path == "" {
+		cfg.Storage.Path = "swarm-horde-bridge.db"
+	}
+	if cfg.Storage.Retention == 0 {
+		cfg.Storage.Retention = 168
+	}
+
+	// Webhook defaults
+	if cfg.Webhook.TokenHeader == "" {
+		cfg.Webhook.TokenHeader = "X-Swarm-Token"
+	}
+	if cfg.Webhook.TokenQuery == "" {
+		cfg.Webhook.TokenQuery = "token"
+	}
+	if cfg.Webhook.HMACHeader == "" {
+		cfg.Webhook.HMACHeader = "X-Signature-256"
+	}
+	if cfg.Webhook.DedupWindow == 0 {
+		cfg.Webhook.DedupWindow = 3600
+	}
+
+	// Intake defaults
+	if cfg.Intake.MaxAge == 0 {
+		cfg.Intake.MaxAge = 86400
+	}
+	if cfg.Intake.InitialDelay == 0 {
+		cfg.Intake.InitialDelay = 5
+	}
+	if cfg.Intake.MaxDelay == 0 {
+		cfg.Intake.MaxDelay = 300
+	}
+
+	// Job defaults
+	if cfg.Job.Name == "" {
+		cfg.Job.Name = DefaultJobName
+	}
+
 	// Log level default
 	if cfg.LogLevel == "" {
 		cfg.LogLevel = "info"
@@ -200,6 +571,21 @@ func setDefaults(cfg *Config) {
 	}
 }
 
+// ReviewFor returns the review settings for jobs created through a route. A
+// route's own settings replace the global ones, except that a global dry run
+// applies to every route.
+func (c *Config) ReviewFor(route string) ReviewConfig {
+	review := c.Swarm.Review
+	for _, r := range c.Routes {
+		if r.Name == route && r.Review != nil {
+			review = *r.Review
+			review.DryRun = review.DryRun || c.Swarm.Review.DryRun
+			break
+		}
+	}
+	return review
+}
+
 // GetHTTPClientTimeout returns the HTTP client timeout as a time.Duration
 func (c *Config) GetHTTPClientTimeout() time.Duration {
 	return time.Duration(c.Timeouts.HTTPClient) * time.Second
@@ -214,3 +600,52 @@ func (c *Config) GetShutdownTimeout() time.Duration {
 func (c *Config) GetMonitorInterval() time.Duration {
 	return time.Duration(c.Monitor.Interval) * time.Second
 }
+
+// GetPollInterval returns how often the monitor polls Horde, which is the
+// reconcile interval when job notifications drive the monitor
+func (c *Config) GetPollInterval() time.Duration {
+	if c.Monitor.EventDriven {
+		return time.Duration(c.Monitor.ReconcileInterval) * time.Second
+	}
+	return c.GetMonitorInterval()
+}
+
+// GetMonitorJobTimeout returns the time allowed to fetch one job's state as a time.Duration
+func (c *Config) GetMonitorJobTimeout() time.Duration {
+	return time.Duration(c.Monitor.JobTimeout) * time.Second
+}
+
+// GetRetryInitialDelay returns the delay before the first retry as a time.Duration
+func (c *Config) GetRetryInitialDelay() time.Duration {
+	return time.Duration(c.Retry.InitialDelay * float64(time.Second))
+}
+
+// GetRetryMaxDelay returns the longest delay between retries as a time.Duration
+func (c *Config) GetRetryMaxDelay() time.Duration {
+	return time.Duration(c.Retry.MaxDelay * float64(time.Second))
+}
+
+// GetBreakerOpenTimeout returns how long the Horde circuit breaker stays open as a time.Duration
+func (c *Config) GetBreakerOpenTimeout() time.Duration {
+	return time.Duration(c.Horde.Breaker.OpenTimeout) * time.Second
+}
+
+// GetDedupWindow returns the webhook deduplication window as a time.Duration
+func (c *Config) GetDedupWindow() time.Duration {
+	return time.Duration(c.Webhook.DedupWindow) * time.Second
+}
+
+// GetIntakeMaxAge returns how long a request is held for job creation as a time.Duration
+func (c *Config) GetIntakeMaxAge() time.Duration {
+	return time.Duration(c.Intake.MaxAge) * time.Second
+}
+
+// GetOutboxDeliveredRetention returns how long delivered final results are remembered as a time.Duration
+func (c *Config) GetOutboxDeliveredRetention() time.Duration {
+	return time.Duration(c.Swarm.Outbox.DeliveredRetention) * time.Hour
+}
+
+// GetStorageRetention returns the job mapping retention as a time.Duration
+func (c *Config) GetStorageRetention() time.Duration {
+	return time.Duration(c.Storage.Retention) * time.Hour
+}
@@ -86,6 +86,59 @@ log_level: "info"
 				assert.Equal(t, "debug", cfg.LogLevel)
 			},
 		},
+		{
+			name:       "event driven monitor from env",
+			configPath: tmpfile.Name(),
+			envVars: map[string]string{
+				"MONITOR_EVENT_DRIVEN":       "true",
+				"MONITOR_RECONCILE_INTERVAL": "600",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.True(t, cfg.Monitor.EventDriven)
+				assert.Equal(t, 600, cfg.Monitor.ReconcileInterval)
+				assert.Equal(t, 600*time.Second, cfg.GetPollInterval())
+			},
+		},
+		{
+			name:       "fractional retry delays from env",
+			configPath: tmpfile.Name(),
+			envVars: map[string]string{
+				"RETRY_INITIAL_DELAY":  "0.5",
+				"RETRY_MAX_DELAY":      "2.5",
+				"RETRY_DISABLE_JITTER": "true",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, 500*time.Millisecond, cfg.GetRetryInitialDelay())
+				assert.Equal(t, 2500*time.Millisecond, cfg.GetRetryMaxDelay())
+				assert.True(t, cfg.Retry.DisableJitter)
+			},
+		},
+		{
+			name:       "swarm credentials from env",
+			configPath: tmpfile.Name(),
+			envVars: map[string]string{
+				"SWARM_USER":     "bridge",
+				"SWARM_PASSWORD": "secret",
+				"SWARM_TICKET":   "ABCDEF",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.True(t, cfg.Swarm.HasCredentials())
+				assert.Equal(t, "bridge", cfg.Swarm.User)
+				assert.Equal(t, "ABCDEF", cfg.Swarm.Secret())
+			},
+		},
+		{
+			name:       "log excerpt limits from env",
+			configPath: tmpfile.Name(),
+			envVars: map[string]string{
+				"SWARM_LOG_EXCERPT_LINES": "3",
+				"SWARM_LOG_EXCERPT_BYTES": "512",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, 3, cfg.Swarm.LogExcerpt.MaxLines)
+				assert.Equal(t, 512, cfg.Swarm.LogExcerpt.MaxBytes)
+			},
+		},
 		{
 			name:       "invalid port in env",
 			configPath: tmpfile.Name(),
@@ -95,6 +148,15 @@ log_level: "info"
 			wantErr:     true,
 			errContains: "invalid PORT value",
 		},
+		{
+			name:       "invalid review dry run in env",
+			configPath: tmpfile.Name(),
+			envVars: map[string]string{
+				"SWARM_REVIEW_DRY_RUN": "maybe",
+			},
+			wantErr:     true,
+			errContains: "invalid SWARM_REVIEW_DRY_RUN value",
+		},
 		{
 			name:       "invalid timeout in env",
 			configPath: tmpfile.Name(),
@@ -173,6 +235,49 @@ func TestConfigHelperMethods(t *testing.T) {
 		expected := 15 * time.Second
 		assert.Equal(t, expected, cfg.GetMonitorInterval())
 	})
+
+	t.Run("GetPollInterval", func(t *testing.T) {
+		assert.Equal(t, 15*time.Second, cfg.GetPollInterval())
+
+		cfg := &Config{Monitor: MonitorConfig{Interval: 15, EventDriven: true, ReconcileInterval: 300}}
+		assert.Equal(t, 300*time.Second, cfg.GetPollInterval())
+	})
+
+	t.Run("GetMonitorJobTimeout", func(t *testing.T) {
+		cfg := &Config{Monitor: MonitorConfig{JobTimeout: 20}}
+		assert.Equal(t, 20*time.Second, cfg.GetMonitorJobTimeout())
+	})
+
+	t.Run("GetDedupWindow", func(t *testing.T) {
+		cfg := &Config{Webhook: WebhookConfig{DedupWindow: 600}}
+		assert.Equal(t, 10*time.Minute, cfg.GetDedupWindow())
+	})
+
+	t.Run("GetRetryDelays", func(t *testing.T) {
+		cfg := &Config{Retry: RetryConfig{InitialDelay: 0.25, MaxDelay: 2}}
+		assert.Equal(t, 250*time.Millisecond, cfg.GetRetryInitialDelay())
+		assert.Equal(t, 2*time.Second, cfg.GetRetryMaxDelay())
+	})
+
+	t.Run("GetBreakerOpenTimeout", func(t *testing.T) {
+		cfg := &Config{Horde: HordeConfig{Breaker: BreakerConfig{OpenTimeout: 60}}}
+		assert.Equal(t, time.Minute, cfg.GetBreakerOpenTimeout())
+	})
+
+	t.Run("GetIntakeMaxAge", func(t *testing.T) {
+		cfg := &Config{Intake: IntakeConfig{MaxAge: 3600}}
+		assert.Equal(t, time.Hour, cfg.GetIntakeMaxAge())
+	})
+
+	t.Run("GetOutboxDeliveredRetention", func(t *testing.T) {
+		cfg := &Config{Swarm: SwarmConfig{Outbox: OutboxConfig{DeliveredRetention: 48}}}
+		assert.Equal(t, 48*time.Hour, cfg.GetOutboxDeliveredRetention())
+	})
+
+	t.Run("GetStorageRetention", func(t *testing.T) {
+		cfg := &Config{Storage: StorageConfig{Retention: 24}}
+		assert.Equal(t, 24*time.Hour, cfg.GetStorageRetention())
+	})
 }
 
 func TestValidate(t *testing.T) {
@@ -227,6 +332,233 @@ func TestValidate(t *testing.T) {
 			wantErr:     true,
 			errContains: "invalid port number",
 		},
+		{
+			name: "swarm ticket without user",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Swarm: SwarmConfig{Ticket: "ABCDEF"},
+			},
+			wantErr:     true,
+			errContains: "swarm user is required",
+		},
+		{
+			name: "swarm comments without credentials",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Swarm: SwarmConfig{Comments: CommentConfig{Enabled: true}},
+			},
+			wantErr:     true,
+			errContains: "swarm comments require",
+		},
+		{
+			name: "invalid swarm comments previous mode",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Swarm: SwarmConfig{Comments: CommentConfig{Previous: "delete"}},
+			},
+			wantErr:     true,
+			errContains: "invalid swarm comments previous mode",
+		},
+		{
+			name: "swarm review votes without credentials",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Swarm: SwarmConfig{Review: ReviewConfig{Vote: true}},
+			},
+			wantErr:     true,
+			errContains: "review actions require",
+		},
+		{
+			name: "swarm review dry run without credentials",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Swarm: SwarmConfig{Review: ReviewConfig{Vote: true, DryRun: true}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid route review state",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Routes: []RouteConfig{
+					{Name: "main", StreamId: "s", TemplateId: "t", Review: &ReviewConfig{FailState: "blocked", DryRun: true}},
+				},
+			},
+			wantErr:     true,
+			errContains: "route main review: invalid review state",
+		},
+		{
+			name: "negative log excerpt lines",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Swarm: SwarmConfig{LogExcerpt: LogExcerptConfig{MaxLines: -1}},
+			},
+			wantErr:     true,
+			errContains: "invalid swarm log excerpt limits",
+		},
+		{
+			name: "invalid artifact name pattern",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Swarm: SwarmConfig{Artifacts: ArtifactConfig{Names: []string{"[build"}}},
+			},
+			wantErr:     true,
+			errContains: "invalid name pattern",
+		},
+		{
+			name: "negative breaker threshold",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:    "http://example.com",
+					APIKey:  "test-key",
+					Breaker: BreakerConfig{FailureThreshold: -1},
+				},
+			},
+			wantErr:     true,
+			errContains: "invalid horde breaker failure threshold",
+		},
+		{
+			name: "negative monitor concurrency",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Monitor: MonitorConfig{Concurrency: -1},
+			},
+			wantErr:     true,
+			errContains: "invalid monitor concurrency",
+		},
+		{
+			name: "invalid storage type",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Storage: StorageConfig{Type: "redis"},
+			},
+			wantErr:     true,
+			errContains: "invalid storage type",
+		},
+		{
+			name: "invalid webhook allowlist",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Webhook: WebhookConfig{AllowedIPs: []string{"10.0.0.0/8", "not-an-ip"}},
+			},
+			wantErr:     true,
+			errContains: "invalid allowed IP",
+		},
+		{
+			name: "invalid webhook trusted proxy",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Webhook: WebhookConfig{TrustedProxies: []string{"10.0.0.0/33"}},
+			},
+			wantErr:     true,
+			errContains: "invalid trusted proxy range",
+		},
+		{
+			name: "route without template",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Routes: []RouteConfig{{Name: "main", StreamId: "main-stream"}},
+			},
+			wantErr:     true,
+			errContains: "stream_id and template_id are required",
+		},
+		{
+			name: "duplicate route names",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Routes: []RouteConfig{
+					{Name: "main", StreamId: "s", TemplateId: "t"},
+					{Name: "main", StreamId: "s", TemplateId: "t"},
+				},
+			},
+			wantErr:     true,
+			errContains: "duplicate name",
+		},
+		{
+			name: "invalid route pattern",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Routes: []RouteConfig{
+					{Name: "main", StreamId: "s", TemplateId: "t", Match: RouteMatch{Test: "[unclosed"}},
+				},
+			},
+			wantErr:     true,
+			errContains: "invalid pattern",
+		},
+		{
+			name: "invalid job argument template",
+			cfg: Config{
+				Server: ServerConfig{Port: 8080},
+				Horde: HordeConfig{
+					Host:   "http://example.com",
+					APIKey: "test-key",
+				},
+				Job: JobConfig{Arguments: []string{"-set:Review={{.ReviewID"}},
+			},
+			wantErr:     true,
+			errContains: "invalid argument template",
+		},
 	}
 
 	for _, tt := range tests {
@@ -249,14 +581,46 @@ func TestSetDefaults(t *testing.T) {
 	setDefaults(cfg)
 
 	assert.Equal(t, 8080, cfg.Server.Port)
+	assert.Equal(t, 5, cfg.Horde.Breaker.FailureThreshold)
+	assert.Equal(t, 30, cfg.Horde.Breaker.OpenTimeout)
 	assert.Equal(t, "http://localhost", cfg.Swarm.Host)
 	assert.Equal(t, 30, cfg.Swarm.Timeout)
+	assert.Equal(t, 10, cfg.Swarm.MaxMessages)
+	assert.Equal(t, 255, cfg.Swarm.MaxMessageLength)
+	assert.Equal(t, 10, cfg.Swarm.Outbox.MaxAttempts)
+	assert.Equal(t, 5, cfg.Swarm.Outbox.InitialDelay)
+	assert.Equal(t, 300, cfg.Swarm.Outbox.MaxDelay)
+	assert.Equal(t, 168, cfg.Swarm.Outbox.DeliveredRetention)
+	assert.False(t, cfg.Swarm.LogExcerpt.Disabled)
+	assert.Equal(t, 5, cfg.Swarm.LogExcerpt.MaxLines)
+	assert.Equal(t, 2048, cfg.Swarm.LogExcerpt.MaxBytes)
+	assert.False(t, cfg.Swarm.Artifacts.Enabled)
+	assert.Equal(t, 5, cfg.Swarm.Artifacts.MaxLinks)
+	assert.False(t, cfg.Swarm.Comments.Enabled)
+	assert.Equal(t, CommentPreviousEdit, cfg.Swarm.Comments.Previous)
+	assert.False(t, cfg.Swarm.Review.Enabled())
 	assert.Equal(t, 30, cfg.Monitor.Interval)
+	assert.False(t, cfg.Monitor.EventDriven)
+	assert.Equal(t, 300, cfg.Monitor.ReconcileInterval)
+	assert.Equal(t, 4, cfg.Monitor.Concurrency)
+	assert.Equal(t, 30, cfg.Monitor.JobTimeout)
 	assert.Equal(t, 30, cfg.Timeouts.HTTPClient)
 	assert.Equal(t, 5, cfg.Timeouts.Shutdown)
 	assert.Equal(t, 3, cfg.Retry.MaxAttempts)
-	assert.Equal(t, 1, cfg.Retry.InitialDelay)
-	assert.Equal(t, 5, cfg.Retry.MaxDelay)
+	assert.Equal(t, 1.0, cfg.Retry.InitialDelay)
+	assert.Equal(t, 5.0, cfg.Retry.MaxDelay)
+	assert.False(t, cfg.Retry.DisableJitter)
+	assert.Equal(t, StorageTypeMemory, cfg.Storage.Type)
+	assert.Equal(t, "swarm-horde-bridge.db", cfg.Storage.Path)
+	assert.Equal(t, 168, cfg.Storage.Retention)
+	assert.Equal(t, "X-Swarm-Token", cfg.Webhook.TokenHeader)
+	assert.Equal(t, "token", cfg.Webhook.TokenQuery)
+	assert.Equal(t, "X-Signature-256", cfg.Webhook.HMACHeader)
+	assert.Equal(t, 3600, cfg.Webhook.DedupWindow)
+	assert.Equal(t, 86400, cfg.Intake.MaxAge)
+	assert.Equal(t, 5, cfg.Intake.InitialDelay)
+	assert.Equal(t, 300, cfg.Intake.MaxDelay)
+	assert.Equal(t, DefaultJobName, cfg.Job.Name)
 	assert.Equal(t, "info", cfg.LogLevel)
 }
 
@@ -265,17 +629,43 @@ func TestSetDefaults(t *testing.T) {
 func clearEnvVars() {
 	envVars := []string{
 		"PORT",
+		"API_TOKEN",
 		"HORDE_HOST",
 		"HORDE_API_KEY",
 		"HORDE_TIMEOUT",
+		"HORDE_BREAKER_THRESHOLD",
+		"HORDE_BREAKER_OPEN_TIMEOUT",
 		"SWARM_HOST",
 		"SWARM_TIMEOUT",
+		"SWARM_USER",
+		"SWARM_TICKET",
+		"SWARM_PASSWORD",
+		"SWARM_OUTBOX_MAX_ATTEMPTS",
+		"SWARM_OUTBOX_DELIVERED_RETENTION",
+		"SWARM_LOG_EXCERPT_DISABLED",
+		"SWARM_LOG_EXCERPT_LINES",
+		"SWARM_LOG_EXCERPT_BYTES",
+		"SWARM_ARTIFACTS_ENABLED",
+		"SWARM_COMMENTS_ENABLED",
+		"SWARM_REVIEW_DRY_RUN",
 		"MONITOR_INTERVAL",
+		"MONITOR_EVENT_DRIVEN",
+		"MONITOR_RECONCILE_INTERVAL",
+		"MONITOR_CONCURRENCY",
+		"MONITOR_JOB_TIMEOUT",
 		"TIMEOUT_HTTP_CLIENT",
 		"TIMEOUT_SHUTDOWN",
 		"RETRY_MAX_ATTEMPTS",
 		"RETRY_INITIAL_DELAY",
 		"RETRY_MAX_DELAY",
+		"RETRY_DISABLE_JITTER",
+		"STORAGE_TYPE",
+		"STORAGE_PATH",
+		"STORAGE_RETENTION",
+		"WEBHOOK_TOKEN",
+		"WEBHOOK_HMAC_SECRET",
+		"WEBHOOK_DEDUP_WINDOW",
+		"INTAKE_MAX_AGE",
 		"LOG_LEVEL",
 	}
 
@@ -296,3 +686,17 @@ func createTempConfig(t *testing.T, content string) string {
 
 	return tmpfile.Name()
 }
+
+func TestWebhookAllowedNetworks(t *testing.T) {
+	cfg := WebhookConfig{AllowedIPs: []string{"10.1.2.3", "192.168.0.0/16", "::1"}}
+
+	networks, err := cfg.AllowedNetworks()
+	require.NoError(t, err)
+	require.Len(t, networks, 3)
+
+	assert.Equal(t, "10.1.2.3/32", networks[0].String())
+	assert.Equal(t, "192.168.0.0/16", networks[1].String())
+	assert.Equal(t, "::1/128", networks[2].String())
+	assert.True(t, cfg.AuthEnabled())
+	assert.False(t, WebhookConfig{}.AuthEnabled())
+}
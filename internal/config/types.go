@@ -1,6 +1,11 @@
 package config
 
-import "time"
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
 
 // Clock interface for better testing
 type Clock interface {
@@ -22,6 +27,11 @@ type Config struct {
 	Monitor  MonitorConfig `yaml:"monitor"`
 	Timeouts TimeoutConfig `yaml:"timeouts"`
 	Retry    RetryConfig   `yaml:"retry"`
+	Storage  StorageConfig `yaml:"storage"`
+	Webhook  WebhookConfig `yaml:"webhook"`
+	Intake   IntakeConfig  `yaml:"intake"`
+	Routes   []RouteConfig `yaml:"routes"`
+	Job      JobConfig     `yaml:"job"`
 	LogLevel string        `yaml:"log_level" env:"LOG_LEVEL" default:"info"`
 	// Clock for time operations, defaults to RealClock
 	Clock Clock
@@ -30,6 +40,8 @@ type Config struct {
 // ServerConfig holds the HTTP server configuration
 type ServerConfig struct {
 	Port int `yaml:"port" env:"PORT" default:"8080"`
+	// APIToken is required as a bearer token on the management endpoints
+	APIToken string `yaml:"api_token" env:"API_TOKEN"`
 }
 
 // HordeConfig holds the Horde API configuration
@@ -39,17 +51,175 @@ type HordeConfig struct {
 	Timeout    int    `yaml:"timeout" env:"HORDE_TIMEOUT" default:"30"`
 	TemplateId string `yaml:"template_id"`
 	StreamId   string `yaml:"stream_id"`
+	// Breaker stops calls to Horde while it is failing
+	Breaker BreakerConfig `yaml:"breaker"`
+}
+
+// BreakerConfig controls the circuit breaker around Horde API calls. The
+// breaker opens after FailureThreshold consecutive failures, fails calls fast
+// for OpenTimeout seconds and then lets a single call through to probe Horde.
+type BreakerConfig struct {
+	FailureThreshold int `yaml:"failure_threshold" env:"HORDE_BREAKER_THRESHOLD" default:"5"`
+	OpenTimeout      int `yaml:"open_timeout" env:"HORDE_BREAKER_OPEN_TIMEOUT" default:"30"`
+}
+
+// RouteConfig maps matching Swarm test requests to a Horde stream and template.
+// Routes are evaluated in order and the first match wins; a request can also
+// select a route explicitly by name with the "route" query parameter.
+type RouteConfig struct {
+	Name       string     `yaml:"name"`
+	Match      RouteMatch `yaml:"match"`
+	StreamId   string     `yaml:"stream_id"`
+	TemplateId string     `yaml:"template_id"`
+	// Job overrides the job name and adds arguments for jobs created through this route
+	Job JobConfig `yaml:"job"`
+	// Review, when set, replaces the global swarm.review settings for this route
+	Review *ReviewConfig `yaml:"review"`
+}
+
+// RouteMatch holds the request criteria of a route. Empty criteria match
+// anything; all non-empty criteria must match. Depot paths use Perforce
+// wildcards ("..." and "*"), the other criteria are glob patterns.
+type RouteMatch struct {
+	DepotPath string `yaml:"depot_path"`
+	Branch    string `yaml:"branch"`
+	Project   string `yaml:"project"`
+	Test      string `yaml:"test"`
+}
+
+// DefaultJobName is the job name template used when none is configured
+const DefaultJobName = `{{if .ReviewID}}Review {{.ReviewID}}{{with .Version}} v{{.}}{{end}}{{else}}Preflight{{end}} - CL {{.Changelist}}{{with .Test}} ({{.}}){{end}}`
+
+// JobConfig holds Go text/template strings used to build Horde job requests.
+// Templates are executed against the Swarm test request plus the selected
+// route, e.g. "-set:ReviewId={{.ReviewID}}"; arguments rendering empty are dropped.
+type JobConfig struct {
+	Name      string   `yaml:"name"`
+	Arguments []string `yaml:"arguments"`
 }
 
 // SwarmConfig holds the Swarm API configuration
 type SwarmConfig struct {
 	Host    string `yaml:"host" env:"SWARM_HOST" default:"http://localhost"`
 	Timeout int    `yaml:"timeout" env:"SWARM_TIMEOUT" default:"30"`
+	// User authenticates API calls with a Perforce Ticket, or failing that a
+	// Password; test run updates through the tokenised update URL need neither
+	User     string `yaml:"user" env:"SWARM_USER"`
+	Ticket   string `yaml:"ticket" env:"SWARM_TICKET"`
+	Password string `yaml:"password" env:"SWARM_PASSWORD"`
+	// MaxMessages and MaxMessageLength bound the test run messages sent to Swarm
+	MaxMessages      int `yaml:"max_messages" default:"10"`
+	MaxMessageLength int `yaml:"max_message_length" default:"255"`
+	// Outbox controls how failed status updates are retried
+	Outbox OutboxConfig `yaml:"outbox"`
+	// LogExcerpt controls the log lines of failed steps included in test run messages
+	LogExcerpt LogExcerptConfig `yaml:"log_excerpt"`
+
+	// Artifacts controls the artifact download links added to final test run updates
+	Artifacts ArtifactConfig `yaml:"artifacts"`
+
+	// Comments controls the review comments posted when a job fails
+	Comments CommentConfig `yaml:"comments"`
+
+	// Review controls the votes and state changes applied to reviews when jobs finish
+	Review ReviewConfig `yaml:"review"`
+}
+
+// ReviewConfig controls how the final outcome of a job is applied to its
+// Swarm review: Vote casts an up vote when the job passes and a down vote when
+// it fails, and PassState and FailState move the review to a state such as
+// "needsRevision". DryRun logs these actions instead of applying them.
+type ReviewConfig struct {
+	Vote      bool   `yaml:"vote"`
+	PassState string `yaml:"pass_state"`
+	FailState string `yaml:"fail_state"`
+	DryRun    bool   `yaml:"dry_run" env:"SWARM_REVIEW_DRY_RUN"`
+}
+
+// Enabled reports whether any review action is configured
+func (c ReviewConfig) Enabled() bool {
+	return c.Vote || c.PassState != "" || c.FailState != ""
+}
+
+// ReviewStates lists the review states jobs can move reviews to
+var ReviewStates = []string{"needsReview", "needsRevision", "approved", "rejected", "archived"}
+
+// What happens to the bridge's previous comment on a review when a test fails again
+const (
+	CommentPreviousEdit    = "edit"
+	CommentPreviousArchive = "archive"
+)
+
+// CommentConfig controls the review comments posted when a job fails. The
+// comment tags the review author and summarizes the failing steps. Previous
+// decides whether a later failure of the same test edits the earlier comment
+// or archives it and posts a new one; a later pass archives it.
+type CommentConfig struct {
+	Enabled  bool   `yaml:"enabled" env:"SWARM_COMMENTS_ENABLED" default:"false"`
+	Previous string `yaml:"previous" default:"edit"`
+}
+
+// ArtifactConfig selects the Horde artifacts linked from the final update of
+// a test run. Names are glob patterns and Types exact artifact types; empty
+// lists match every artifact. At most MaxLinks artifacts are linked.
+type ArtifactConfig struct {
+	Enabled  bool     `yaml:"enabled" env:"SWARM_ARTIFACTS_ENABLED" default:"false"`
+	Names    []string `yaml:"names"`
+	Types    []string `yaml:"types"`
+	MaxLinks int      `yaml:"max_links" default:"5"`
+}
+
+// HasCredentials reports whether Swarm API calls can be authenticated
+func (c SwarmConfig) HasCredentials() bool {
+	return c.User != "" && (c.Ticket != "" || c.Password != "")
+}
+
+// Secret returns the ticket, or the password when no ticket is configured
+func (c SwarmConfig) Secret() string {
+	if c.Ticket != "" {
+		return c.Ticket
+	}
+	return c.Password
+}
+
+// LogExcerptConfig bounds the error lines quoted from the logs of failed
+// steps: at most MaxLines per step and MaxBytes for the whole job.
+type LogExcerptConfig struct {
+	Disabled bool `yaml:"disabled" env:"SWARM_LOG_EXCERPT_DISABLED"`
+	MaxLines int  `yaml:"max_lines" env:"SWARM_LOG_EXCERPT_LINES" default:"5"`
+	MaxBytes int  `yaml:"max_bytes" env:"SWARM_LOG_EXCERPT_BYTES" default:"2048"`
+}
+
+// IntakeConfig controls how accepted Swarm test requests are held while Horde
+// is unavailable. Job creation is retried with exponential backoff between
+// InitialDelay and MaxDelay seconds; requests older than MaxAge seconds fail.
+type IntakeConfig struct {
+	MaxAge       int `yaml:"max_age" env:"INTAKE_MAX_AGE" default:"86400"`
+	InitialDelay int `yaml:"initial_delay" default:"5"`
+	MaxDelay     int `yaml:"max_delay" default:"300"`
+}
+
+// OutboxConfig holds the retry policy for queued Swarm status updates. Updates
+// that fail MaxAttempts times are moved to the dead-letter list.
+type OutboxConfig struct {
+	MaxAttempts  int `yaml:"max_attempts" env:"SWARM_OUTBOX_MAX_ATTEMPTS" default:"10"`
+	InitialDelay int `yaml:"initial_delay" default:"5"`
+	MaxDelay     int `yaml:"max_delay" default:"300"`
+	// DeliveredRetention is how many hours a delivered final result keeps stale
+	// updates of its test run from being sent
+	DeliveredRetention int `yaml:"delivered_retention" env:"SWARM_OUTBOX_DELIVERED_RETENTION" default:"168"`
 }
 
 // MonitorConfig holds the job monitoring configuration
 type MonitorConfig struct {
 	Interval int `yaml:"interval" env:"MONITOR_INTERVAL" default:"30"`
+	// EventDriven relies on Horde job notifications and only polls every ReconcileInterval
+	EventDriven       bool `yaml:"event_driven" env:"MONITOR_EVENT_DRIVEN" default:"false"`
+	ReconcileInterval int  `yaml:"reconcile_interval" env:"MONITOR_RECONCILE_INTERVAL" default:"300"`
+	// Concurrency is the number of jobs checked in parallel on each poll
+	Concurrency int `yaml:"concurrency" env:"MONITOR_CONCURRENCY" default:"4"`
+	// JobTimeout bounds fetching a single job's state from Horde, including retries
+	JobTimeout int `yaml:"job_timeout" env:"MONITOR_JOB_TIMEOUT" default:"30"`
 }
 
 // TimeoutConfig holds various timeout configurations
@@ -58,9 +228,88 @@ type TimeoutConfig struct {
 	Shutdown   int `yaml:"shutdown" env:"TIMEOUT_SHUTDOWN" default:"5"`
 }
 
-// RetryConfig holds retry-related configurations
+// RetryConfig holds the retry policy for Horde and Swarm API calls. Delays are
+// in seconds and may be fractional; each retry waits a random time up to the
+// backoff delay unless DisableJitter is set.
 type RetryConfig struct {
-	MaxAttempts  int `yaml:"max_attempts" env:"RETRY_MAX_ATTEMPTS" default:"3"`
-	InitialDelay int `yaml:"initial_delay" env:"RETRY_INITIAL_DELAY" default:"1"`
-	MaxDelay     int `yaml:"max_delay" env:"RETRY_MAX_DELAY" default:"5"`
+	MaxAttempts   int     `yaml:"max_attempts" env:"RETRY_MAX_ATTEMPTS" default:"3"`
+	InitialDelay  float64 `yaml:"initial_delay" env:"RETRY_INITIAL_DELAY" default:"1"`
+	MaxDelay      float64 `yaml:"max_delay" env:"RETRY_MAX_DELAY" default:"5"`
+	DisableJitter bool    `yaml:"disable_jitter" env:"RETRY_DISABLE_JITTER"`
+}
+
+// Storage backend types
+const (
+	StorageTypeMemory = "memory"
+	StorageTypeBolt   = "bolt"
+)
+
+// StorageConfig holds the job storage configuration
+type StorageConfig struct {
+	Type string `yaml:"type" env:"STORAGE_TYPE" default:"memory"`
+	Path string `yaml:"path" env:"STORAGE_PATH" default:"swarm-horde-bridge.db"`
+	// Retention is the number of hours an unchanged job mapping is kept before being cleaned up
+	Retention int `yaml:"retention" env:"STORAGE_RETENTION" default:"168"`
+}
+
+// WebhookConfig holds the authentication settings for incoming webhooks.
+// Every configured check must pass; leaving them all empty disables authentication.
+type WebhookConfig struct {
+	// Token is a shared secret expected in TokenHeader or the TokenQuery parameter
+	Token       string `yaml:"token" env:"WEBHOOK_TOKEN"`
+	TokenHeader string `yaml:"token_header" default:"X-Swarm-Token"`
+	TokenQuery  string `yaml:"token_query" default:"token"`
+	// HMACSecret enables HMAC-SHA256 body signatures sent in HMACHeader
+	HMACSecret string `yaml:"hmac_secret" env:"WEBHOOK_HMAC_SECRET"`
+	HMACHeader string `yaml:"hmac_header" default:"X-Signature-256"`
+	// AllowedIPs restricts callers to the listed addresses or CIDR ranges
+	AllowedIPs []string `yaml:"allowed_ips"`
+	// TrustedProxies lists the reverse proxies, as addresses or CIDR ranges,
+	// whose X-Forwarded-For and X-Real-IP headers name the caller checked
+	// against AllowedIPs. Headers from other peers are ignored.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// DedupWindow is how many seconds a repeated call for the same test run
+	// and changelist, or with the same Idempotency-Key, returns the existing job
+	DedupWindow int `yaml:"dedup_window" env:"WEBHOOK_DEDUP_WINDOW" default:"3600"`
+}
+
+// AuthEnabled reports whether any webhook authentication is configured
+func (c WebhookConfig) AuthEnabled() bool {
+	return c.Token != "" || c.HMACSecret != "" || len(c.AllowedIPs) > 0
+}
+
+// AllowedNetworks parses AllowedIPs into networks; single addresses become host networks
+func (c WebhookConfig) AllowedNetworks() ([]*net.IPNet, error) {
+	return parseNetworks(c.AllowedIPs, "allowed IP")
+}
+
+// TrustedProxyNetworks parses TrustedProxies into networks
+func (c WebhookConfig) TrustedProxyNetworks() ([]*net.IPNet, error) {
+	return parseNetworks(c.TrustedProxies, "trusted proxy")
+}
+
+func parseNetworks(entries []string, kind string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid %s: %s", kind, entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s range: %s", kind, entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
 }
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/metrics"
+)
+
+// maxWebhookBodySize bounds how much of a request body is buffered for signature checks
+const maxWebhookBodySize = 1 << 20
+
+// peerAddrKey is the context key of the socket peer address saved by PeerAddr
+type peerAddrKey struct{}
+
+// PeerAddr saves the address of the connection's peer before middleware such
+// as RealIP replaces RemoteAddr with a client-supplied header, so the webhook
+// IP allowlist checks the real peer. It must run before RealIP.
+func PeerAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), peerAddrKey{}, r.RemoteAddr)))
+	})
+}
+
+// peerAddr returns the address saved by PeerAddr, or RemoteAddr without it
+func peerAddr(r *http.Request) string {
+	if addr, ok := r.Context().Value(peerAddrKey{}).(string); ok {
+		return addr
+	}
+	return r.RemoteAddr
+}
+
+// webhookAuth authenticates incoming webhook calls against the configured
+// shared-secret token, HMAC body signature and source IP allowlist
+type webhookAuth struct {
+	cfg      config.WebhookConfig
+	networks []*net.IPNet
+	proxies  []*net.IPNet
+	logger   zerolog.Logger
+}
+
+func newWebhookAuth(cfg config.WebhookConfig, logger zerolog.Logger) (*webhookAuth, error) {
+	networks, err := cfg.AllowedNetworks()
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := cfg.TrustedProxyNetworks()
+	if err != nil {
+		return nil, err
+	}
+	return &webhookAuth{cfg: cfg, networks: networks, proxies: proxies, logger: logger}, nil
+}
+
+// middleware counts calls to the named webhook and rejects those failing any configured check
+func (a *webhookAuth) middleware(webhook string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			metrics.WebhooksReceived.WithLabelValues(webhook).Inc()
+
+			if reason := a.check(w, r); reason != "" {
+				a.logger.Warn().
+					Str("webhook", webhook).
+					Str("remote_addr", peerAddr(r)).
+					Str("reason", reason).
+					Msg("rejected unauthenticated webhook call")
+				metrics.WebhooksRejected.WithLabelValues(webhook, reason).Inc()
+
+				status := http.StatusUnauthorized
+				switch reason {
+				case "ip_not_allowed":
+					status = http.StatusForbidden
+				case "body_too_large":
+					status = http.StatusRequestEntityTooLarge
+				}
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// check returns the reason a request is rejected, or an empty string if it is allowed
+func (a *webhookAuth) check(w http.ResponseWriter, r *http.Request) string {
+	if len(a.networks) > 0 && !a.ipAllowed(a.clientIP(r)) {
+		return "ip_not_allowed"
+	}
+
+	if a.cfg.Token != "" {
+		token := r.Header.Get(a.cfg.TokenHeader)
+		if token == "" {
+			token = r.URL.Query().Get(a.cfg.TokenQuery)
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.cfg.Token)) != 1 {
+			return "invalid_token"
+		}
+	}
+
+	if a.cfg.HMACSecret != "" {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return "body_too_large"
+		}
+		if err != nil {
+			return "unreadable_body"
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if !a.signatureValid(r.Header.Get(a.cfg.HMACHeader), body) {
+			return "invalid_signature"
+		}
+	}
+
+	return ""
+}
+
+// clientIP returns the address of the caller. Forwarding headers are only
+// followed when the peer is a trusted proxy: X-Forwarded-For is read from the
+// right, skipping trusted proxies, so a client cannot prepend a forged address.
+func (a *webhookAuth) clientIP(r *http.Request) net.IP {
+	peer := parseHost(peerAddr(r))
+	if peer == nil || !containsIP(a.proxies, peer) {
+		return peer
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				return nil
+			}
+			if !containsIP(a.proxies, ip) {
+				return ip
+			}
+		}
+		return peer
+	}
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+		return realIP
+	}
+	return peer
+}
+
+// parseHost parses the IP of an address with or without a port
+func parseHost(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(host)
+}
+
+// ipAllowed reports whether the caller address falls within the allowlist
+func (a *webhookAuth) ipAllowed(ip net.IP) bool {
+	return ip != nil && containsIP(a.networks, ip)
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureValid verifies a hex HMAC-SHA256 signature, optionally prefixed with "sha256="
+func (a *webhookAuth) signatureValid(signature string, body []byte) bool {
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	got, err := hex.DecodeString(signature)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(a.cfg.HMACSecret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// requireAPIToken rejects requests without the configured bearer token. It
+// allows everything when no token is configured.
+func requireAPIToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token != "" {
+				got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+					http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookAuth(t *testing.T) {
+	const body = `{"changelist":"123","update_url":"http://swarm/update"}`
+
+	tests := []struct {
+		name       string
+		cfg        config.WebhookConfig
+		target     string
+		remoteAddr string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{
+			name:       "no authentication configured",
+			cfg:        config.WebhookConfig{},
+			target:     "/webhook/swarm-test",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "token in header",
+			cfg:        config.WebhookConfig{Token: "secret", TokenHeader: "X-Swarm-Token", TokenQuery: "token"},
+			target:     "/webhook/swarm-test",
+			headers:    map[string]string{"X-Swarm-Token": "secret"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "token in query",
+			cfg:        config.WebhookConfig{Token: "secret", TokenHeader: "X-Swarm-Token", TokenQuery: "token"},
+			target:     "/webhook/swarm-test?token=secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "wrong token",
+			cfg:        config.WebhookConfig{Token: "secret", TokenHeader: "X-Swarm-Token", TokenQuery: "token"},
+			target:     "/webhook/swarm-test?token=guess",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing token",
+			cfg:        config.WebhookConfig{Token: "secret", TokenHeader: "X-Swarm-Token", TokenQuery: "token"},
+			target:     "/webhook/swarm-test",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "valid signature",
+			cfg:        config.WebhookConfig{HMACSecret: "hmac-key", HMACHeader: "X-Signature-256"},
+			target:     "/webhook/swarm-test",
+			headers:    map[string]string{"X-Signature-256": sign("hmac-key", body)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "signature with wrong key",
+			cfg:        config.WebhookConfig{HMACSecret: "hmac-key", HMACHeader: "X-Signature-256"},
+			target:     "/webhook/swarm-test",
+			headers:    map[string]string{"X-Signature-256": sign("other-key", body)},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "allowed IP",
+			cfg:        config.WebhookConfig{AllowedIPs: []string{"10.0.0.0/8"}},
+			target:     "/webhook/swarm-test",
+			remoteAddr: "10.20.30.40:5555",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "allowed IP without port",
+			cfg:        config.WebhookConfig{AllowedIPs: []string{"10.20.30.40"}},
+			target:     "/webhook/swarm-test",
+			remoteAddr: "10.20.30.40",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "disallowed IP",
+			cfg:        config.WebhookConfig{AllowedIPs: []string{"10.0.0.0/8"}},
+			target:     "/webhook/swarm-test",
+			remoteAddr: "192.168.1.1:5555",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "spoofed forwarded address",
+			cfg:        config.WebhookConfig{AllowedIPs: []string{"10.0.0.0/8"}},
+			target:     "/webhook/swarm-test",
+			remoteAddr: "192.168.1.1:5555",
+			headers:    map[string]string{"X-Forwarded-For": "10.20.30.40", "X-Real-IP": "10.20.30.40"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "forwarded by trusted proxy",
+			cfg:        config.WebhookConfig{AllowedIPs: []string{"10.0.0.0/8"}, TrustedProxies: []string{"192.168.1.1"}},
+			target:     "/webhook/swarm-test",
+			remoteAddr: "192.168.1.1:5555",
+			headers:    map[string]string{"X-Forwarded-For": "10.20.30.40"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "forged hop behind trusted proxy",
+			cfg:        config.WebhookConfig{AllowedIPs: []string{"10.0.0.0/8"}, TrustedProxies: []string{"192.168.1.1"}},
+			target:     "/webhook/swarm-test",
+			remoteAddr: "192.168.1.1:5555",
+			headers:    map[string]string{"X-Forwarded-For": "10.20.30.40, 172.16.0.9"},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := newWebhookAuth(tt.cfg, zerolog.Nop())
+			if err != nil {
+				t.Fatalf("newWebhookAuth() error = %v", err)
+			}
+
+			var gotBody string
+			// Chained as in the server, where RealIP rewrites RemoteAddr from the headers
+			handler := PeerAddr(middleware.RealIP(auth.middleware(webhookSwarmTest)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				gotBody = string(data)
+				w.WriteHeader(http.StatusOK)
+			}))))
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(body))
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && gotBody != body {
+				t.Errorf("handler received body %q, want %q", gotBody, body)
+			}
+		})
+	}
+}
+
+func TestWebhookAuthBodyTooLarge(t *testing.T) {
+	cfg := config.WebhookConfig{HMACSecret: "hmac-key", HMACHeader: "X-Signature-256"}
+	auth, err := newWebhookAuth(cfg, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("newWebhookAuth() error = %v", err)
+	}
+	handler := auth.middleware(webhookSwarmTest)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called for oversized body")
+	}))
+
+	body := strings.Repeat("x", maxWebhookBodySize+1)
+	req := httptest.NewRequest(http.MethodPost, "/webhook/swarm-test", strings.NewReader(body))
+	// Signed over the first bytes only, which a truncating read would accept
+	req.Header.Set("X-Signature-256", sign("hmac-key", body[:maxWebhookBodySize]))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestRequireAPIToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "no token configured", wantStatus: http.StatusOK},
+		{name: "valid bearer token", token: "secret", authorization: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "missing token", token: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", authorization: "Bearer guess", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := requireAPIToken(tt.token)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/swarm/dead-letters/1/replay", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
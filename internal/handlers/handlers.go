@@ -2,22 +2,43 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
 
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/metrics"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/services"
 )
 
+// Webhook names used in metrics
+const (
+	webhookSwarmTest = "swarm-test"
+	webhookHordeJob  = "horde-job"
+)
+
+// JobNotifier is told about Horde jobs whose state changed so they are checked
+// without waiting for the next poll
+type JobNotifier interface {
+	Notify(jobID string) bool
+}
+
 type Handler struct {
 	cfg          *config.Config
 	logger       zerolog.Logger
 	hordeService *services.HordeService
-	swarmService *services.SwarmService
-	jobStorage   *services.JobStorage
+	dispatcher   *services.JobDispatcher
+	swarmQueue   *services.SwarmQueue
+	jobStorage   services.JobStorage
+	router       *services.Router
+	dedup        *services.Deduplicator
+	canceller    *services.Canceller
+	notifier     JobNotifier
 }
 
 // SetupRoutes configures all the routes for the application
@@ -26,26 +47,65 @@ func SetupRoutes(
 	cfg *config.Config,
 	logger zerolog.Logger,
 	hordeService *services.HordeService,
-	swarmService *services.SwarmService,
-	jobStorage *services.JobStorage,
-) {
+	dispatcher *services.JobDispatcher,
+	swarmQueue *services.SwarmQueue,
+	jobStorage services.JobStorage,
+	intake services.IntakeQueue,
+	notifier JobNotifier,
+) error {
+	auth, err := newWebhookAuth(cfg.Webhook, logger)
+	if err != nil {
+		return fmt.Errorf("configuring webhook authentication: %w", err)
+	}
+	if !cfg.Webhook.AuthEnabled() {
+		logger.Warn().Msg("webhook authentication is disabled, any caller can start Horde jobs")
+	}
+	if cfg.Server.APIToken == "" {
+		logger.Warn().Msg("no API token configured, management endpoints are open to any caller")
+	}
+
 	h := &Handler{
 		cfg:          cfg,
 		logger:       logger,
 		hordeService: hordeService,
-		swarmService: swarmService,
+		dispatcher:   dispatcher,
+		swarmQueue:   swarmQueue,
 		jobStorage:   jobStorage,
+		router:       services.NewRouter(cfg),
+		dedup:        services.NewDeduplicator(cfg, jobStorage, intake),
+		canceller:    services.NewCanceller(cfg, logger, hordeService, swarmQueue, jobStorage, intake),
+		notifier:     notifier,
 	}
 
 	router.Get("/health", h.handleHealth)
-	router.Post("/webhook/swarm-test", h.handleSwarmTest)
-	router.Get("/jobs", h.handleListJobs)
+	router.With(auth.middleware(webhookSwarmTest)).Post("/webhook/swarm-test", h.handleSwarmTest)
+	router.With(auth.middleware(webhookHordeJob)).Post("/webhook/horde-job", h.handleHordeJob)
+	// Job mappings hold Swarm's update URLs too
+	router.With(requireAPIToken(cfg.Server.APIToken)).Get("/jobs", h.handleListJobs)
+	router.With(requireAPIToken(cfg.Server.APIToken)).Get("/jobs/{id}", h.handleGetJob)
+	router.With(requireAPIToken(cfg.Server.APIToken)).Delete("/jobs", h.handleCancelJobs)
+	router.With(requireAPIToken(cfg.Server.APIToken)).Delete("/jobs/{id}", h.handleCancelJob)
+	// Queued requests hold Swarm's update URLs as well
+	router.With(requireAPIToken(cfg.Server.APIToken)).Get("/intake", h.handleListIntake)
+	// Dead letters hold Swarm's update URLs, which allow reporting results for the test runs
+	router.With(requireAPIToken(cfg.Server.APIToken)).Get("/swarm/dead-letters", h.handleListDeadLetters)
+	router.With(requireAPIToken(cfg.Server.APIToken)).Post("/swarm/dead-letters/{id}/replay", h.handleReplayDeadLetter)
+	router.Method(http.MethodGet, "/metrics", metrics.Handler())
+
+	return nil
 }
 
-// handleHealth handles health check requests
+// handleHealth handles health check requests. The bridge stays up while Horde
+// is unavailable, queueing requests, so this reports degraded rather than failing.
 func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	breaker := h.hordeService.BreakerState()
+	status := "healthy"
+	if breaker != services.BreakerClosed {
+		status = "degraded"
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]string{"status": "healthy"}); err != nil {
+	if err := json.NewEncoder(w).Encode(map[string]string{"status": status, "horde": string(breaker)}); err != nil {
 		h.logger.Error().Err(err).Msg("Failed to encode health check response")
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
@@ -59,6 +119,7 @@ func (h *Handler) handleSwarmTest(w http.ResponseWriter, r *http.Request) {
 	var req models.SwarmTestRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Error().Err(err).Msg("failed to decode request")
+		metrics.WebhooksRejected.WithLabelValues(webhookSwarmTest, "invalid_body").Inc()
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
@@ -68,53 +129,278 @@ func (h *Handler) handleSwarmTest(w http.ResponseWriter, r *http.Request) {
 	// Validate request
 	if req.Changelist == "" || req.UpdateURL == "" {
 		h.logger.Error().Msg("missing required fields in request")
+		metrics.WebhooksRejected.WithLabelValues(webhookSwarmTest, "missing_fields").Inc()
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
-	h.logger.Debug().Msgf("Request validated, proceeding to create a job in Horde for changelist: %s", req.Changelist)
+	// Return the existing request or job when Swarm retries or the caller repeats a request
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	dedupKey := services.DedupKey(req, idempotencyKey)
+	unlock := h.dedup.Lock(dedupKey)
+	defer unlock()
 
-	// Create Horde job
-	jobID, err := h.hordeService.CreateJob(r.Context(), req.Changelist)
+	existing, found, err := h.dedup.Find(dedupKey)
 	if err != nil {
-		h.logger.Error().Err(err).Msg("failed to create horde job")
-		http.Error(w, "Failed to create job", http.StatusInternalServerError)
+		h.logger.Error().Err(err).Msg("failed to look up existing jobs")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if found {
+		h.logger.Info().
+			Str("request_id", existing.RequestID).
+			Str("job_id", existing.JobID).
+			Str("changelist", req.Changelist).
+			Msg("Duplicate webhook call, returning existing request.")
+		metrics.WebhooksDeduplicated.WithLabelValues(webhookSwarmTest).Inc()
+		h.writeSwarmTestResponse(w, http.StatusOK, existing)
 		return
 	}
 
-	h.logger.Info().Msgf("Created Horde job with ID: %s for change: %s", jobID, req.Changelist)
-
-	// Store job mapping
-	mapping := &models.JobMapping{
-		SwarmTest:  req,
-		HordeJobID: jobID,
-		Status:     models.StatusPending,
-		CreatedAt:  h.cfg.Clock.Now(),
-		UpdatedAt:  h.cfg.Clock.Now(),
+	// Select the Horde stream and template for this test
+	target, err := h.router.Resolve(req, r.URL.Query().Get("route"))
+	if err != nil {
+		h.logger.Error().Err(err).
+			Str("project", req.Project).
+			Str("branch", req.Branch).
+			Str("test", req.Test).
+			Str("depot_path", req.DepotPath).
+			Msg("no horde route for request")
+		metrics.WebhooksRejected.WithLabelValues(webhookSwarmTest, "no_route").Inc()
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
 	}
-	h.jobStorage.Store(jobID, mapping)
 
-	// Update Swarm with initial status
-	err = h.swarmService.UpdateStatus(r.Context(), req.UpdateURL, "running", []string{"Started Horde job " + h.cfg.Horde.Host + "/job/" + jobID}, jobID)
+	// Queue the request; the dispatcher creates the Horde job in the background
+	intakeReq, err := h.dispatcher.Submit(r.Context(), req, target, idempotencyKey)
 	if err != nil {
-		h.logger.Error().Err(err).Msg("failed to update swarm status")
-		// Don't return error as the job was created successfully
+		h.logger.Error().Err(err).Msg("failed to queue swarm test request")
+		http.Error(w, "Failed to queue job request", http.StatusInternalServerError)
+		return
 	}
 
-	h.logger.Debug().Msgf("Initial Swarm status update sent for job ID: %s", jobID)
+	h.logger.Info().Msgf("Queued request %s for change: %s", intakeReq.ID, req.Changelist)
+
+	h.writeSwarmTestResponse(w, http.StatusAccepted, models.SwarmTestResponse{RequestID: intakeReq.ID})
+}
+
+// writeSwarmTestResponse reports the request or Horde job handling a test webhook call
+func (h *Handler) writeSwarmTestResponse(w http.ResponseWriter, status int, resp models.SwarmTestResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error().Err(err).Msg("failed to encode swarm test response")
+	}
+}
+
+// handleHordeJob handles notifications that a Horde job changed state. The
+// payload only identifies the job; its state is always fetched from Horde.
+func (h *Handler) handleHordeJob(w http.ResponseWriter, r *http.Request) {
+	jobID := r.URL.Query().Get("jobId")
+	if jobID == "" {
+		var req models.HordeJobNotification
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.logger.Error().Err(err).Msg("failed to decode horde job notification")
+			metrics.WebhooksRejected.WithLabelValues(webhookHordeJob, "invalid_body").Inc()
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		jobID = req.JobID()
+	}
+	if jobID == "" {
+		metrics.WebhooksRejected.WithLabelValues(webhookHordeJob, "missing_fields").Inc()
+		http.Error(w, "Missing job ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, exists, err := h.jobStorage.Get(jobID); err != nil {
+		h.logger.Error().Err(err).Str("job_id", jobID).Msg("failed to look up notified job")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	} else if !exists {
+		h.logger.Debug().Str("job_id", jobID).Msg("ignoring notification for untracked horde job")
+		metrics.WebhooksRejected.WithLabelValues(webhookHordeJob, "unknown_job").Inc()
+		http.Error(w, "Job not tracked", http.StatusNotFound)
+		return
+	}
 
-	// Returning status only as swarm does not care
+	if !h.notifier.Notify(jobID) {
+		// The reconciliation poll still picks the job up
+		h.logger.Warn().Str("job_id", jobID).Msg("could not queue horde job notification")
+	}
 	w.WriteHeader(http.StatusAccepted)
 }
 
-// handleListJobs returns a list of all current jobs
+// handleListJobs returns the current jobs matching the query parameters. When
+// more jobs follow a page, the X-Next-Cursor header holds the cursor to fetch them.
 func (h *Handler) handleListJobs(w http.ResponseWriter, r *http.Request) {
-	jobs := h.jobStorage.List()
+	query, err := services.ParseJobQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := h.jobStorage.List()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to list jobs")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	page, err := services.QueryJobs(jobs, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(jobs); err != nil {
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	if err := json.NewEncoder(w).Encode(page.Jobs); err != nil {
 		h.logger.Error().Err(err).Msg("failed to encode jobs response")
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 }
+
+// handleGetJob returns a single tracked job
+func (h *Handler) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "id")
+
+	job, exists, err := h.jobStorage.Get(jobID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("job_id", jobID).Msg("failed to get job")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Job not tracked", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		h.logger.Error().Err(err).Msg("failed to encode job response")
+	}
+}
+
+// defaultCancelReason is recorded in Horde when a cancel request gives no reason
+const defaultCancelReason = "Canceled through the Swarm-Horde bridge"
+
+// handleCancelJob aborts a tracked Horde job, reports it to Swarm and marks
+// it canceled
+func (h *Handler) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "id")
+
+	job, err := h.canceller.Cancel(r.Context(), jobID, cancelReason(r))
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		http.Error(w, "Job not tracked", http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrJobFinished):
+		http.Error(w, "Job already finished", http.StatusConflict)
+		return
+	case errors.Is(err, services.ErrCircuitOpen):
+		http.Error(w, "Horde is unavailable", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		horde.LogAPIError(h.logger.Error().Err(err), err).Str("job_id", jobID).Msg("failed to cancel job")
+		http.Error(w, "Failed to cancel job", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		h.logger.Error().Err(err).Msg("failed to encode canceled job response")
+	}
+}
+
+// handleCancelJobs cancels every unfinished job and queued request of a
+// changelist or review, selected with the changelist and review_id query parameters
+func (h *Handler) handleCancelJobs(w http.ResponseWriter, r *http.Request) {
+	filter := services.CancelFilter{
+		Changelist: r.URL.Query().Get("changelist"),
+		ReviewID:   r.URL.Query().Get("review_id"),
+	}
+	if filter.Changelist == "" && filter.ReviewID == "" {
+		http.Error(w, "Missing changelist or review_id", http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.canceller.CancelMatching(r.Context(), filter, cancelReason(r))
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to cancel jobs")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		h.logger.Error().Err(err).Msg("failed to encode cancel response")
+	}
+}
+
+func cancelReason(r *http.Request) string {
+	if reason := r.URL.Query().Get("reason"); reason != "" {
+		return reason
+	}
+	return defaultCancelReason
+}
+
+// handleListIntake returns the Swarm test requests still waiting for a Horde job
+func (h *Handler) handleListIntake(w http.ResponseWriter, r *http.Request) {
+	requests, err := h.dispatcher.Pending()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to list intake requests")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(requests); err != nil {
+		h.logger.Error().Err(err).Msg("failed to encode intake response")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleListDeadLetters returns the Swarm updates that could not be delivered
+func (h *Handler) handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	updates, err := h.swarmQueue.DeadLetters()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to list dead-lettered swarm updates")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(updates); err != nil {
+		h.logger.Error().Err(err).Msg("failed to encode dead letters response")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleReplayDeadLetter queues a dead-lettered Swarm update for delivery again
+func (h *Handler) handleReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	queued, err := h.swarmQueue.Replay(id)
+	if errors.Is(err, services.ErrDeadLetterNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Str("update_id", id).Msg("failed to replay swarm update")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !queued {
+		http.Error(w, "A final result is already queued or delivered for this test run", http.StatusConflict)
+		return
+	}
+
+	h.logger.Info().Str("update_id", id).Msg("Replaying dead-lettered swarm update.")
+	w.WriteHeader(http.StatusAccepted)
+}
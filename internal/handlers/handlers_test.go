@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/services"
+)
+
+type fakeNotifier struct {
+	notified []string
+}
+
+func (n *fakeNotifier) Notify(jobID string) bool {
+	n.notified = append(n.notified, jobID)
+	return true
+}
+
+func TestHandleSwarmTest(t *testing.T) {
+	newHandler := func(t *testing.T, cfg *config.Config) *chi.Mux {
+		t.Helper()
+		logger := zerolog.Nop()
+		storage := services.NewMemoryJobStorage()
+		intake := services.NewMemoryIntakeQueue()
+		queue := services.NewSwarmQueue(cfg, logger, services.NewSwarmService(cfg, logger), services.NewMemorySwarmOutbox(cfg.GetOutboxDeliveredRetention()))
+		dispatcher, err := services.NewJobDispatcher(cfg, logger, services.NewHordeService(cfg, logger), queue, storage, intake)
+		if err != nil {
+			t.Fatalf("NewJobDispatcher() error = %v", err)
+		}
+
+		h := &Handler{
+			cfg:        cfg,
+			logger:     logger,
+			dispatcher: dispatcher,
+			jobStorage: storage,
+			router:     services.NewRouter(cfg),
+			dedup:      services.NewDeduplicator(cfg, storage, intake),
+		}
+		router := chi.NewRouter()
+		router.Post("/webhook/swarm-test", h.handleSwarmTest)
+		return router
+	}
+	post := func(router *chi.Mux, body string) (*httptest.ResponseRecorder, models.SwarmTestResponse) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook/swarm-test", strings.NewReader(body)))
+		var resp models.SwarmTestResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	cfg := &config.Config{
+		Horde:   config.HordeConfig{Host: "http://horde", StreamId: "main", TemplateId: "preflight"},
+		Swarm:   config.SwarmConfig{Timeout: 5},
+		Webhook: config.WebhookConfig{DedupWindow: 3600},
+		Clock:   config.RealClock{},
+	}
+	const body = `{"changelist":"123","update_url":"http://swarm/update/1","test_run_id":"7"}`
+
+	t.Run("queues request", func(t *testing.T) {
+		router := newHandler(t, cfg)
+
+		rec, resp := post(router, body)
+		if rec.Code != http.StatusAccepted || resp.RequestID == "" || resp.Duplicate {
+			t.Fatalf("first call = %d %s, want 202 with a request ID", rec.Code, rec.Body.String())
+		}
+
+		// Swarm retrying the call gets the queued request back
+		dup, dupResp := post(router, body)
+		if dup.Code != http.StatusOK || dupResp.RequestID != resp.RequestID || !dupResp.Duplicate {
+			t.Errorf("repeated call = %d %s, want 200 duplicate of %s", dup.Code, dup.Body.String(), resp.RequestID)
+		}
+	})
+
+	t.Run("missing fields", func(t *testing.T) {
+		rec, _ := post(newHandler(t, cfg), `{"changelist":"123"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("no route", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Horde.StreamId, cfg.Horde.TemplateId = "", ""
+		rec, _ := post(newHandler(t, &cfg), body)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+		}
+	})
+}
+
+func TestHandleHordeJob(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		body         string
+		wantStatus   int
+		wantNotified []string
+	}{
+		{
+			name:         "job ID in body",
+			target:       "/webhook/horde-job",
+			body:         `{"jobId":"job-1","state":"Complete"}`,
+			wantStatus:   http.StatusAccepted,
+			wantNotified: []string{"job-1"},
+		},
+		{
+			name:         "snake case job ID",
+			target:       "/webhook/horde-job",
+			body:         `{"job_id":"job-1"}`,
+			wantStatus:   http.StatusAccepted,
+			wantNotified: []string{"job-1"},
+		},
+		{
+			name:         "job ID in query",
+			target:       "/webhook/horde-job?jobId=job-1",
+			wantStatus:   http.StatusAccepted,
+			wantNotified: []string{"job-1"},
+		},
+		{
+			name:       "untracked job",
+			target:     "/webhook/horde-job",
+			body:       `{"id":"job-2"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "missing job ID",
+			target:     "/webhook/horde-job",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid body",
+			target:     "/webhook/horde-job",
+			body:       `not json`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := services.NewMemoryJobStorage()
+			if err := storage.Store("job-1", &models.JobMapping{HordeJobID: "job-1", Status: models.StatusRunning}); err != nil {
+				t.Fatal(err)
+			}
+			notifier := &fakeNotifier{}
+			h := &Handler{logger: zerolog.Nop(), jobStorage: storage, notifier: notifier}
+
+			rec := httptest.NewRecorder()
+			h.handleHordeJob(rec, httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(notifier.notified, tt.wantNotified) {
+				t.Errorf("notified = %v, want %v", notifier.notified, tt.wantNotified)
+			}
+		})
+	}
+}
+
+func TestHandleHealth(t *testing.T) {
+	horde := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer horde.Close()
+
+	cfg := &config.Config{
+		Horde: config.HordeConfig{Host: horde.URL, Breaker: config.BreakerConfig{FailureThreshold: 1, OpenTimeout: 60}},
+		Retry: config.RetryConfig{MaxAttempts: 1},
+		Clock: config.RealClock{},
+	}
+	hordeService := services.NewHordeService(cfg, zerolog.Nop())
+	h := &Handler{logger: zerolog.Nop(), hordeService: hordeService}
+
+	health := func() map[string]string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decoding health response: %v", err)
+		}
+		return body
+	}
+
+	if body := health(); body["status"] != "healthy" || body["horde"] != "closed" {
+		t.Errorf("health = %v, want healthy with closed breaker", body)
+	}
+
+	// Horde failing opens the breaker; the bridge keeps serving but is degraded
+	if _, err := hordeService.GetJob(context.Background(), "job-1"); err == nil {
+		t.Fatal("GetJob() succeeded, want error from failing Horde")
+	}
+	if body := health(); body["status"] != "degraded" || body["horde"] != "open" {
+		t.Errorf("health = %v, want degraded with open breaker", body)
+	}
+}
+
+func TestHandleJobs(t *testing.T) {
+	storage := services.NewMemoryJobStorage()
+	for _, job := range []*models.JobMapping{
+		{HordeJobID: "job-1", SwarmTest: models.SwarmTestRequest{ReviewID: "42"}, Status: models.StatusRunning},
+		{HordeJobID: "job-2", SwarmTest: models.SwarmTestRequest{ReviewID: "42"}, Status: models.StatusPending},
+		{HordeJobID: "job-3", SwarmTest: models.SwarmTestRequest{ReviewID: "43"}, Status: models.StatusRunning},
+	} {
+		if err := storage.Store(job.HordeJobID, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := chi.NewRouter()
+	h := &Handler{logger: zerolog.Nop(), jobStorage: storage}
+	router.Get("/jobs", h.handleListJobs)
+	router.Get("/jobs/{id}", h.handleGetJob)
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantJobs   []string
+		wantNext   bool
+	}{
+		{name: "single job", target: "/jobs/job-3", wantStatus: http.StatusOK},
+		{name: "untracked job", target: "/jobs/job-4", wantStatus: http.StatusNotFound},
+		{name: "by review", target: "/jobs?review_id=42&order=asc", wantStatus: http.StatusOK, wantJobs: []string{"job-1", "job-2"}},
+		{name: "first page", target: "/jobs?status=running&limit=1&order=asc", wantStatus: http.StatusOK, wantJobs: []string{"job-1"}, wantNext: true},
+		{name: "invalid status", target: "/jobs?status=done", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if (rec.Header().Get("X-Next-Cursor") != "") != tt.wantNext {
+				t.Errorf("X-Next-Cursor = %q, want set %v", rec.Header().Get("X-Next-Cursor"), tt.wantNext)
+			}
+			if tt.wantJobs == nil {
+				return
+			}
+			var jobs []models.JobMapping
+			if err := json.NewDecoder(rec.Body).Decode(&jobs); err != nil {
+				t.Fatalf("decoding jobs: %v", err)
+			}
+			var got []string
+			for _, job := range jobs {
+				got = append(got, job.HordeJobID)
+			}
+			if !reflect.DeepEqual(got, tt.wantJobs) {
+				t.Errorf("jobs = %v, want %v", got, tt.wantJobs)
+			}
+		})
+	}
+}
+
+func TestHandleCancelJob(t *testing.T) {
+	hordeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer hordeServer.Close()
+	swarmServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer swarmServer.Close()
+
+	cfg := &config.Config{
+		Horde: config.HordeConfig{Host: hordeServer.URL, APIKey: "test-key"},
+		Retry: config.RetryConfig{MaxAttempts: 1},
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "running job", target: "/jobs/job-1", wantStatus: http.StatusOK, wantBody: `"status":"canceled"`},
+		{name: "finished job", target: "/jobs/job-2", wantStatus: http.StatusConflict},
+		{name: "untracked job", target: "/jobs/job-3", wantStatus: http.StatusNotFound},
+		{name: "by review", target: "/jobs?review_id=42", wantStatus: http.StatusOK, wantBody: `[{"job_id":"job-1"}]`},
+		{name: "no filter", target: "/jobs", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := services.NewMemoryJobStorage()
+			for _, job := range []*models.JobMapping{
+				{HordeJobID: "job-1", SwarmTest: models.SwarmTestRequest{ReviewID: "42", UpdateURL: swarmServer.URL}, Status: models.StatusRunning},
+				{HordeJobID: "job-2", SwarmTest: models.SwarmTestRequest{ReviewID: "42", UpdateURL: swarmServer.URL}, Status: models.StatusFailed},
+			} {
+				if err := storage.Store(job.HordeJobID, job); err != nil {
+					t.Fatal(err)
+				}
+			}
+			hordeService := services.NewHordeService(cfg, zerolog.Nop())
+			swarm := services.NewSwarmService(cfg, zerolog.Nop())
+
+			router := chi.NewRouter()
+			h := &Handler{
+				logger:     zerolog.Nop(),
+				jobStorage: storage,
+				canceller:  services.NewCanceller(cfg, zerolog.Nop(), hordeService, swarm, storage, services.NewMemoryIntakeQueue()),
+			}
+			router.Delete("/jobs", h.handleCancelJobs)
+			router.Delete("/jobs/{id}", h.handleCancelJob)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, tt.target, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSetupRoutesRequireAPIToken(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{APIToken: "secret"}}
+	logger := zerolog.Nop()
+	storage := services.NewMemoryJobStorage()
+	intake := services.NewMemoryIntakeQueue()
+	queue := services.NewSwarmQueue(cfg, logger, services.NewSwarmService(cfg, logger), services.NewMemorySwarmOutbox(cfg.GetOutboxDeliveredRetention()))
+	dispatcher, err := services.NewJobDispatcher(cfg, logger, services.NewHordeService(cfg, logger), queue, storage, intake)
+	if err != nil {
+		t.Fatalf("NewJobDispatcher() error = %v", err)
+	}
+	router := chi.NewRouter()
+	if err := SetupRoutes(router, cfg, logger, services.NewHordeService(cfg, logger), dispatcher, queue, storage, intake, &fakeNotifier{}); err != nil {
+		t.Fatalf("SetupRoutes() error = %v", err)
+	}
+
+	// Every endpoint returning Swarm's update URLs needs the token
+	for _, target := range []string{"/jobs", "/jobs/job-1", "/intake", "/swarm/dead-letters"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s without token = %d, want %d", target, rec.Code, http.StatusUnauthorized)
+		}
+
+		rec = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		router.ServeHTTP(rec, req)
+		if rec.Code == http.StatusUnauthorized {
+			t.Errorf("GET %s with token = %d, want it authorized", target, rec.Code)
+		}
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/retry"
 )
 
 // Client handles communication with the Horde API
@@ -77,7 +80,7 @@ func (c *Client) CreateJob(ctx context.Context, req CreateJobRequest) (string, e
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return "", retry.HTTPStatus(resp.StatusCode, resp.Header, newAPIError(resp))
 	}
 
 	var jobResp CreateJobResponse
@@ -90,28 +93,114 @@ func (c *Client) CreateJob(ctx context.Context, req CreateJobRequest) (string, e
 
 // GetJobStatus retrieves the current status of a job
 func (c *Client) GetJobStatus(ctx context.Context, jobID string) (GetJobResponse, error) {
-	url := fmt.Sprintf("%s/api/v1/jobs/%s", c.baseURL, jobID)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	var jobResp GetJobResponse
+	if err := c.get(ctx, fmt.Sprintf("/api/v1/jobs/%s", jobID), &jobResp); err != nil {
+		return GetJobResponse{}, err
+	}
+	return jobResp, nil
+}
+
+// GetJobGraph retrieves the graph of a job, naming its steps and agent types
+func (c *Client) GetJobGraph(ctx context.Context, jobID string) (GetGraphResponse, error) {
+	var graph GetGraphResponse
+	if err := c.get(ctx, fmt.Sprintf("/api/v1/jobs/%s/graph", jobID), &graph); err != nil {
+		return GetGraphResponse{}, err
+	}
+	return graph, nil
+}
+
+// GetStep retrieves the details of a single step of a job
+func (c *Client) GetStep(ctx context.Context, jobID, batchID, stepID string) (Step, error) {
+	var step Step
+	if err := c.get(ctx, fmt.Sprintf("/api/v1/jobs/%s/batches/%s/steps/%s", jobID, batchID, stepID), &step); err != nil {
+		return Step{}, err
+	}
+	return step, nil
+}
+
+// GetLogEvents retrieves the errors and warnings Horde detected in a log
+func (c *Client) GetLogEvents(ctx context.Context, logID string) ([]LogEvent, error) {
+	var events []LogEvent
+	if err := c.get(ctx, fmt.Sprintf("/api/v1/logs/%s/events", logID), &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetLogLines retrieves count lines of a log starting at index
+func (c *Client) GetLogLines(ctx context.Context, logID string, index, count int) (GetLogLinesResponse, error) {
+	var lines GetLogLinesResponse
+	path := fmt.Sprintf("/api/v1/logs/%s/lines?index=%d&count=%d", logID, index, count)
+	if err := c.get(ctx, path, &lines); err != nil {
+		return GetLogLinesResponse{}, err
+	}
+	return lines, nil
+}
+
+// FindJobArtifacts retrieves the artifacts published by a job
+func (c *Client) FindJobArtifacts(ctx context.Context, jobID string) ([]Artifact, error) {
+	var resp FindArtifactsResponse
+	path := "/api/v2/artifacts?key=" + url.QueryEscape(JobArtifactKey(jobID))
+	if err := c.get(ctx, path, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Artifacts, nil
+}
+
+// get sends a GET request for path and decodes the JSON response into out
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
 	if err != nil {
-		return GetJobResponse{}, fmt.Errorf("creating request: %w", err)
+		return fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("ServiceAccount %s", c.apiKey))
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return GetJobResponse{}, fmt.Errorf("sending request: %w", err)
+		return fmt.Errorf("sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return GetJobResponse{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return retry.HTTPStatus(resp.StatusCode, resp.Header, newAPIError(resp))
 	}
 
-	var jobResp GetJobResponse
-	if err := json.NewDecoder(resp.Body).Decode(&jobResp); err != nil {
-		return GetJobResponse{}, fmt.Errorf("decoding response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
 	}
+	return nil
+}
 
-	return jobResp, nil
+// AbortJob cancels a running job, recording the reason in Horde
+func (c *Client) AbortJob(ctx context.Context, jobID string, reason string) error {
+	aborted := true
+	body, err := json.Marshal(UpdateJobRequest{
+		Aborted:            &aborted,
+		CancellationReason: reason,
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/v1/jobs/%s", c.baseURL, jobID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("ServiceAccount %s", c.apiKey))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return retry.HTTPStatus(resp.StatusCode, resp.Header, newAPIError(resp))
+	}
+
+	return nil
 }
@@ -0,0 +1,76 @@
+package horde
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestClientGetJobGraphAndStep(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "ServiceAccount key" {
+			t.Errorf("Authorization = %q, want service account key", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Path {
+		case "/api/v1/jobs/job-1/graph":
+			_, _ = w.Write([]byte(`{"hash":"g1","groups":[{"agentType":"Win64","priority":"Normal","nodes":[{"name":"Setup"},{"name":"Compile Editor","inputDependencies":["Setup"]}]}],"labels":[{"dashboardName":"Editor","includedNodes":["Compile Editor"]}]}`))
+		case "/api/v1/jobs/job-1/batches/b1/steps/s2":
+			_, _ = w.Write([]byte(`{"id":"s2","nodeIdx":1,"state":"Completed","outcome":"Failure","logId":"log-2","startTime":"2024-01-01T10:00:00Z","finishTime":"2024-01-01T10:05:00Z"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "key", zerolog.Nop())
+
+	graph, err := client.GetJobGraph(context.Background(), "job-1")
+	if err != nil {
+		t.Fatalf("GetJobGraph() error = %v", err)
+	}
+	if node, ok := graph.Node(0, 1); !ok || node.Name != "Compile Editor" || len(node.InputDependencies) != 1 {
+		t.Errorf("graph.Node(0, 1) = %+v, %v, want Compile Editor depending on Setup", node, ok)
+	}
+	if len(graph.Labels) != 1 || graph.Labels[0].DashboardName != "Editor" {
+		t.Errorf("graph labels = %+v, want Editor", graph.Labels)
+	}
+
+	step, err := client.GetStep(context.Background(), "job-1", "b1", "s2")
+	if err != nil {
+		t.Fatalf("GetStep() error = %v", err)
+	}
+	if duration, ok := step.Duration(); !ok || duration != 5*time.Minute || step.NodeIdx != 1 {
+		t.Errorf("GetStep() = %+v, want node 1 running 5m", step)
+	}
+
+	if _, err := client.GetStep(context.Background(), "job-1", "b1", "missing"); !IsNotFound(err) {
+		t.Errorf("GetStep() error = %v, want not found", err)
+	}
+}
+
+func TestNameSteps(t *testing.T) {
+	var job GetJobResponse
+	if err := json.Unmarshal([]byte(`{"id":"job-1","state":"Complete","batches":[
+		{"id":"b1","groupIdx":1,"state":"Complete","error":"None","steps":[{"id":"s1","nodeIdx":0},{"id":"s2","nodeIdx":5}]},
+		{"id":"b2","groupIdx":0,"agentType":"Linux","steps":[{"id":"s3","nodeIdx":0,"name":"Named"}]}
+	]}`), &job); err != nil {
+		t.Fatalf("decoding job: %v", err)
+	}
+
+	job.NameSteps(GetGraphResponse{Groups: []Group{
+		{AgentType: "Win64", Nodes: []Node{{Name: "Setup"}}},
+		{AgentType: "Mac", Nodes: []Node{{Name: "Cook"}}},
+	}})
+
+	if b := job.Batches[0]; b.AgentType != "Mac" || b.Steps[0].Name != "Cook" || b.Steps[1].Name != "" {
+		t.Errorf("batch b1 = %+v, want agent type Mac, step s1 named Cook and s2 unnamed", b)
+	}
+	if b := job.Batches[1]; b.AgentType != "Linux" || b.Steps[0].Name != "Named" {
+		t.Errorf("batch b2 = %+v, want reported agent type and name kept", b)
+	}
+}
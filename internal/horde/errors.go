@@ -0,0 +1,129 @@
+package horde
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// maxErrorBody bounds how much of an error response is read, and
+// maxErrorMessage how much of a body that is not JSON is kept as the message
+const (
+	maxErrorBody    = 64 << 10
+	maxErrorMessage = 512
+)
+
+// APIError is returned when Horde answers a request with an error status
+type APIError struct {
+	StatusCode int    `json:"status"`
+	Method     string `json:"method"`
+	Endpoint   string `json:"endpoint"`
+	// RequestID identifies the request in Horde's logs, when Horde reports one
+	RequestID string `json:"request_id,omitempty"`
+	// Message is Horde's description of the error, or the raw response body
+	Message string `json:"message,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("horde %s %s: %d %s", e.Method, e.Endpoint, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// MarshalZerologObject adds the error details to a log event
+func (e *APIError) MarshalZerologObject(event *zerolog.Event) {
+	event.Int("status", e.StatusCode).
+		Str("method", e.Method).
+		Str("endpoint", e.Endpoint).
+		Str("request_id", e.RequestID).
+		Str("message", e.Message)
+}
+
+// errorBody covers the error responses of Horde: its own log event format and
+// ASP.NET problem details
+type errorBody struct {
+	Message string `json:"message"`
+	Title   string `json:"title"`
+	Detail  string `json:"detail"`
+	TraceID string `json:"traceId"`
+}
+
+// newAPIError builds an APIError from an error response, reading its body
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     resp.Request.Method,
+		Endpoint:   resp.Request.URL.Path,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil || len(data) == 0 {
+		return apiErr
+	}
+
+	var body errorBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		apiErr.Message = strings.TrimSpace(string(data))
+		if len(apiErr.Message) > maxErrorMessage {
+			apiErr.Message = apiErr.Message[:maxErrorMessage] + "..."
+		}
+		return apiErr
+	}
+	switch {
+	case body.Message != "":
+		apiErr.Message = body.Message
+	case body.Detail != "":
+		apiErr.Message = body.Detail
+	default:
+		apiErr.Message = body.Title
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = body.TraceID
+	}
+	return apiErr
+}
+
+// LogAPIError adds the details of err to a log event if it is an APIError
+func LogAPIError(event *zerolog.Event, err error) *zerolog.Event {
+	if apiErr, ok := AsAPIError(err); ok {
+		return event.Object("horde_error", apiErr)
+	}
+	return event
+}
+
+// AsAPIError returns the APIError in err's chain, if any
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+// IsNotFound reports whether err is Horde answering 404 Not Found
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized reports whether err is Horde rejecting the API key as invalid
+// or expired (401). A 403 is not included: the key is valid but lacks
+// permission for that request, e.g. on one stream or template.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+func hasStatus(err error, status int) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.StatusCode == status
+}
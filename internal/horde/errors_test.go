@@ -0,0 +1,95 @@
+package horde
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/retry"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		header        map[string]string
+		body          string
+		wantMessage   string
+		wantRequestID string
+		wantNotFound  bool
+		wantUnauth    bool
+		wantPermanent bool
+	}{
+		{
+			name:          "horde log event",
+			status:        http.StatusNotFound,
+			header:        map[string]string{"X-Request-Id": "req-1"},
+			body:          `{"level":"Error","message":"Template tmpl-1 not found"}`,
+			wantMessage:   "Template tmpl-1 not found",
+			wantRequestID: "req-1",
+			wantNotFound:  true,
+			wantPermanent: true,
+		},
+		{
+			name:          "problem details",
+			status:        http.StatusUnauthorized,
+			body:          `{"title":"Unauthorized","detail":"Token expired","traceId":"trace-1"}`,
+			wantMessage:   "Token expired",
+			wantRequestID: "trace-1",
+			wantUnauth:    true,
+			wantPermanent: true,
+		},
+		{
+			name:        "plain text body",
+			status:      http.StatusBadGateway,
+			body:        "upstream unavailable\n",
+			wantMessage: "upstream unavailable",
+		},
+		{
+			name:   "empty body",
+			status: http.StatusForbidden,
+			// Forbidden only concerns the request, the API key itself is valid
+			wantPermanent: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "key", zerolog.Nop())
+			_, err := client.GetJobStatus(context.Background(), "job-1")
+
+			apiErr, ok := AsAPIError(err)
+			if !ok {
+				t.Fatalf("GetJobStatus() error = %v, want APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Method != http.MethodGet || apiErr.Endpoint != "/api/v1/jobs/job-1" {
+				t.Errorf("APIError = %+v, want status %d for GET /api/v1/jobs/job-1", apiErr, tt.status)
+			}
+			if apiErr.Message != tt.wantMessage || apiErr.RequestID != tt.wantRequestID {
+				t.Errorf("APIError message, request ID = %q, %q, want %q, %q", apiErr.Message, apiErr.RequestID, tt.wantMessage, tt.wantRequestID)
+			}
+			if IsNotFound(err) != tt.wantNotFound || IsUnauthorized(err) != tt.wantUnauth {
+				t.Errorf("IsNotFound, IsUnauthorized = %v, %v, want %v, %v", IsNotFound(err), IsUnauthorized(err), tt.wantNotFound, tt.wantUnauth)
+			}
+			if retry.IsPermanent(err) != tt.wantPermanent {
+				t.Errorf("IsPermanent() = %v, want %v", retry.IsPermanent(err), tt.wantPermanent)
+			}
+			if tt.wantMessage != "" && !strings.Contains(err.Error(), tt.wantMessage) {
+				t.Errorf("Error() = %q, want it to contain %q", err.Error(), tt.wantMessage)
+			}
+		})
+	}
+}
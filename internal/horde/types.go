@@ -1,29 +1,90 @@
 // Package horde provides types and services for interacting with the Horde CI system
 package horde
 
-// Common status and outcome types for Horde jobs
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Job states
 const (
-	// Job states
+	StateWaiting  = "Waiting"
+	StateRunning  = "Running"
+	StateComplete = "Complete"
+
+	// Alternative spellings accepted from older Horde releases and proxies
 	StateInitializing = "Initializing"
 	StateQueued       = "Queued"
-	StateRunning      = "Running"
 	StateFinished     = "Finished"
 	StateFailed       = "Failed"
 	StateCanceled     = "Canceled"
+)
+
+// Batch states
+const (
+	BatchStateWaiting  = "Waiting"
+	BatchStateReady    = "Ready"
+	BatchStateStarting = "Starting"
+	BatchStateRunning  = "Running"
+	BatchStateStopping = "Stopping"
+	BatchStateComplete = "Complete"
+)
+
+// Batch errors
+const (
+	BatchErrorNone             = "None"
+	BatchErrorUnknownAgentType = "UnknownAgentType"
+	BatchErrorUnknownPool      = "UnknownPool"
+	BatchErrorNoAgentsInPool   = "NoAgentsInPool"
+	BatchErrorNoAgentsOnline   = "NoAgentsOnline"
+	BatchErrorUnknownWorkspace = "UnknownWorkspace"
+	BatchErrorCancelled        = "Cancelled"
+	BatchErrorLostConnection   = "LostConnection"
+	BatchErrorIncomplete       = "Incomplete"
+	BatchErrorExecutionError   = "ExecutionError"
+	BatchErrorNoLongerNeeded   = "NoLongerNeeded"
+	BatchErrorSyncingFailed    = "SyncingFailed"
+)
+
+// Step states
+const (
+	StepStateUnspecified = "Unspecified"
+	StepStateWaiting     = "Waiting"
+	StepStateReady       = "Ready"
+	StepStateSkipped     = "Skipped"
+	StepStateRunning     = "Running"
+	StepStateCompleted   = "Completed"
+	StepStateAborted     = "Aborted"
+)
+
+// Step outcomes
+const (
+	OutcomeUnspecified = "Unspecified"
+	OutcomeFailure     = "Failure"
+	OutcomeWarnings    = "Warnings"
+	OutcomeSuccess     = "Success"
 
-	// Job outcomes
+	// Alternative spellings accepted from older Horde releases and proxies
 	OutcomeSucceeded = "Succeeded"
 	OutcomeFailed    = "Failed"
 	OutcomeCanceled  = "Canceled"
 )
 
+// Log event severities
+const (
+	SeverityWarning = "Warning"
+	SeverityError   = "Error"
+)
+
 // CreateJobRequest represents a job creation request to Horde
 type CreateJobRequest struct {
-	StreamId        string `json:"streamId"`
-	TemplateId      string `json:"templateId"`
-	Name            string `json:"name"`
-	PreflightChange string `json:"preflightChange"`
-	AutoSubmit      bool   `json:"autoSubmit"`
+	StreamId        string   `json:"streamId"`
+	TemplateId      string   `json:"templateId"`
+	Name            string   `json:"name"`
+	PreflightChange string   `json:"preflightChange"`
+	AutoSubmit      bool     `json:"autoSubmit"`
+	Arguments       []string `json:"arguments,omitempty"`
 }
 
 // CreateJobResponse represents a job creation response from Horde
@@ -32,22 +93,246 @@ type CreateJobResponse struct {
 	State string `json:"state"`
 }
 
-// GetJobResponse represents a job status response from Horde
+// UpdateJobRequest represents a job update request to Horde
+type UpdateJobRequest struct {
+	Aborted            *bool  `json:"aborted,omitempty"`
+	CancellationReason string `json:"cancellationReason,omitempty"`
+}
+
+// GetJobResponse represents a job as returned by Horde
 type GetJobResponse struct {
-	ID              string  `json:"id"`
-	State           string  `json:"state"`
-	AbortedByUserId *string `json:"abortedByUser"`
-	Batches         []Batch `json:"batches"`
+	ID              string `json:"id"`
+	StreamId        string `json:"streamId,omitempty"`
+	TemplateId      string `json:"templateId,omitempty"`
+	Name            string `json:"name,omitempty"`
+	Change          int    `json:"change,omitempty"`
+	PreflightChange int    `json:"preflightChange,omitempty"`
+	State           string `json:"state"`
+	// GraphHash identifies the graph of the job, see Client.GetJobGraph
+	GraphHash         string    `json:"graphHash,omitempty"`
+	StartedByUserInfo *UserInfo `json:"startedByUserInfo,omitempty"`
+	// AbortedByUserId is the name of the user who aborted the job, as reported
+	// by older Horde releases; newer ones also set AbortedByUserInfo
+	AbortedByUserId    *string      `json:"abortedByUser"`
+	AbortedByUserInfo  *UserInfo    `json:"abortedByUserInfo,omitempty"`
+	CancellationReason string       `json:"cancellationReason,omitempty"`
+	Arguments          []string     `json:"arguments,omitempty"`
+	CreateTime         *time.Time   `json:"createTime,omitempty"`
+	UpdateTime         *time.Time   `json:"updateTime,omitempty"`
+	Batches            []Batch      `json:"batches"`
+	Labels             []LabelState `json:"labels,omitempty"`
+}
+
+// UserInfo identifies a Horde user
+type UserInfo struct {
+	Id    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
 }
 
+// LabelState is the state of a label of the job graph, in the order of the
+// graph's labels
+type LabelState struct {
+	State   string `json:"state,omitempty"`
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// Batch represents a group of steps executed on a single agent
 type Batch struct {
+	Id    string `json:"id"`
+	State string `json:"state"`
 	Error string `json:"error"`
-	Steps []Step `json:"steps"`
+	// GroupIdx is the index of the graph group the batch runs
+	GroupIdx int `json:"groupIdx"`
+	// AgentType is the agent type, and thereby pool, the batch runs on
+	AgentType  string     `json:"agentType,omitempty"`
+	AgentId    string     `json:"agentId,omitempty"`
+	LogId      string     `json:"logId,omitempty"`
+	ReadyTime  *time.Time `json:"readyTime,omitempty"`
+	StartTime  *time.Time `json:"startTime,omitempty"`
+	FinishTime *time.Time `json:"finishTime,omitempty"`
+	Steps      []Step     `json:"steps"`
 }
 
+// Step represents a single node of the job graph executed within a batch
 type Step struct {
-	AbortedByUserId *string `json:"abortedByUserId"`
-	State           string  `json:"state"`
-	Outcome         string  `json:"outcome"`
-	Error           string  `json:"error"`
+	Id string `json:"id"`
+	// NodeIdx is the index of the step's node within the batch's graph group
+	NodeIdx int `json:"nodeIdx"`
+	// Name is not reported by Horde for every step; see GetJobResponse.NameSteps
+	Name              string     `json:"name,omitempty"`
+	AbortedByUserId   *string    `json:"abortedByUserId"`
+	AbortedByUserInfo *UserInfo  `json:"abortedByUserInfo,omitempty"`
+	AbortRequested    bool       `json:"abortRequested,omitempty"`
+	RetriedByUserInfo *UserInfo  `json:"retriedByUserInfo,omitempty"`
+	State             string     `json:"state"`
+	Outcome           string     `json:"outcome"`
+	Error             string     `json:"error"`
+	LogId             string     `json:"logId,omitempty"`
+	ReadyTime         *time.Time `json:"readyTime,omitempty"`
+	StartTime         *time.Time `json:"startTime,omitempty"`
+	FinishTime        *time.Time `json:"finishTime,omitempty"`
+}
+
+// Duration returns how long the step ran, if it has started and finished
+func (s Step) Duration() (time.Duration, bool) {
+	if s.StartTime == nil || s.FinishTime == nil {
+		return 0, false
+	}
+	return s.FinishTime.Sub(*s.StartTime), true
+}
+
+// GetGraphResponse represents the graph of a job: the groups of nodes run on
+// an agent each, the aggregates and the labels shown in Horde's dashboard
+type GetGraphResponse struct {
+	Hash       string      `json:"hash"`
+	Groups     []Group     `json:"groups"`
+	Aggregates []Aggregate `json:"aggregates,omitempty"`
+	Labels     []Label     `json:"labels,omitempty"`
+}
+
+// Group is a set of nodes executed together on an agent of one type
+type Group struct {
+	AgentType string `json:"agentType"`
+	Priority  string `json:"priority,omitempty"`
+	Nodes     []Node `json:"nodes"`
+}
+
+// Node is a single node of the graph, executed as a step of a batch
+type Node struct {
+	Name              string            `json:"name"`
+	InputDependencies []string          `json:"inputDependencies,omitempty"`
+	OrderDependencies []string          `json:"orderDependencies,omitempty"`
+	Priority          string            `json:"priority,omitempty"`
+	AllowRetry        bool              `json:"allowRetry,omitempty"`
+	RunEarly          bool              `json:"runEarly,omitempty"`
+	Warnings          *bool             `json:"warnings,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+}
+
+// Aggregate is a named set of nodes
+type Aggregate struct {
+	Name  string   `json:"name"`
+	Nodes []string `json:"nodes"`
+}
+
+// Label groups nodes under a name in Horde's dashboard and in UGS
+type Label struct {
+	DashboardName     string   `json:"dashboardName,omitempty"`
+	DashboardCategory string   `json:"dashboardCategory,omitempty"`
+	UgsName           string   `json:"ugsName,omitempty"`
+	UgsProject        string   `json:"ugsProject,omitempty"`
+	RequiredNodes     []string `json:"requiredNodes,omitempty"`
+	IncludedNodes     []string `json:"includedNodes,omitempty"`
+}
+
+// Node returns the graph node run by a step of a batch
+func (g GetGraphResponse) Node(groupIdx, nodeIdx int) (Node, bool) {
+	if groupIdx < 0 || groupIdx >= len(g.Groups) {
+		return Node{}, false
+	}
+	nodes := g.Groups[groupIdx].Nodes
+	if nodeIdx < 0 || nodeIdx >= len(nodes) {
+		return Node{}, false
+	}
+	return nodes[nodeIdx], true
+}
+
+// NameSteps fills in the names of steps, and the agent types of batches, that
+// Horde did not report from the job's graph
+func (j *GetJobResponse) NameSteps(graph GetGraphResponse) {
+	for i := range j.Batches {
+		batch := &j.Batches[i]
+		if batch.AgentType == "" && batch.GroupIdx >= 0 && batch.GroupIdx < len(graph.Groups) {
+			batch.AgentType = graph.Groups[batch.GroupIdx].AgentType
+		}
+		for k := range batch.Steps {
+			step := &batch.Steps[k]
+			if step.Name != "" {
+				continue
+			}
+			if node, ok := graph.Node(batch.GroupIdx, step.NodeIdx); ok {
+				step.Name = node.Name
+			}
+		}
+	}
+}
+
+// StartTime returns when the first batch of the job started, if any has
+func (j *GetJobResponse) StartTime() *time.Time {
+	var start *time.Time
+	for _, batch := range j.Batches {
+		if batch.StartTime != nil && (start == nil || batch.StartTime.Before(*start)) {
+			start = batch.StartTime
+		}
+	}
+	return start
+}
+
+// FinishTime returns when the last batch of the job finished, if any has
+func (j *GetJobResponse) FinishTime() *time.Time {
+	var finish *time.Time
+	for _, batch := range j.Batches {
+		if batch.FinishTime != nil && (finish == nil || batch.FinishTime.After(*finish)) {
+			finish = batch.FinishTime
+		}
+	}
+	return finish
+}
+
+// LogEvent is an error or warning Horde detected in a log, covering LineCount
+// lines from LineIndex
+type LogEvent struct {
+	Time      time.Time `json:"time"`
+	Severity  string    `json:"severity"`
+	LogId     string    `json:"logId"`
+	LineIndex int       `json:"lineIndex"`
+	LineCount int       `json:"lineCount"`
+	IssueId   *int      `json:"issueId,omitempty"`
+	// Lines holds the lines of the event; older Horde releases leave it empty
+	Lines []LogLine `json:"lines,omitempty"`
+}
+
+// LogLine is a single structured line of a log
+type LogLine struct {
+	Time    *time.Time `json:"time,omitempty"`
+	Level   string     `json:"level,omitempty"`
+	Message string     `json:"message"`
+}
+
+// GetLogLinesResponse represents a range of lines of a log
+type GetLogLinesResponse struct {
+	Index        int       `json:"index"`
+	Count        int       `json:"count"`
+	MaxLineIndex int       `json:"maxLineIndex"`
+	Lines        []LogLine `json:"lines"`
+}
+
+// FindArtifactsResponse lists the artifacts matching a query
+type FindArtifactsResponse struct {
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Artifact is a set of files published by a job, such as a packaged build or
+// test reports
+type Artifact struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	StreamId    string `json:"streamId,omitempty"`
+	// Keys identify the job and step that published the artifact, e.g.
+	// "job:{jobId}/step:{stepId}"
+	Keys     []string `json:"keys,omitempty"`
+	Metadata []string `json:"metadata,omitempty"`
+}
+
+// JobArtifactKey is the artifact key shared by all artifacts of a job
+func JobArtifactKey(jobID string) string {
+	return "job:" + jobID
+}
+
+// ArtifactDownloadPath is the path of the zip download of an artifact
+func ArtifactDownloadPath(artifactID string) string {
+	return fmt.Sprintf("/api/v2/artifacts/%s/zip", url.PathEscape(artifactID))
 }
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+// JobLister is the part of the job storage needed to report tracked jobs
+type JobLister interface {
+	List() ([]*models.JobMapping, error)
+}
+
+// JobsCollector reports the number of tracked jobs per status, read from
+// storage at scrape time so the gauges always match what is persisted
+type JobsCollector struct {
+	jobs       JobLister
+	tracked    *prometheus.Desc
+	listErrors prometheus.Counter
+}
+
+// NewJobsCollector creates a collector reporting the jobs held in storage
+func NewJobsCollector(jobs JobLister) *JobsCollector {
+	return &JobsCollector{
+		jobs: jobs,
+		tracked: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "jobs_tracked"),
+			"Number of jobs currently tracked in storage, by status.",
+			[]string{"status"}, nil,
+		),
+		listErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_tracked_scrape_errors_total",
+			Help:      "Total number of failures reading job storage while collecting metrics.",
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *JobsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.tracked
+	c.listErrors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *JobsCollector) Collect(ch chan<- prometheus.Metric) {
+	defer c.listErrors.Collect(ch)
+
+	jobs, err := c.jobs.List()
+	if err != nil {
+		c.listErrors.Inc()
+		return
+	}
+
+	counts := make(map[models.JobStatus]int, len(models.JobStatuses))
+	for _, status := range models.JobStatuses {
+		counts[status] = 0
+	}
+	for _, job := range jobs {
+		counts[job.Status]++
+	}
+
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.tracked, prometheus.GaugeValue, float64(count), string(status))
+	}
+}
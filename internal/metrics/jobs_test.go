@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+type fakeLister struct {
+	jobs []*models.JobMapping
+	err  error
+}
+
+func (f fakeLister) List() ([]*models.JobMapping, error) {
+	return f.jobs, f.err
+}
+
+func TestJobsCollector(t *testing.T) {
+	t.Run("counts jobs per status", func(t *testing.T) {
+		collector := NewJobsCollector(fakeLister{jobs: []*models.JobMapping{
+			{HordeJobID: "job-1", Status: models.StatusRunning},
+			{HordeJobID: "job-2", Status: models.StatusRunning},
+			{HordeJobID: "job-3", Status: models.StatusPending},
+		}})
+
+		want := map[models.JobStatus]int{models.StatusRunning: 2, models.StatusPending: 1}
+
+		// Every known status is reported, including those without jobs
+		lines := make([]string, 0, len(models.JobStatuses))
+		for _, status := range models.JobStatuses {
+			lines = append(lines, fmt.Sprintf("swarm_horde_bridge_jobs_tracked{status=%q} %d", status, want[status]))
+		}
+		sort.Strings(lines)
+
+		expected := `
+# HELP swarm_horde_bridge_jobs_tracked Number of jobs currently tracked in storage, by status.
+# TYPE swarm_horde_bridge_jobs_tracked gauge
+` + strings.Join(lines, "\n") + "\n"
+		if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "swarm_horde_bridge_jobs_tracked"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		collector := NewJobsCollector(fakeLister{err: errors.New("boom")})
+
+		expected := `
+# HELP swarm_horde_bridge_jobs_tracked_scrape_errors_total Total number of failures reading job storage while collecting metrics.
+# TYPE swarm_horde_bridge_jobs_tracked_scrape_errors_total counter
+swarm_horde_bridge_jobs_tracked_scrape_errors_total 1
+`
+		if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,207 @@
+// Package metrics provides the Prometheus instrumentation exposed on /metrics
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "swarm_horde_bridge"
+
+// Result label values
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Reasons a job is skipped by a monitor poll
+const (
+	SkipDeadline = "deadline"
+	SkipTimeout  = "timeout"
+	SkipCircuit  = "circuit_open"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts HTTP requests served by the bridge
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Total number of HTTP requests served, by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	// HTTPRequestDuration observes HTTP request latency
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests served, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// WebhooksReceived counts incoming webhook calls
+	WebhooksReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhooks_received_total",
+		Help:      "Total number of webhook calls received, by webhook.",
+	}, []string{"webhook"})
+
+	// WebhooksRejected counts webhook calls that were refused
+	WebhooksRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhooks_rejected_total",
+		Help:      "Total number of webhook calls rejected, by webhook and reason.",
+	}, []string{"webhook", "reason"})
+
+	// WebhooksDeduplicated counts webhook calls answered with an existing job
+	WebhooksDeduplicated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhooks_deduplicated_total",
+		Help:      "Total number of repeated webhook calls answered with an existing job, by webhook.",
+	}, []string{"webhook"})
+
+	// HordeJobsCreated counts Horde jobs successfully created
+	HordeJobsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "horde_jobs_created_total",
+		Help:      "Total number of Horde jobs created.",
+	})
+
+	// HordeJobCreateFailures counts Horde job creations that failed after retries
+	HordeJobCreateFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "horde_job_create_failures_total",
+		Help:      "Total number of Horde job creations that failed.",
+	})
+
+	// IntakePending tracks accepted requests waiting for their Horde job to be created
+	IntakePending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "intake_pending",
+		Help:      "Number of accepted Swarm test requests waiting for a Horde job.",
+	})
+
+	// IntakeExpired counts requests failed after being held longer than the intake max age
+	IntakeExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "intake_expired_total",
+		Help:      "Total number of Swarm test requests failed because no Horde job could be created in time.",
+	})
+
+	// HordeRequestDuration observes the latency of individual Horde API calls
+	HordeRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "horde_request_duration_seconds",
+		Help:      "Latency of Horde API calls, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// RequestRetries counts retried Horde and Swarm API calls
+	RequestRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "request_retries_total",
+		Help:      "Total number of retried API calls, by service and operation.",
+	}, []string{"service", "operation"})
+
+	// HordeCircuitState is 1 for the current state of the Horde circuit breaker
+	HordeCircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "horde_circuit_state",
+		Help:      "Current state of the Horde circuit breaker (1 for the active state).",
+	}, []string{"state"})
+
+	// HordeCallsRejected counts Horde API calls failed fast by the open circuit breaker
+	HordeCallsRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "horde_calls_rejected_total",
+		Help:      "Total number of Horde API calls rejected while the circuit breaker was open.",
+	})
+
+	// SwarmUpdates counts Swarm status updates by result
+	SwarmUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "swarm_updates_total",
+		Help:      "Total number of Swarm status updates, by result.",
+	}, []string{"result"})
+
+	// SwarmRequestDuration observes the latency of individual Swarm API calls
+	SwarmRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "swarm_request_duration_seconds",
+		Help:      "Latency of Swarm API calls, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// SwarmOutboxPending tracks Swarm status updates waiting for delivery
+	SwarmOutboxPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "swarm_outbox_pending",
+		Help:      "Number of Swarm status updates queued for delivery.",
+	})
+
+	// SwarmUpdatesDeadLettered counts Swarm status updates given up after exhausting retries
+	SwarmUpdatesDeadLettered = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "swarm_updates_dead_lettered_total",
+		Help:      "Total number of Swarm status updates moved to the dead-letter list.",
+	})
+
+	// MonitorTickDuration observes how long each job monitor poll takes
+	MonitorTickDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "monitor_tick_duration_seconds",
+		Help:      "Duration of job monitor polls over all tracked jobs.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	})
+
+	// MonitorJobsSkipped counts jobs a monitor poll could not check
+	MonitorJobsSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "monitor_jobs_skipped_total",
+		Help:      "Total number of jobs not checked by a monitor poll, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		WebhooksReceived,
+		WebhooksRejected,
+		WebhooksDeduplicated,
+		HordeJobsCreated,
+		HordeJobCreateFailures,
+		IntakePending,
+		IntakeExpired,
+		HordeRequestDuration,
+		RequestRetries,
+		HordeCircuitState,
+		HordeCallsRejected,
+		SwarmUpdates,
+		SwarmRequestDuration,
+		SwarmOutboxPending,
+		SwarmUpdatesDeadLettered,
+		MonitorTickDuration,
+		MonitorJobsSkipped,
+	)
+}
+
+// Register adds additional collectors to the bridge registry
+func Register(cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := registry.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns the HTTP handler serving the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
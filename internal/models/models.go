@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/swarm"
+)
 
 // HordeJobStatus represents the possible states of a Horde job
 type HordeJobStatus string
@@ -20,31 +25,182 @@ const (
 	StatusPending   JobStatus = "pending"
 	StatusRunning   JobStatus = "running"
 	StatusCompleted JobStatus = "completed"
-	StatusFailed    JobStatus = "failed"
+	// StatusWarnings marks a job that completed successfully but with warnings
+	StatusWarnings JobStatus = "warnings"
+	StatusFailed   JobStatus = "failed"
+	// StatusCanceled marks a job aborted in Horde rather than failing on its own
+	StatusCanceled JobStatus = "canceled"
+	// StatusSuperseded marks a job canceled because a newer run of the same Swarm test started
+	StatusSuperseded JobStatus = "superseded"
 )
 
+// JobStatuses lists every JobStatus the bridge can assign to a job
+var JobStatuses = []JobStatus{
+	StatusUnknown,
+	StatusPending,
+	StatusRunning,
+	StatusCompleted,
+	StatusWarnings,
+	StatusFailed,
+	StatusCanceled,
+	StatusSuperseded,
+}
+
+// IsFinal reports whether the status is terminal and no longer needs monitoring
+func (s JobStatus) IsFinal() bool {
+	switch s {
+	case StatusCompleted, StatusWarnings, StatusFailed, StatusCanceled, StatusSuperseded:
+		return true
+	default:
+		return false
+	}
+}
+
+// SwarmTestRequest is the body Swarm sends to the test webhook. Apart from the
+// changelist and update URL, fields are filled from the Swarm test definition's
+// token-substituted body (e.g. "review_id": "{review}").
 type SwarmTestRequest struct {
 	Changelist string `json:"changelist"`
 	UpdateURL  string `json:"update_url"`
+	ReviewID   string `json:"review_id,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Author     string `json:"author,omitempty"`
+	Project    string `json:"project,omitempty"`
+	Branch     string `json:"branch,omitempty"`
+	Test       string `json:"test,omitempty"`
+	TestRunID  string `json:"test_run_id,omitempty"`
+	DepotPath  string `json:"depot_path,omitempty"`
 }
 
-type SwarmUpdateRequest struct {
-	Status   string   `json:"status"`
-	JobUrl   string   `json:"url"`
-	Messages []string `json:"messages"`
+// JobTarget identifies the Horde stream and template a job is created from
+type JobTarget struct {
+	Route      string `json:"route,omitempty"`
+	StreamId   string `json:"stream_id"`
+	TemplateId string `json:"template_id"`
 }
 
+// Swarm test run statuses
+const (
+	SwarmStatusQueued  = "queued"
+	SwarmStatusRunning = "running"
+	SwarmStatusPass    = "pass"
+	SwarmStatusFail    = "fail"
+)
+
+// SwarmUpdateRequest is the body of a test run status update sent to Swarm
+type SwarmUpdateRequest = swarm.TestRunUpdate
+
 type JobMapping struct {
 	SwarmTest  SwarmTestRequest `json:"swarm_test"`
 	HordeJobID string           `json:"horde_job_id"`
+	Target     JobTarget        `json:"target"`
 	Status     JobStatus        `json:"status"`
-	CreatedAt  time.Time        `json:"created_at"`
-	UpdatedAt  time.Time        `json:"updated_at"`
+	// RequestID is the intake request the job was created for
+	RequestID string `json:"request_id,omitempty"`
+	// IdempotencyKey is the Idempotency-Key header of the webhook call that started the job
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// SupersededBy is the Horde job ID of the newer run that replaced this job
+	SupersededBy string `json:"superseded_by,omitempty"`
+	// CommentPending marks a finished job whose review comment could not be
+	// posted yet; CommentMessages holds the summary to post on the next try
+	CommentPending  bool      `json:"comment_pending,omitempty"`
+	CommentMessages []string  `json:"comment_messages,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// IntakeRequest is an accepted Swarm test request waiting for its Horde job to be created
+type IntakeRequest struct {
+	ID             string           `json:"id"`
+	SwarmTest      SwarmTestRequest `json:"swarm_test"`
+	Target         JobTarget        `json:"target"`
+	IdempotencyKey string           `json:"idempotency_key,omitempty"`
+	// Attempts counts failed job creations; LastError is the most recent failure,
+	// with HordeError holding its details when Horde answered with an error
+	Attempts   int             `json:"attempts"`
+	LastError  string          `json:"last_error,omitempty"`
+	HordeError *horde.APIError `json:"horde_error,omitempty"`
+	// Held is set once Swarm has been told the request waits for Horde to recover
+	Held       bool      `json:"held,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// SwarmTestResponse is returned by the test webhook. RequestID identifies the
+// queued request; JobID is set once its Horde job exists.
+type SwarmTestResponse struct {
+	RequestID string `json:"request_id,omitempty"`
+	JobID     string `json:"job_id,omitempty"`
+	// Duplicate is set when the call repeated an earlier one and no new job was started
+	Duplicate bool `json:"duplicate,omitempty"`
+	// LastError and HordeError explain why a queued request has no job yet
+	LastError  string          `json:"last_error,omitempty"`
+	HordeError *horde.APIError `json:"horde_error,omitempty"`
+}
+
+// TestRunStatus is a status change of a Swarm test run. It is sent through
+// the Swarm API when the review and test run IDs are known, and to the update
+// URL otherwise.
+type TestRunStatus struct {
+	UpdateURL string `json:"update_url"`
+	// RequestID is the intake request the update reports on; reruns reusing
+	// the update URL come with a new request
+	RequestID string   `json:"request_id,omitempty"`
+	ReviewID  string   `json:"review_id,omitempty"`
+	TestRunID string   `json:"test_run_id,omitempty"`
+	JobID     string   `json:"job_id"`
+	Status    string   `json:"status"`
+	Messages  []string `json:"messages"`
+	// StartTime is when the Horde job started running, CompletedTime when it finished
+	StartTime     *time.Time `json:"start_time,omitempty"`
+	CompletedTime *time.Time `json:"completed_time,omitempty"`
+}
+
+// TestRunStatus returns a status change of the request's test run, reported
+// for the intake request requestID
+func (r SwarmTestRequest) TestRunStatus(requestID, status string, messages []string, jobID string) TestRunStatus {
+	return TestRunStatus{
+		UpdateURL: r.UpdateURL,
+		RequestID: requestID,
+		ReviewID:  r.ReviewID,
+		TestRunID: r.TestRunID,
+		JobID:     jobID,
+		Status:    status,
+		Messages:  messages,
+	}
+}
+
+// SwarmUpdate is a test run status update queued for delivery to Swarm
+type SwarmUpdate struct {
+	// ID identifies this update; a newer update for the same test run gets a new ID
+	ID string `json:"id"`
+	TestRunStatus
+	// Attempts counts failed deliveries; NextAttempt is when delivery is retried
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// IsFinal reports whether the update carries a test run's final result
+func (u *SwarmUpdate) IsFinal() bool {
+	return u.Status == SwarmStatusPass || u.Status == SwarmStatusFail
+}
+
+// HordeJobNotification is the body of a Horde job state change notification.
+// Horde templates and notification hooks name the job ID differently, so all
+// common spellings are accepted.
+type HordeJobNotification struct {
+	JobId      string `json:"jobId"`
+	JobIdSnake string `json:"job_id"`
+	Id         string `json:"id"`
 }
 
-// HordeCreateJobRequest represents a job creation request to Horde
-type HordeCreateJobRequest struct {
-	Template string            `json:"template"`
-	Change   string            `json:"change"`
-	Params   map[string]string `json:"params,omitempty"`
+// JobID returns the notified job ID
+func (n HordeJobNotification) JobID() string {
+	for _, id := range []string{n.JobId, n.JobIdSnake, n.Id} {
+		if id != "" {
+			return id
+		}
+	}
+	return ""
 }
@@ -2,39 +2,70 @@ package monitor
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/metrics"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/services"
 )
 
+// notifyQueueSize bounds pending job notifications; overflow is picked up by polling
+const notifyQueueSize = 256
+
 type JobMonitor struct {
 	config     *config.Config
 	logger     zerolog.Logger
 	hordeServ  *services.HordeService
-	swarmServ  *services.SwarmService
-	jobStorage *services.JobStorage
+	swarmServ  services.StatusUpdater
+	jobStorage services.JobStorage
+	commenter  *services.ReviewCommenter
+	voter      *services.ReviewVoter
+	notify     chan string
 }
 
-func New(cfg *config.Config, logger zerolog.Logger, jobStorage *services.JobStorage) *JobMonitor {
+func New(cfg *config.Config, logger zerolog.Logger, hordeService *services.HordeService, jobStorage services.JobStorage, swarm services.StatusUpdater, commenter *services.ReviewCommenter, voter *services.ReviewVoter) *JobMonitor {
 	return &JobMonitor{
 		config:     cfg,
 		logger:     logger,
-		hordeServ:  services.NewHordeService(cfg, logger),
-		swarmServ:  services.NewSwarmService(cfg, logger),
+		hordeServ:  hordeService,
+		swarmServ:  swarm,
 		jobStorage: jobStorage,
+		commenter:  commenter,
+		voter:      voter,
+		notify:     make(chan string, notifyQueueSize),
+	}
+}
+
+// Notify asks the monitor to check a job immediately, e.g. after Horde reported
+// a state change. It never blocks and returns false if the job could not be queued.
+func (m *JobMonitor) Notify(jobID string) bool {
+	select {
+	case m.notify <- jobID:
+		return true
+	default:
+		m.logger.Warn().Str("job_id", jobID).Msg("job notification queue full, leaving job to polling")
+		return false
 	}
 }
 
 func (m *JobMonitor) Start(ctx context.Context) {
 	m.logger.Debug().Msg("JobMonitor starting...")
 
-	ticker := time.NewTicker(time.Duration(m.config.Monitor.Interval) * time.Second)
+	interval := m.config.GetPollInterval()
+	m.logger.Info().Dur("interval", interval).Bool("event_driven", m.config.Monitor.EventDriven).Msg("Polling Horde jobs")
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	// Resume tracking jobs persisted before a restart without waiting for the first tick
+	m.checkJobs(ctx)
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -43,66 +74,267 @@ func (m *JobMonitor) Start(ctx context.Context) {
 		case <-ticker.C:
 			m.logger.Debug().Msg("JobMonitor tick - checking jobs...")
 			m.checkJobs(ctx)
+		case jobID := <-m.notify:
+			m.checkJob(ctx, jobID)
 		}
 	}
 }
 
+// checkJob checks a single tracked job in response to a notification
+func (m *JobMonitor) checkJob(ctx context.Context, jobID string) {
+	job, exists, err := m.jobStorage.Get(jobID)
+	if err != nil {
+		m.logger.Error().Err(err).Str("job_id", jobID).Msg("failed to load notified job")
+		return
+	}
+	if !exists || job.Status.IsFinal() {
+		m.logger.Debug().Str("job_id", jobID).Msg("Ignoring notification for untracked or finished job.")
+		return
+	}
+
+	m.logger.Debug().Str("job_id", jobID).Msg("Checking job after notification...")
+	// Bounded like a poll, so a slow job cannot hold up the monitor loop
+	checkCtx, cancel := context.WithTimeout(ctx, m.config.GetPollInterval())
+	defer cancel()
+	m.processJob(checkCtx, job)
+}
+
+// checkJobs polls all unfinished jobs, and retries the review comments of
+// finished jobs that could not be posted, with a bounded pool of workers. The
+// whole poll, including the checks in progress, ends when the next poll is
+// due: jobs not started by then are skipped and running checks are canceled,
+// so polls never pile up.
 func (m *JobMonitor) checkJobs(ctx context.Context) {
 	m.logger.Debug().Msg("Checking job statuses...")
 
-	jobs := m.jobStorage.List()
+	start := time.Now()
+	defer func() {
+		metrics.MonitorTickDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	if err := m.jobStorage.CleanOld(m.config.GetStorageRetention()); err != nil {
+		m.logger.Error().Err(err).Msg("failed to clean old jobs")
+	}
+
+	jobs, err := m.jobStorage.List()
+	if err != nil {
+		m.logger.Error().Err(err).Msg("failed to list jobs")
+		return
+	}
 	m.logger.Debug().Int("job_count", len(jobs)).Msg("Total jobs in storage")
 
+	tickCtx, cancel := context.WithTimeout(ctx, m.config.GetPollInterval())
+	defer cancel()
+
+	queue := make(chan *models.JobMapping)
+	var wg sync.WaitGroup
+	for i := 0; i < m.config.Monitor.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if job.Status.IsFinal() {
+					m.retryComment(tickCtx, job)
+					continue
+				}
+				m.processJob(tickCtx, job)
+			}
+		}()
+	}
+
+	var pending []*models.JobMapping
 	for _, job := range jobs {
-		m.logger.Debug().Str("job_id", job.HordeJobID).Str("current_status", string(job.Status)).Msg("Checking job status...")
+		if !job.Status.IsFinal() || job.CommentPending {
+			pending = append(pending, job)
+		}
+	}
 
-		currentStatus, err := m.hordeServ.GetJobStatus(ctx, job.HordeJobID)
-		if err != nil {
-			m.logger.Error().Err(err).
-				Str("job_id", job.HordeJobID).
-				Msg("failed to get job status")
-			continue
+	skipped := 0
+dispatch:
+	for i, job := range pending {
+		select {
+		case queue <- job:
+		case <-tickCtx.Done():
+			skipped = len(pending) - i
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if skipped > 0 {
+		metrics.MonitorJobsSkipped.WithLabelValues(metrics.SkipDeadline).Add(float64(skipped))
+		m.logger.Warn().Int("skipped", skipped).Msg("poll deadline reached, remaining jobs are checked on the next poll")
+	}
+}
+
+// processJob fetches the Horde state of a job and reports any change to Swarm
+func (m *JobMonitor) processJob(ctx context.Context, job *models.JobMapping) {
+	m.logger.Debug().Str("job_id", job.HordeJobID).Str("current_status", string(job.Status)).Msg("Checking job status...")
+
+	fetchCtx, cancel := context.WithTimeout(ctx, m.config.GetMonitorJobTimeout())
+	hordeJob, err := m.hordeServ.GetJob(fetchCtx, job.HordeJobID)
+	cancel()
+	if err != nil {
+		if ctx.Err() != nil {
+			// The poll deadline passed, or the monitor is stopping
+			metrics.MonitorJobsSkipped.WithLabelValues(metrics.SkipDeadline).Inc()
+			m.logger.Warn().Str("job_id", job.HordeJobID).Msg("poll deadline reached while fetching job status")
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			metrics.MonitorJobsSkipped.WithLabelValues(metrics.SkipTimeout).Inc()
+			m.logger.Warn().Str("job_id", job.HordeJobID).Msg("timed out fetching job status")
+			return
+		}
+		if errors.Is(err, services.ErrCircuitOpen) {
+			// Horde is down; the job is checked again once it recovers
+			metrics.MonitorJobsSkipped.WithLabelValues(metrics.SkipCircuit).Inc()
+			m.logger.Debug().Str("job_id", job.HordeJobID).Msg("skipped job check, horde is unavailable")
+			return
+		}
+		if horde.IsNotFound(err) {
+			// Left for the retention cleanup; Horde may have purged the job
+			m.logger.Warn().Str("job_id", job.HordeJobID).Msg("horde job no longer exists")
+			return
 		}
+		horde.LogAPIError(m.logger.Error().Err(err), err).
+			Str("job_id", job.HordeJobID).
+			Msg("failed to get job status")
+		return
+	}
+	currentStatus := m.hordeServ.JobStatus(hordeJob)
+
+	// Skip if status hasn't changed
+	if currentStatus == job.Status {
+		m.logger.Debug().Str("job_id", job.HordeJobID).Msg("No status change detected, skipping update.")
+		return
+	}
+
+	// Skip jobs that were finalized elsewhere, e.g. superseded, while polling
+	if latest, exists, err := m.jobStorage.Get(job.HordeJobID); err != nil || !exists || latest.Status.IsFinal() {
+		return
+	}
+
+	// Update job status
+	previousStatus := job.Status
+	job.Status = currentStatus
+	job.UpdatedAt = time.Now()
+	if err := m.jobStorage.Store(job.HordeJobID, job); err != nil {
+		m.logger.Error().Err(err).
+			Str("job_id", job.HordeJobID).
+			Msg("failed to store job status")
+	}
+	m.logger.Info().Str("job_id", job.HordeJobID).Str("new_status", string(currentStatus)).Msg("Job status updated.")
 
-		// Skip if status hasn't changed
-		if currentStatus == job.Status {
-			m.logger.Debug().Str("job_id", job.HordeJobID).Msg("No status change detected, skipping update.")
-			continue
+	// Name the reported steps from the job graph and quote the errors of failed steps
+	var excerpts map[string][]string
+	if currentStatus == models.StatusFailed || currentStatus == models.StatusWarnings {
+		detailCtx, cancel := context.WithTimeout(ctx, m.config.GetMonitorJobTimeout())
+		m.hordeServ.NameSteps(detailCtx, &hordeJob)
+		if currentStatus == models.StatusFailed {
+			excerpts = m.hordeServ.StepExcerpts(detailCtx, hordeJob)
 		}
+		cancel()
+	}
+
+	// Prepare status update for Swarm
+	var swarmStatus string
+	var messages []string
+	var finished bool
+
+	switch currentStatus {
+	case models.StatusCompleted:
+		swarmStatus = models.SwarmStatusPass
+		messages = []string{"Horde job completed successfully"}
+		finished = true
+	case models.StatusWarnings:
+		swarmStatus = models.SwarmStatusPass
+		messages = services.WarningMessages(m.config.Horde.Host, hordeJob)
+		finished = true
+	case models.StatusFailed:
+		swarmStatus = models.SwarmStatusFail
+		messages = services.FailureMessages(m.config.Horde.Host, hordeJob, excerpts)
+		finished = true
+	case models.StatusCanceled:
+		// Swarm has no canceled state, so explain the cancellation instead of listing failures
+		swarmStatus = models.SwarmStatusFail
+		messages = services.CanceledMessages(hordeJob)
+		finished = true
+	case models.StatusRunning:
+		swarmStatus = models.SwarmStatusRunning
+		messages = []string{"Horde job is running"}
+	case models.StatusPending:
+		// A job goes back to waiting when its steps are retried
+		swarmStatus = models.SwarmStatusQueued
+		messages = []string{"Horde job is waiting for agents"}
+	default:
+		return
+	}
 
-		// Update job status
-		job.Status = currentStatus
-		job.UpdatedAt = time.Now()
-		m.jobStorage.Store(job.HordeJobID, job)
-		m.logger.Info().Str("job_id", job.HordeJobID).Str("new_status", string(currentStatus)).Msg("Job status updated.")
-
-		// Prepare status update for Swarm
-		var swarmStatus string
-		var message string
-
-		switch currentStatus {
-		case models.StatusCompleted:
-			swarmStatus = "pass"
-			message = "Horde job completed successfully"
-			defer m.jobStorage.Delete(job.HordeJobID)
-		case models.StatusFailed:
-			swarmStatus = "fail"
-			message = "Horde job failed"
-			defer m.jobStorage.Delete(job.HordeJobID)
-		case models.StatusRunning:
-			swarmStatus = "running"
-			message = "Horde job is running"
-		default:
-			continue
+	// Link the artifacts of finished jobs, except canceled ones which are incomplete
+	if finished && currentStatus != models.StatusCanceled {
+		artifactCtx, cancel := context.WithTimeout(ctx, m.config.GetMonitorJobTimeout())
+		artifacts := m.hordeServ.JobArtifacts(artifactCtx, job.HordeJobID)
+		cancel()
+		messages = services.WithArtifacts(messages, services.ArtifactMessages(m.config.Horde.Host, artifacts))
+	}
+
+	m.logger.Debug().Str("job_id", job.HordeJobID).Str("swarm_status", swarmStatus).Msg("Updating status in Swarm.")
+	// Queue the Swarm update; delivery is retried by the outbox
+	limited := services.LimitMessages(messages, m.config.Swarm.MaxMessages, m.config.Swarm.MaxMessageLength)
+	status := job.SwarmTest.TestRunStatus(job.RequestID, swarmStatus, limited, job.HordeJobID)
+	status.StartTime = hordeJob.StartTime()
+	if finished {
+		status.CompletedTime = hordeJob.FinishTime()
+		if status.CompletedTime == nil {
+			now := time.Now()
+			status.CompletedTime = &now
 		}
+	}
+	if err := m.swarmServ.UpdateStatus(ctx, status); err != nil {
+		m.logger.Error().Err(err).
+			Str("job_id", job.HordeJobID).
+			Msg("failed to queue swarm status update")
 
-		m.logger.Debug().Str("job_id", job.HordeJobID).Str("swarm_status", swarmStatus).Msg("Updating status in Swarm.")
-		// Update Swarm
-		if err := m.swarmServ.UpdateStatus(ctx, job.SwarmTest.UpdateURL,
-			swarmStatus, []string{message}, job.HordeJobID); err != nil {
+		// Keep the job at its previous status so the change is reported on the next check
+		job.Status = previousStatus
+		if err := m.jobStorage.Store(job.HordeJobID, job); err != nil {
 			m.logger.Error().Err(err).
 				Str("job_id", job.HordeJobID).
-				Msg("failed to update swarm status")
+				Msg("failed to restore job status")
 		}
+		return
+	}
+
+	if finished {
+		// Review comments are not bound by the test run message limits
+		if err := m.commenter.Report(ctx, job, currentStatus, messages); err != nil {
+			// Retried on the next polls until the storage retention removes the job
+			job.CommentPending = true
+			job.CommentMessages = messages
+			if err := m.jobStorage.Store(job.HordeJobID, job); err != nil {
+				m.logger.Error().Err(err).
+					Str("job_id", job.HordeJobID).
+					Msg("failed to store pending review comment")
+			}
+		}
+		m.voter.Apply(ctx, job, currentStatus)
+		// The finished job stays in storage for lookups until the retention removes it
+	}
+}
+
+// retryComment posts the review comment of a finished job again after it failed
+func (m *JobMonitor) retryComment(ctx context.Context, job *models.JobMapping) {
+	if err := m.commenter.Report(ctx, job, job.Status, job.CommentMessages); err != nil {
+		return
+	}
+	job.CommentPending = false
+	job.CommentMessages = nil
+	if err := m.jobStorage.Store(job.HordeJobID, job); err != nil {
+		m.logger.Error().Err(err).
+			Str("job_id", job.HordeJobID).
+			Msg("failed to clear pending review comment")
 	}
+	m.logger.Info().Str("job_id", job.HordeJobID).Msg("Posted pending review comment.")
 }
@@ -0,0 +1,197 @@
+package monitor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/metrics"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/services"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+)
+
+// recordingUpdater records the Swarm updates it is asked to send
+type recordingUpdater struct {
+	mu      sync.Mutex
+	updates []string
+}
+
+func (u *recordingUpdater) UpdateStatus(ctx context.Context, status models.TestRunStatus) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.updates = append(u.updates, status.UpdateURL+"="+status.Status+":"+status.JobID)
+	return nil
+}
+
+func (u *recordingUpdater) sent() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.updates...)
+}
+
+// testConfig polls the given Horde server every second, one job at a time,
+// with review comments and votes disabled
+func testConfig(hordeURL string) *config.Config {
+	return &config.Config{
+		Horde:   config.HordeConfig{Host: hordeURL},
+		Retry:   config.RetryConfig{MaxAttempts: 1},
+		Monitor: config.MonitorConfig{Interval: 1, Concurrency: 1, JobTimeout: 30},
+		Storage: config.StorageConfig{Retention: 24},
+	}
+}
+
+// newTestMonitor creates a monitor tracking jobs, recording its Swarm updates
+func newTestMonitor(t *testing.T, cfg *config.Config, jobs ...*models.JobMapping) (*JobMonitor, services.JobStorage, *recordingUpdater) {
+	t.Helper()
+	logger := zerolog.Nop()
+	storage := services.NewMemoryJobStorage()
+	for _, job := range jobs {
+		if err := storage.Store(job.HordeJobID, job); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+	updater := &recordingUpdater{}
+	swarmService := services.NewSwarmService(cfg, logger)
+	m := New(cfg, logger, services.NewHordeService(cfg, logger), storage, updater,
+		services.NewReviewCommenter(cfg, logger, swarmService), services.NewReviewVoter(cfg, logger, swarmService))
+	return m, storage, updater
+}
+
+func runningJob(id string) *models.JobMapping {
+	now := time.Now()
+	return &models.JobMapping{
+		HordeJobID: id,
+		Status:     models.StatusRunning,
+		SwarmTest:  models.SwarmTestRequest{UpdateURL: "run-" + id},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
+
+func TestCheckJobs(t *testing.T) {
+	t.Run("reports finished jobs", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v1/jobs/done" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"done","state":"Complete"}`))
+		}))
+		defer server.Close()
+
+		m, storage, updater := newTestMonitor(t, testConfig(server.URL), runningJob("done"))
+		m.checkJobs(context.Background())
+
+		if sent := updater.sent(); len(sent) != 1 || sent[0] != "run-done=pass:done" {
+			t.Errorf("sent updates = %v, want a pass for the finished job", sent)
+		}
+		// Kept for lookups until the storage retention removes it
+		if job, exists, _ := storage.Get("done"); !exists || job.Status != models.StatusCompleted {
+			t.Errorf("finished job = %+v, want it kept as completed", job)
+		}
+
+		// Finished jobs are not checked again
+		m.checkJobs(context.Background())
+		if sent := updater.sent(); len(sent) != 1 {
+			t.Errorf("sent updates = %v, want the finished job reported once", sent)
+		}
+	})
+
+	t.Run("retries review comments", func(t *testing.T) {
+		hordeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"done","state":"Complete"}`))
+		}))
+		defer hordeServer.Close()
+
+		// Swarm fails until it recovers; the bridge has no open comment to archive
+		var mu sync.Mutex
+		swarmDown := true
+		commentLookups := 0
+		swarmServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			commentLookups++
+			if swarmDown {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(`{"error":null,"messages":[],"data":{"comments":[]}}`))
+		}))
+		defer swarmServer.Close()
+
+		cfg := testConfig(hordeServer.URL)
+		cfg.Swarm = config.SwarmConfig{Host: swarmServer.URL, User: "bridge", Ticket: "ticket", Comments: config.CommentConfig{Enabled: true}}
+		job := runningJob("done")
+		job.SwarmTest.ReviewID = "42"
+		m, storage, updater := newTestMonitor(t, cfg, job)
+
+		m.checkJobs(context.Background())
+		if stored, _, _ := storage.Get("done"); !stored.CommentPending || stored.Status != models.StatusCompleted {
+			t.Fatalf("job = %+v, want it completed with its review comment pending", stored)
+		}
+
+		mu.Lock()
+		swarmDown = false
+		mu.Unlock()
+		m.checkJobs(context.Background())
+		if stored, _, _ := storage.Get("done"); stored.CommentPending {
+			t.Errorf("job = %+v, want its review comment no longer pending", stored)
+		}
+
+		// Once posted, the comment is not retried and the result was reported once
+		m.checkJobs(context.Background())
+		mu.Lock()
+		lookups := commentLookups
+		mu.Unlock()
+		if lookups != 2 {
+			t.Errorf("swarm calls = %d, want 2", lookups)
+		}
+		if sent := updater.sent(); len(sent) != 1 {
+			t.Errorf("sent updates = %v, want the result reported once", sent)
+		}
+	})
+
+	t.Run("bounds the poll by the poll interval", func(t *testing.T) {
+		// Horde never answers until the request is canceled
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer server.Close()
+
+		m, storage, updater := newTestMonitor(t, testConfig(server.URL), runningJob("slow-1"), runningJob("slow-2"))
+		skipped := metrics.MonitorJobsSkipped.WithLabelValues(metrics.SkipDeadline)
+		before := testutil.ToFloat64(skipped)
+
+		start := time.Now()
+		m.checkJobs(context.Background())
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("checkJobs() took %v, want it to end with the 1s poll interval", elapsed)
+		}
+
+		// One job is canceled while being checked and the other is never started
+		if got := testutil.ToFloat64(skipped) - before; got != 2 {
+			t.Errorf("deadline skips = %v, want 2", got)
+		}
+		if sent := updater.sent(); len(sent) != 0 {
+			t.Errorf("sent updates = %v, want none", sent)
+		}
+		jobs, _ := storage.List()
+		for _, job := range jobs {
+			if job.Status != models.StatusRunning || !strings.HasPrefix(job.HordeJobID, "slow-") {
+				t.Errorf("job %s = %s, want it left running for the next poll", job.HordeJobID, job.Status)
+			}
+		}
+		if len(jobs) != 2 {
+			t.Errorf("tracked jobs = %d, want 2", len(jobs))
+		}
+	})
+}
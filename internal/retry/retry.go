@@ -0,0 +1,208 @@
+// Package retry runs operations again after transient failures, with
+// exponential backoff, optional full jitter and permanent-error detection
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Policy describes how an operation is retried
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+	// InitialDelay is the delay after the first failure; it doubles with every
+	// further failure up to MaxDelay
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// Jitter waits a random duration between zero and the backoff delay ("full
+	// jitter"), so callers failing together do not retry in lockstep
+	Jitter bool
+	// OnRetry, if set, is called before waiting for the next attempt
+	OnRetry func(attempt int, delay time.Duration, err error)
+	// Retryable, if set, limits retries to the failures it accepts, for
+	// operations that are only safe to repeat after some failures
+	Retryable func(err error) bool
+}
+
+// Error is returned by Do when the operation did not succeed
+type Error struct {
+	// Attempts is the number of attempts made
+	Attempts int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	if e.Attempts == 1 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Attempts returns the number of attempts recorded in an error returned by Do,
+// or 0 if there is none
+func Attempts(err error) int {
+	var retryErr *Error
+	if errors.As(err, &retryErr) {
+		return retryErr.Attempts
+	}
+	return 0
+}
+
+// Do calls op until it succeeds, returns a permanent error, ctx is done or the
+// policy runs out of attempts. An error asking to be retried later than
+// MaxDelay is returned rather than waited for. Failures are wrapped in *Error.
+func Do[T any](ctx context.Context, p Policy, op func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return zero, &Error{Attempts: attempt - 1, Err: err}
+		}
+
+		result, err := op(ctx)
+		if err == nil {
+			return result, nil
+		}
+		if attempt >= maxAttempts || IsPermanent(err) || ctx.Err() != nil || (p.Retryable != nil && !p.Retryable(err)) {
+			return zero, &Error{Attempts: attempt, Err: err}
+		}
+
+		delay := p.Delay(attempt)
+		if after, ok := RetryAfter(err); ok {
+			if after > p.MaxDelay {
+				return zero, &Error{Attempts: attempt, Err: err}
+			}
+			if after > delay {
+				delay = after
+			}
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return zero, &Error{Attempts: attempt, Err: err}
+		case <-timer.C:
+		}
+	}
+}
+
+// Delay returns how long to wait after the given number of failed attempts
+func (p Policy) Delay(attempts int) time.Duration {
+	delay := Backoff(attempts, p.InitialDelay, p.MaxDelay)
+	if p.Jitter && delay > 0 {
+		delay = time.Duration(rand.Int63n(int64(delay) + 1))
+	}
+	return delay
+}
+
+// Backoff returns the exponential backoff after the given number of failed
+// attempts, doubling from initial up to max
+func Backoff(attempts int, initial, max time.Duration) time.Duration {
+	delay := initial
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying cannot fix
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+type afterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *afterError) Error() string { return e.err.Error() }
+func (e *afterError) Unwrap() error { return e.err }
+
+// After marks an error that may be retried, but not sooner than delay
+func After(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &afterError{err: err, delay: delay}
+}
+
+// RetryAfter returns the delay requested by an error marked with After
+func RetryAfter(err error) (time.Duration, bool) {
+	var after *afterError
+	if errors.As(err, &after) {
+		return after.delay, true
+	}
+	return 0, false
+}
+
+// HTTPStatus classifies err, the failure of a request answered with
+// statusCode. Server errors, 408 and 429 are retryable, honouring any
+// Retry-After header; every other status is permanent.
+func HTTPStatus(statusCode int, header http.Header, err error) error {
+	switch {
+	case statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable:
+		if delay, ok := ParseRetryAfter(header.Get("Retry-After"), time.Now()); ok {
+			return After(err, delay)
+		}
+		return err
+	case statusCode == http.StatusRequestTimeout || statusCode >= 500:
+		return err
+	default:
+		return Permanent(err)
+	}
+}
+
+// ParseRetryAfter parses a Retry-After header, given either in seconds or as
+// an HTTP date
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := at.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,189 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	errTransient := errors.New("transient")
+
+	t.Run("retries until success", func(t *testing.T) {
+		calls := 0
+		var retries []int
+		p := policy
+		p.OnRetry = func(attempt int, delay time.Duration, err error) {
+			retries = append(retries, attempt)
+		}
+
+		got, err := Do(context.Background(), p, func(ctx context.Context) (string, error) {
+			calls++
+			if calls < 3 {
+				return "", errTransient
+			}
+			return "ok", nil
+		})
+		if err != nil || got != "ok" {
+			t.Fatalf("Do() = %q, %v, want ok", got, err)
+		}
+		if len(retries) != 2 || retries[0] != 1 || retries[1] != 2 {
+			t.Errorf("OnRetry attempts = %v, want [1 2]", retries)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		calls := 0
+		_, err := Do(context.Background(), policy, func(ctx context.Context) (int, error) {
+			calls++
+			return 0, errTransient
+		})
+		if !errors.Is(err, errTransient) || Attempts(err) != 3 || calls != 3 {
+			t.Errorf("Do() error = %v after %d calls (attempts %d), want transient after 3", err, calls, Attempts(err))
+		}
+	})
+
+	t.Run("stops on permanent error", func(t *testing.T) {
+		calls := 0
+		_, err := Do(context.Background(), policy, func(ctx context.Context) (int, error) {
+			calls++
+			return 0, Permanent(errTransient)
+		})
+		if !IsPermanent(err) || !errors.Is(err, errTransient) || calls != 1 {
+			t.Errorf("Do() error = %v after %d calls, want permanent after 1", err, calls)
+		}
+	})
+
+	t.Run("retries only retryable errors", func(t *testing.T) {
+		errRetryable := errors.New("retryable")
+		p := policy
+		p.Retryable = func(err error) bool { return errors.Is(err, errRetryable) }
+
+		calls := 0
+		_, err := Do(context.Background(), p, func(ctx context.Context) (int, error) {
+			calls++
+			if calls == 1 {
+				return 0, errRetryable
+			}
+			return 0, errTransient
+		})
+		if !errors.Is(err, errTransient) || IsPermanent(err) || calls != 2 {
+			t.Errorf("Do() error = %v after %d calls, want transient, not permanent, after 2", err, calls)
+		}
+	})
+
+	t.Run("does not wait for retry after beyond max delay", func(t *testing.T) {
+		calls := 0
+		_, err := Do(context.Background(), policy, func(ctx context.Context) (int, error) {
+			calls++
+			return 0, After(errTransient, time.Minute)
+		})
+		if calls != 1 {
+			t.Errorf("Do() made %d calls, want 1", calls)
+		}
+		if delay, ok := RetryAfter(err); !ok || delay != time.Minute {
+			t.Errorf("RetryAfter() = %v, %v, want 1m", delay, ok)
+		}
+	})
+
+	t.Run("stops when context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := Policy{MaxAttempts: 5, InitialDelay: time.Hour, MaxDelay: time.Hour}
+		p.OnRetry = func(int, time.Duration, error) { cancel() }
+
+		_, err := Do(ctx, p, func(ctx context.Context) (int, error) {
+			return 0, errTransient
+		})
+		if !errors.Is(err, errTransient) || Attempts(err) != 1 {
+			t.Errorf("Do() error = %v, want transient after 1 attempt", err)
+		}
+	})
+}
+
+func TestPolicyDelay(t *testing.T) {
+	p := Policy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempts, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+	} {
+		if got := p.Delay(attempts); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+
+	p.Jitter = true
+	for i := 0; i < 100; i++ {
+		if got := p.Delay(3); got < 0 || got > 400*time.Millisecond {
+			t.Fatalf("Delay(3) with jitter = %v, want between 0 and 400ms", got)
+		}
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	errStatus := errors.New("unexpected status")
+
+	tests := []struct {
+		name          string
+		status        int
+		retryAfter    string
+		wantPermanent bool
+		wantAfter     time.Duration
+	}{
+		{name: "server error", status: http.StatusBadGateway},
+		{name: "request timeout", status: http.StatusRequestTimeout},
+		{name: "too many requests", status: http.StatusTooManyRequests, retryAfter: "2", wantAfter: 2 * time.Second},
+		{name: "unavailable with retry after", status: http.StatusServiceUnavailable, retryAfter: "1", wantAfter: time.Second},
+		{name: "not found", status: http.StatusNotFound, wantPermanent: true},
+		{name: "unauthorized", status: http.StatusUnauthorized, wantPermanent: true},
+		{name: "bad request", status: http.StatusBadRequest, wantPermanent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.retryAfter != "" {
+				header.Set("Retry-After", tt.retryAfter)
+			}
+
+			err := HTTPStatus(tt.status, header, errStatus)
+			if !errors.Is(err, errStatus) {
+				t.Errorf("HTTPStatus() = %v, want wrapped status error", err)
+			}
+			if IsPermanent(err) != tt.wantPermanent {
+				t.Errorf("IsPermanent() = %v, want %v", IsPermanent(err), tt.wantPermanent)
+			}
+			if after, _ := RetryAfter(err); after != tt.wantAfter {
+				t.Errorf("RetryAfter() = %v, want %v", after, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: "30", want: 30 * time.Second, wantOK: true},
+		{value: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute, wantOK: true},
+		{value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, wantOK: true},
+		{value: ""},
+		{value: "soon"},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
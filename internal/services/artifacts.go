@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+)
+
+// FindJobArtifacts retrieves the artifacts published by a job
+func (s *HordeService) FindJobArtifacts(ctx context.Context, jobID string) ([]horde.Artifact, error) {
+	artifacts, err := callHorde(ctx, s, "find_artifacts", func(ctx context.Context) ([]horde.Artifact, error) {
+		return s.client.FindJobArtifacts(ctx, jobID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("finding horde job artifacts: %w", err)
+	}
+	return artifacts, nil
+}
+
+// JobArtifacts returns the artifacts of a job selected for linking from its
+// test run. Artifacts that cannot be listed are logged and left out.
+func (s *HordeService) JobArtifacts(ctx context.Context, jobID string) []horde.Artifact {
+	if !s.cfg.Swarm.Artifacts.Enabled {
+		return nil
+	}
+
+	artifacts, err := s.FindJobArtifacts(ctx, jobID)
+	if err != nil {
+		horde.LogAPIError(s.logger.Warn().Err(err), err).
+			Str("job_id", jobID).
+			Msg("failed to list job artifacts, reporting the job without artifact links")
+		return nil
+	}
+	return filterArtifacts(s.cfg.Swarm.Artifacts, artifacts)
+}
+
+// filterArtifacts keeps the artifacts matching the configured names and
+// types, up to the configured number of links
+func filterArtifacts(cfg config.ArtifactConfig, artifacts []horde.Artifact) []horde.Artifact {
+	var selected []horde.Artifact
+	for _, artifact := range artifacts {
+		if cfg.MaxLinks > 0 && len(selected) >= cfg.MaxLinks {
+			break
+		}
+		if matchesAny(cfg.Names, artifact.Name) && containsAny(cfg.Types, artifact.Type) {
+			selected = append(selected, artifact)
+		}
+	}
+	return selected
+}
+
+// matchesAny reports whether name matches one of the glob patterns, or
+// whether there are none
+func matchesAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether value is one of values, or whether there are none
+func containsAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+)
+
+func TestJobArtifacts(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/api/v2/artifacts" || r.URL.Query().Get("key") != "job:job-1" {
+			t.Errorf("request = %s?%s, want artifacts of job:job-1", r.URL.Path, r.URL.RawQuery)
+		}
+		_, _ = w.Write([]byte(`{"artifacts":[
+			{"id":"a1","name":"Editor-Win64","type":"step-saved"},
+			{"id":"a2","name":"TestReport","type":"step-output"},
+			{"id":"a3","name":"Game-Win64","type":"step-saved"},
+			{"id":"a4","name":"Logs","type":"step-trace"}
+		]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		artifacts config.ArtifactConfig
+		want      []string
+	}{
+		{
+			name:      "disabled",
+			artifacts: config.ArtifactConfig{Names: []string{"*"}},
+		},
+		{
+			name:      "all artifacts up to max links",
+			artifacts: config.ArtifactConfig{Enabled: true, MaxLinks: 3},
+			want:      []string{"a1", "a2", "a3"},
+		},
+		{
+			name:      "name patterns",
+			artifacts: config.ArtifactConfig{Enabled: true, Names: []string{"*-Win64", "TestReport"}, MaxLinks: 5},
+			want:      []string{"a1", "a2", "a3"},
+		},
+		{
+			name:      "types",
+			artifacts: config.ArtifactConfig{Enabled: true, Names: []string{"*-Win64"}, Types: []string{"step-saved"}, MaxLinks: 1},
+			want:      []string{"a1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			service := NewHordeService(&config.Config{
+				Horde: config.HordeConfig{Host: server.URL, APIKey: "key"},
+				Swarm: config.SwarmConfig{Artifacts: tt.artifacts},
+				Retry: config.RetryConfig{MaxAttempts: 1},
+			}, zerolog.Nop())
+
+			got := service.JobArtifacts(context.Background(), "job-1")
+			var ids []string
+			for _, artifact := range got {
+				ids = append(ids, artifact.Id)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("JobArtifacts() = %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Errorf("JobArtifacts() = %v, want %v", ids, tt.want)
+				}
+			}
+			if !tt.artifacts.Enabled && requests != 0 {
+				t.Errorf("made %d requests with artifact links disabled, want none", requests)
+			}
+		})
+	}
+}
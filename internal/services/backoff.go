@@ -0,0 +1,37 @@
+package services
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/metrics"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/retry"
+)
+
+// exponentialBackoff returns the delay before retrying something that failed
+// attempts times, doubling from initialDelay up to maxDelay seconds
+func exponentialBackoff(attempts, initialDelay, maxDelay int) time.Duration {
+	return retry.Backoff(attempts, time.Duration(initialDelay)*time.Second, time.Duration(maxDelay)*time.Second)
+}
+
+// retryPolicy returns the configured retry policy for an API call, logging
+// and counting each retry
+func retryPolicy(cfg *config.Config, logger zerolog.Logger, service, operation string) retry.Policy {
+	return retry.Policy{
+		MaxAttempts:  cfg.Retry.MaxAttempts,
+		InitialDelay: cfg.GetRetryInitialDelay(),
+		MaxDelay:     cfg.GetRetryMaxDelay(),
+		Jitter:       !cfg.Retry.DisableJitter,
+		OnRetry: func(attempt int, delay time.Duration, err error) {
+			metrics.RequestRetries.WithLabelValues(service, operation).Inc()
+			logger.Debug().Err(err).
+				Str("service", service).
+				Str("operation", operation).
+				Int("attempt", attempt).
+				Dur("delay", delay).
+				Msg("retrying operation")
+		},
+	}
+}
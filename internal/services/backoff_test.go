@@ -0,0 +1,15 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	want := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, 60 * time.Second, 60 * time.Second}
+	for i, w := range want {
+		if got := exponentialBackoff(i+1, 5, 60); got != w {
+			t.Errorf("exponentialBackoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/metrics"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+const (
+	// BreakerClosed lets every call through
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen fails every call fast until the open timeout has passed
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single probe call through to test for recovery
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+var breakerStates = []BreakerState{BreakerClosed, BreakerOpen, BreakerHalfOpen}
+
+// ErrCircuitOpen is returned for calls rejected by an open circuit breaker
+var ErrCircuitOpen = errors.New("horde is unavailable (circuit breaker open)")
+
+// CircuitBreaker stops calls to a failing backend. It opens after a number of
+// consecutive failures, rejects calls until the open timeout has passed and
+// then half-opens, letting one probe call decide whether to close or re-open.
+type CircuitBreaker struct {
+	clock       config.Clock
+	logger      zerolog.Logger
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(cfg *config.Config, logger zerolog.Logger) *CircuitBreaker {
+	b := &CircuitBreaker{
+		clock:       cfg.Clock,
+		logger:      logger,
+		threshold:   cfg.Horde.Breaker.FailureThreshold,
+		openTimeout: cfg.GetBreakerOpenTimeout(),
+		state:       BreakerClosed,
+	}
+	if b.clock == nil {
+		b.clock = config.RealClock{}
+	}
+	b.reportState()
+	return b
+}
+
+// State returns the current state of the breaker
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.clock.Now().Sub(b.openedAt) >= b.openTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a call may be made, returning ErrCircuitOpen if not.
+// Every allowed call must be followed by Success, Failure or Release.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.clock.Now().Sub(b.openedAt) >= b.openTimeout {
+		b.setState(BreakerHalfOpen)
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		metrics.HordeCallsRejected.Inc()
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probing {
+			metrics.HordeCallsRejected.Inc()
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Success records a call that reached the backend and closes the breaker
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	b.failures = 0
+	if b.state != BreakerClosed {
+		b.setState(BreakerClosed)
+	}
+}
+
+// Failure records a failed call, opening the breaker after too many in a row
+// or when the probe of a half-open breaker fails
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.threshold > 0 && b.failures >= b.threshold) {
+		b.openedAt = b.clock.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// Release ends a call whose outcome says nothing about the backend, such as
+// one canceled by its caller
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// setState changes the state; the caller must hold mu
+func (b *CircuitBreaker) setState(state BreakerState) {
+	event := b.logger.Warn()
+	if state == BreakerClosed {
+		event = b.logger.Info()
+	}
+	event.
+		Str("from", string(b.state)).
+		Str("to", string(state)).
+		Int("failures", b.failures).
+		Msg("horde circuit breaker changed state")
+	b.state = state
+	b.reportState()
+}
+
+func (b *CircuitBreaker) reportState() {
+	for _, state := range breakerStates {
+		value := 0.0
+		if state == b.state {
+			value = 1
+		}
+		metrics.HordeCircuitState.WithLabelValues(string(state)).Set(value)
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cfg := &config.Config{
+		Horde: config.HordeConfig{Breaker: config.BreakerConfig{FailureThreshold: 3, OpenTimeout: 30}},
+		Clock: clock,
+	}
+	breaker := NewCircuitBreaker(cfg, zerolog.Nop())
+
+	fail := func() {
+		t.Helper()
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("Allow() error = %v, want call allowed", err)
+		}
+		breaker.Failure()
+	}
+
+	// A success resets the count of consecutive failures
+	fail()
+	fail()
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	breaker.Success()
+	fail()
+	fail()
+	if state := breaker.State(); state != BreakerClosed {
+		t.Fatalf("State() = %s after 2 consecutive failures, want closed", state)
+	}
+
+	fail()
+	if state := breaker.State(); state != BreakerOpen {
+		t.Fatalf("State() = %s after 3 consecutive failures, want open", state)
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() error = %v while open, want ErrCircuitOpen", err)
+	}
+
+	// After the open timeout a single probe is let through
+	clock.now = clock.now.Add(30 * time.Second)
+	if state := breaker.State(); state != BreakerHalfOpen {
+		t.Fatalf("State() = %s after open timeout, want half_open", state)
+	}
+	fail()
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() error = %v after failed probe, want ErrCircuitOpen", err)
+	}
+
+	clock.now = clock.now.Add(30 * time.Second)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Allow() error = %v for probe", err)
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() error = %v during probe, want ErrCircuitOpen", err)
+	}
+
+	// A released probe lets the next call probe instead
+	breaker.Release()
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Allow() error = %v after released probe", err)
+	}
+	breaker.Success()
+	if state := breaker.State(); state != BreakerClosed {
+		t.Errorf("State() = %s after successful probe, want closed", state)
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+var (
+	// ErrJobNotFound is returned when canceling a job the bridge does not track
+	ErrJobNotFound = errors.New("job not tracked")
+	// ErrJobFinished is returned when canceling a job that has already finished
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// CancelFilter selects the jobs canceled together. Empty fields match any job,
+// so at least one should be set.
+type CancelFilter struct {
+	Changelist string
+	ReviewID   string
+}
+
+// Matches reports whether a job belongs to the changelist and review of the filter
+func (f CancelFilter) Matches(job *models.JobMapping) bool {
+	return f.matchesTest(job.SwarmTest)
+}
+
+func (f CancelFilter) matchesTest(test models.SwarmTestRequest) bool {
+	return (f.Changelist == "" || test.Changelist == f.Changelist) &&
+		(f.ReviewID == "" || test.ReviewID == f.ReviewID)
+}
+
+// CancelResult is the outcome of canceling one of several jobs, or of a
+// request still waiting for its job
+type CancelResult struct {
+	JobID     string `json:"job_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Canceller aborts Horde jobs that are no longer wanted and reports that to Swarm
+type Canceller struct {
+	cfg          *config.Config
+	logger       zerolog.Logger
+	hordeService *HordeService
+	swarmService StatusUpdater
+	jobStorage   JobStorage
+	intake       IntakeQueue
+}
+
+// NewCanceller creates a new instance of Canceller
+func NewCanceller(
+	cfg *config.Config,
+	logger zerolog.Logger,
+	hordeService *HordeService,
+	swarmService StatusUpdater,
+	jobStorage JobStorage,
+	intake IntakeQueue,
+) *Canceller {
+	return &Canceller{
+		cfg:          cfg,
+		logger:       logger,
+		hordeService: hordeService,
+		swarmService: swarmService,
+		jobStorage:   jobStorage,
+		intake:       intake,
+	}
+}
+
+// Supersede cancels the active jobs of earlier runs of the same Swarm test as
+// current, marks their mappings as superseded and reports it on their test runs
+func (c *Canceller) Supersede(ctx context.Context, current *models.JobMapping) error {
+	jobs, err := c.jobStorage.List()
+	if err != nil {
+		return fmt.Errorf("listing jobs: %w", err)
+	}
+
+	for _, old := range findSuperseded(jobs, current) {
+		logger := c.logger.With().
+			Str("job_id", old.HordeJobID).
+			Str("superseded_by", current.HordeJobID).
+			Str("review_id", old.SwarmTest.ReviewID).
+			Logger()
+
+		reason := fmt.Sprintf("Superseded by Horde job %s", current.HordeJobID)
+		if current.SwarmTest.Version != "" {
+			reason = fmt.Sprintf("Superseded by review version %s (Horde job %s)", current.SwarmTest.Version, current.HordeJobID)
+		}
+
+		if err := c.hordeService.AbortJob(ctx, old.HordeJobID, reason); err != nil {
+			// Keep tracking the old job so its real outcome is still reported
+			logger.Error().Err(err).Msg("failed to abort superseded job")
+			continue
+		}
+
+		old.Status = models.StatusSuperseded
+		old.SupersededBy = current.HordeJobID
+		old.UpdatedAt = time.Now()
+		if err := c.jobStorage.Store(old.HordeJobID, old); err != nil {
+			logger.Error().Err(err).Msg("failed to mark job as superseded")
+		}
+
+		messages := []string{reason, fmt.Sprintf("%s/job/%s", c.cfg.Horde.Host, current.HordeJobID)}
+		if err := c.swarmService.UpdateStatus(ctx, old.SwarmTest.TestRunStatus(old.RequestID, models.SwarmStatusFail, messages, old.HordeJobID)); err != nil {
+			logger.Error().Err(err).Msg("failed to report superseded job to swarm")
+		}
+
+		logger.Info().Msg("Superseded previous Horde job")
+	}
+
+	return nil
+}
+
+// Cancel aborts a tracked Horde job on request, reports the cancellation on
+// its Swarm test run and marks it canceled. A job Horde no longer knows is
+// still reported and marked. If the report cannot be queued, the job is left
+// for the monitor to report and the error is returned.
+func (c *Canceller) Cancel(ctx context.Context, jobID, reason string) (*models.JobMapping, error) {
+	job, exists, err := c.jobStorage.Get(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("loading job: %w", err)
+	}
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	if job.Status.IsFinal() {
+		return job, ErrJobFinished
+	}
+
+	logger := c.logger.With().Str("job_id", jobID).Logger()
+
+	if err := c.hordeService.AbortJob(ctx, jobID, reason); err != nil {
+		if !horde.IsNotFound(err) {
+			return job, err
+		}
+		logger.Warn().Msg("horde job no longer exists, marking it canceled")
+	}
+
+	messages := CanceledMessages(horde.GetJobResponse{CancellationReason: reason})
+	if err := c.swarmService.UpdateStatus(ctx, job.SwarmTest.TestRunStatus(job.RequestID, models.SwarmStatusFail, messages, jobID)); err != nil {
+		// Keep tracking the job so the monitor reports the cancellation from Horde
+		return job, fmt.Errorf("reporting canceled job to swarm: %w", err)
+	}
+
+	// Kept for lookups until the storage retention removes it
+	job.Status = models.StatusCanceled
+	job.UpdatedAt = time.Now()
+	if err := c.jobStorage.Store(jobID, job); err != nil {
+		logger.Error().Err(err).Msg("failed to mark job as canceled")
+	}
+
+	logger.Info().Str("reason", reason).Msg("Canceled Horde job")
+	return job, nil
+}
+
+// CancelMatching cancels every queued request and unfinished job matching
+// filter, returning the outcome for each: jobs by ID, then requests oldest
+// first. Requests are dropped first, so a job created from one meanwhile is
+// found among the jobs.
+func (c *Canceller) CancelMatching(ctx context.Context, filter CancelFilter, reason string) ([]CancelResult, error) {
+	requests, err := c.cancelQueued(ctx, filter, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err := c.jobStorage.List()
+	if err != nil {
+		return nil, fmt.Errorf("listing jobs: %w", err)
+	}
+
+	results := []CancelResult{}
+	for _, job := range jobs {
+		if job.Status.IsFinal() || !filter.Matches(job) {
+			continue
+		}
+		result := CancelResult{JobID: job.HordeJobID}
+		if _, err := c.Cancel(ctx, job.HordeJobID, reason); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].JobID < results[j].JobID })
+	return append(results, requests...), nil
+}
+
+// cancelQueued drops the queued requests matching filter and reports them to
+// Swarm as canceled
+func (c *Canceller) cancelQueued(ctx context.Context, filter CancelFilter, reason string) ([]CancelResult, error) {
+	requests, err := c.intake.Pending()
+	if err != nil {
+		return nil, fmt.Errorf("listing intake requests: %w", err)
+	}
+
+	var results []CancelResult
+	for _, req := range requests {
+		if !filter.matchesTest(req.SwarmTest) {
+			continue
+		}
+		logger := c.logger.With().Str("request_id", req.ID).Logger()
+
+		result := CancelResult{RequestID: req.ID}
+		if err := c.intake.Remove(req.ID); err != nil {
+			logger.Error().Err(err).Msg("failed to remove canceled intake request")
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		messages := []string{"Test request was canceled before its Horde job was created", "Reason: " + reason}
+		if err := c.swarmService.UpdateStatus(ctx, req.SwarmTest.TestRunStatus(req.ID, models.SwarmStatusFail, messages, "")); err != nil {
+			logger.Error().Err(err).Msg("failed to report canceled request to swarm")
+		}
+		logger.Info().Str("reason", reason).Msg("Canceled queued test request")
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// findSuperseded returns the unfinished jobs belonging to an earlier run of
+// the same Swarm test. Runs are matched by review, test and route when the
+// review ID is known, and by update URL otherwise.
+func findSuperseded(jobs []*models.JobMapping, current *models.JobMapping) []*models.JobMapping {
+	var superseded []*models.JobMapping
+	for _, job := range jobs {
+		if job.HordeJobID == current.HordeJobID || job.Status.IsFinal() {
+			continue
+		}
+		if !sameSwarmTest(job, current) {
+			continue
+		}
+		if isNewerVersion(job.SwarmTest.Version, current.SwarmTest.Version) {
+			// An out-of-order webhook must not cancel the latest version
+			continue
+		}
+		superseded = append(superseded, job)
+	}
+	return superseded
+}
+
+func sameSwarmTest(a, b *models.JobMapping) bool {
+	if a.SwarmTest.ReviewID != "" || b.SwarmTest.ReviewID != "" {
+		return a.SwarmTest.ReviewID == b.SwarmTest.ReviewID &&
+			a.SwarmTest.Test == b.SwarmTest.Test &&
+			a.Target.Route == b.Target.Route
+	}
+	return a.SwarmTest.UpdateURL == b.SwarmTest.UpdateURL
+}
+
+// isNewerVersion reports whether review version a is known to be newer than b
+func isNewerVersion(a, b string) bool {
+	va, errA := strconv.Atoi(a)
+	vb, errB := strconv.Atoi(b)
+	return errA == nil && errB == nil && va > vb
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+func TestFindSuperseded(t *testing.T) {
+	current := &models.JobMapping{
+		HordeJobID: "new",
+		SwarmTest:  models.SwarmTestRequest{ReviewID: "42", Version: "3", Test: "preflight", UpdateURL: "http://swarm/run-3"},
+		Status:     models.StatusPending,
+	}
+
+	jobs := []*models.JobMapping{
+		current,
+		{HordeJobID: "previous-version", SwarmTest: models.SwarmTestRequest{ReviewID: "42", Version: "2", Test: "preflight"}, Status: models.StatusRunning},
+		{HordeJobID: "already-finished", SwarmTest: models.SwarmTestRequest{ReviewID: "42", Version: "1", Test: "preflight"}, Status: models.StatusCompleted},
+		{HordeJobID: "other-test", SwarmTest: models.SwarmTestRequest{ReviewID: "42", Version: "2", Test: "lint"}, Status: models.StatusRunning},
+		{HordeJobID: "other-review", SwarmTest: models.SwarmTestRequest{ReviewID: "7", Version: "2", Test: "preflight"}, Status: models.StatusRunning},
+		{HordeJobID: "newer-version", SwarmTest: models.SwarmTestRequest{ReviewID: "42", Version: "4", Test: "preflight"}, Status: models.StatusRunning},
+		{HordeJobID: "other-route", SwarmTest: models.SwarmTestRequest{ReviewID: "42", Version: "2", Test: "preflight"}, Target: models.JobTarget{Route: "release"}, Status: models.StatusRunning},
+	}
+
+	got := findSuperseded(jobs, current)
+	if len(got) != 1 || got[0].HordeJobID != "previous-version" {
+		ids := make([]string, 0, len(got))
+		for _, job := range got {
+			ids = append(ids, job.HordeJobID)
+		}
+		t.Errorf("findSuperseded() = %v, want [previous-version]", ids)
+	}
+
+	t.Run("matches by update URL without review ID", func(t *testing.T) {
+		current := &models.JobMapping{HordeJobID: "new", SwarmTest: models.SwarmTestRequest{UpdateURL: "http://swarm/run"}}
+		jobs := []*models.JobMapping{
+			current,
+			{HordeJobID: "same-url", SwarmTest: models.SwarmTestRequest{UpdateURL: "http://swarm/run"}, Status: models.StatusRunning},
+			{HordeJobID: "other-url", SwarmTest: models.SwarmTestRequest{UpdateURL: "http://swarm/other"}, Status: models.StatusRunning},
+		}
+
+		got := findSuperseded(jobs, current)
+		if len(got) != 1 || got[0].HordeJobID != "same-url" {
+			t.Errorf("findSuperseded() = %+v, want only same-url", got)
+		}
+	})
+}
+
+func TestCancellerSupersede(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	var aborted []string
+	hordeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("Expected PUT request, got %s", r.Method)
+		}
+		var req horde.UpdateJobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request body: %v", err)
+		}
+		if req.Aborted == nil || !*req.Aborted {
+			t.Errorf("Expected aborted request, got %+v", req)
+		}
+		aborted = append(aborted, r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer hordeServer.Close()
+
+	var swarmUpdates []models.SwarmUpdateRequest
+	swarmServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var update models.SwarmUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			t.Fatalf("failed to decode request body: %v", err)
+		}
+		swarmUpdates = append(swarmUpdates, update)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer swarmServer.Close()
+
+	cfg := &config.Config{
+		Horde: config.HordeConfig{Host: hordeServer.URL, APIKey: "test-key"},
+		Retry: config.RetryConfig{MaxAttempts: 1},
+	}
+
+	storage := NewMemoryJobStorage()
+	old := &models.JobMapping{
+		HordeJobID: "old-job",
+		SwarmTest:  models.SwarmTestRequest{ReviewID: "42", Version: "1", UpdateURL: swarmServer.URL + "/run-1"},
+		Status:     models.StatusRunning,
+	}
+	current := &models.JobMapping{
+		HordeJobID: "new-job",
+		SwarmTest:  models.SwarmTestRequest{ReviewID: "42", Version: "2", UpdateURL: swarmServer.URL + "/run-2"},
+		Status:     models.StatusPending,
+	}
+	for _, job := range []*models.JobMapping{old, current} {
+		if err := storage.Store(job.HordeJobID, job); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	canceller := NewCanceller(cfg, logger, NewHordeService(cfg, logger), NewSwarmService(cfg, logger), storage, NewMemoryIntakeQueue())
+	if err := canceller.Supersede(context.Background(), current); err != nil {
+		t.Fatalf("Supersede() error = %v", err)
+	}
+
+	if len(aborted) != 1 || aborted[0] != "/api/v1/jobs/old-job" {
+		t.Errorf("aborted jobs = %v, want [/api/v1/jobs/old-job]", aborted)
+	}
+
+	stored, _, _ := storage.Get("old-job")
+	if stored.Status != models.StatusSuperseded || stored.SupersededBy != "new-job" {
+		t.Errorf("old job = %+v, want superseded by new-job", stored)
+	}
+
+	if len(swarmUpdates) != 1 || swarmUpdates[0].Status != "fail" {
+		t.Fatalf("swarm updates = %+v, want one fail update", swarmUpdates)
+	}
+
+	jobs, _ := storage.List()
+	var statuses []string
+	for _, job := range jobs {
+		statuses = append(statuses, string(job.Status))
+	}
+	sort.Strings(statuses)
+	if len(statuses) != 2 || statuses[0] != string(models.StatusPending) || statuses[1] != string(models.StatusSuperseded) {
+		t.Errorf("stored statuses = %v, want [pending superseded]", statuses)
+	}
+}
+
+func TestCancellerCancel(t *testing.T) {
+	hordeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/jobs/gone":
+			http.Error(w, "job not found", http.StatusNotFound)
+		case "/api/v1/jobs/broken":
+			http.Error(w, "access denied", http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer hordeServer.Close()
+
+	cfg := &config.Config{
+		Horde: config.HordeConfig{Host: hordeServer.URL, APIKey: "test-key"},
+		Retry: config.RetryConfig{MaxAttempts: 1},
+	}
+
+	storage := NewMemoryJobStorage()
+	for _, job := range []*models.JobMapping{
+		{HordeJobID: "cl-1", SwarmTest: models.SwarmTestRequest{Changelist: "100", ReviewID: "42", UpdateURL: "http://swarm/cl-1"}, Status: models.StatusRunning},
+		{HordeJobID: "gone", SwarmTest: models.SwarmTestRequest{Changelist: "100", ReviewID: "42", UpdateURL: "http://swarm/gone"}, Status: models.StatusPending},
+		{HordeJobID: "broken", SwarmTest: models.SwarmTestRequest{Changelist: "100", ReviewID: "7", UpdateURL: "http://swarm/broken"}, Status: models.StatusRunning},
+		{HordeJobID: "finished", SwarmTest: models.SwarmTestRequest{Changelist: "100", ReviewID: "42"}, Status: models.StatusCompleted},
+		{HordeJobID: "other", SwarmTest: models.SwarmTestRequest{Changelist: "200", ReviewID: "43"}, Status: models.StatusRunning},
+	} {
+		if err := storage.Store(job.HordeJobID, job); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	intake := NewMemoryIntakeQueue()
+	queued := &models.IntakeRequest{SwarmTest: models.SwarmTestRequest{Changelist: "100", ReviewID: "42", UpdateURL: "http://swarm/queued"}}
+	waiting := &models.IntakeRequest{SwarmTest: models.SwarmTestRequest{Changelist: "200", ReviewID: "43", UpdateURL: "http://swarm/waiting"}}
+	for _, req := range []*models.IntakeRequest{queued, waiting} {
+		if err := intake.Add(req); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	swarm := &recordingUpdater{}
+	canceller := NewCanceller(cfg, zerolog.Nop(), NewHordeService(cfg, zerolog.Nop()), swarm, storage, intake)
+
+	if _, err := canceller.Cancel(context.Background(), "unknown", "test"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Cancel(unknown) error = %v, want ErrJobNotFound", err)
+	}
+	if _, err := canceller.Cancel(context.Background(), "finished", "test"); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Cancel(finished) error = %v, want ErrJobFinished", err)
+	}
+
+	results, err := canceller.CancelMatching(context.Background(), CancelFilter{Changelist: "100"}, "Changelist was shelved again")
+	if err != nil {
+		t.Fatalf("CancelMatching() error = %v", err)
+	}
+	if len(results) != 4 || results[0].JobID != "broken" || results[0].Error == "" ||
+		results[1] != (CancelResult{JobID: "cl-1"}) || results[2] != (CancelResult{JobID: "gone"}) ||
+		results[3] != (CancelResult{RequestID: queued.ID}) {
+		t.Errorf("CancelMatching() = %+v, want broken failing, cl-1, gone and the queued request canceled", results)
+	}
+
+	wantUpdates := map[string]bool{"http://swarm/cl-1=fail:cl-1": true, "http://swarm/gone=fail:gone": true, "http://swarm/queued=fail:": true}
+	sent := swarm.sent()
+	if len(sent) != len(wantUpdates) {
+		t.Errorf("swarm updates = %v, want fail updates for cl-1, gone and the queued request", sent)
+	}
+	for _, update := range sent {
+		if !wantUpdates[update] {
+			t.Errorf("unexpected swarm update %s", update)
+		}
+	}
+
+	// The matching request no longer waits for a job; the other one still does
+	if pending, _ := intake.Pending(); len(pending) != 1 || pending[0].ID != waiting.ID {
+		t.Errorf("Pending() = %+v, want only the request of changelist 200", pending)
+	}
+
+	// Canceled jobs are kept for lookups until the storage retention removes them
+	wantStatuses := map[string]models.JobStatus{
+		"cl-1":     models.StatusCanceled,
+		"gone":     models.StatusCanceled,
+		"broken":   models.StatusRunning,
+		"finished": models.StatusCompleted,
+		"other":    models.StatusRunning,
+	}
+	for id, want := range wantStatuses {
+		if job, tracked, _ := storage.Get(id); !tracked || job.Status != want {
+			t.Errorf("job %s = %+v, want it tracked as %s", id, job, want)
+		}
+	}
+	if _, err := canceller.Cancel(context.Background(), "cl-1", "test"); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Cancel(cl-1) again error = %v, want ErrJobFinished", err)
+	}
+
+	// A cancellation that cannot be reported is left for the monitor
+	unreported := NewCanceller(cfg, zerolog.Nop(), NewHordeService(cfg, zerolog.Nop()), failingUpdater{}, storage, intake)
+	if _, err := unreported.Cancel(context.Background(), "other", "test"); err == nil {
+		t.Error("Cancel(other) error = nil, want the failed Swarm update reported")
+	}
+	if job, _, _ := storage.Get("other"); job.Status != models.StatusRunning {
+		t.Errorf("job other = %+v, want it still tracked as running", job)
+	}
+}
+
+// failingUpdater is a Swarm updater whose updates cannot be queued
+type failingUpdater struct{}
+
+func (failingUpdater) UpdateStatus(ctx context.Context, status models.TestRunStatus) error {
+	return errors.New("disk full")
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/swarm"
+)
+
+// ReviewCommenter comments on Swarm reviews when their jobs fail, keeping a
+// single open comment per review and test
+type ReviewCommenter struct {
+	cfg    *config.Config
+	logger zerolog.Logger
+	swarm  *SwarmService
+}
+
+// NewReviewCommenter creates a new instance of ReviewCommenter
+func NewReviewCommenter(cfg *config.Config, logger zerolog.Logger, swarmService *SwarmService) *ReviewCommenter {
+	return &ReviewCommenter{
+		cfg:    cfg,
+		logger: logger,
+		swarm:  swarmService,
+	}
+}
+
+// Report comments on the review of a finished job. A failure is posted with
+// messages as its summary, editing or replacing the bridge's previous comment
+// for the same test; a pass archives that comment. Jobs without a review, and
+// all jobs while comments are disabled, are ignored. Errors are logged and
+// returned; reporting again is safe, as a comment already posted for the job
+// is edited rather than posted twice.
+func (c *ReviewCommenter) Report(ctx context.Context, job *models.JobMapping, status models.JobStatus, messages []string) error {
+	if !c.cfg.Swarm.Comments.Enabled || job.SwarmTest.ReviewID == "" {
+		return nil
+	}
+
+	logger := c.logger.With().
+		Str("job_id", job.HordeJobID).
+		Str("review_id", job.SwarmTest.ReviewID).
+		Logger()
+
+	var err error
+	switch status {
+	case models.StatusFailed:
+		err = c.commentFailure(ctx, job, messages)
+	case models.StatusCompleted, models.StatusWarnings:
+		err = c.archivePrevious(ctx, job)
+	default:
+		return nil
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("status", string(status)).Msg("failed to comment on swarm review")
+	}
+	return err
+}
+
+// commentFailure posts the failure of a job, editing the previous comment or
+// archiving it first as configured
+func (c *ReviewCommenter) commentFailure(ctx context.Context, job *models.JobMapping, messages []string) error {
+	author := job.SwarmTest.Author
+	if author == "" {
+		review, err := c.swarm.GetReview(ctx, job.SwarmTest.ReviewID)
+		if err != nil {
+			return err
+		}
+		author = review.Author
+	}
+	body := commentBody(author, job, c.cfg.Horde.Host, messages)
+
+	previous, found, err := c.findPrevious(ctx, job)
+	if err != nil {
+		return err
+	}
+	if found {
+		// The comment may have been posted by an earlier attempt whose response was
+		// lost; the newline ends the job ID, so job-2 does not match job-20
+		if c.cfg.Swarm.Comments.Previous == config.CommentPreviousEdit || strings.Contains(previous.Body, commentJobLine(c.cfg.Horde.Host, job)+"\n") {
+			return c.swarm.EditComment(ctx, previous.ID, swarm.EditCommentRequest{Body: body})
+		}
+		if err := c.archive(ctx, previous); err != nil {
+			return err
+		}
+	}
+
+	comment, err := c.swarm.AddComment(ctx, swarm.AddCommentRequest{
+		Topic: swarm.ReviewTopic(job.SwarmTest.ReviewID),
+		Body:  body,
+	})
+	if err != nil {
+		return err
+	}
+	c.logger.Info().Str("job_id", job.HordeJobID).Int("comment_id", comment.ID).Msg("Commented on swarm review")
+	return nil
+}
+
+// archivePrevious archives the bridge's open comment for the job's test, if any
+func (c *ReviewCommenter) archivePrevious(ctx context.Context, job *models.JobMapping) error {
+	previous, found, err := c.findPrevious(ctx, job)
+	if err != nil || !found {
+		return err
+	}
+	return c.archive(ctx, previous)
+}
+
+func (c *ReviewCommenter) archive(ctx context.Context, comment swarm.Comment) error {
+	flags := append(append([]string(nil), comment.Flags...), swarm.CommentFlagClosed)
+	return c.swarm.EditComment(ctx, comment.ID, swarm.EditCommentRequest{Flags: flags})
+}
+
+// findPrevious returns the newest open comment the bridge posted on the
+// review for the job's test
+func (c *ReviewCommenter) findPrevious(ctx context.Context, job *models.JobMapping) (swarm.Comment, bool, error) {
+	comments, err := c.swarm.GetComments(ctx, swarm.ReviewTopic(job.SwarmTest.ReviewID))
+	if err != nil {
+		return swarm.Comment{}, false, err
+	}
+
+	marker := commentMarker(job)
+	var previous swarm.Comment
+	found := false
+	for _, comment := range comments {
+		if comment.User != c.cfg.Swarm.User || comment.IsArchived() || !strings.Contains(comment.Body, marker) {
+			continue
+		}
+		if !found || comment.ID > previous.ID {
+			previous, found = comment, true
+		}
+	}
+	return previous, found, nil
+}
+
+// commentBody tags the review author on the failure summary, followed by the
+// failure details, a link to the Horde job and the marker identifying the comment
+func commentBody(author string, job *models.JobMapping, hordeHost string, messages []string) string {
+	var b strings.Builder
+	if author != "" {
+		b.WriteString("@" + author + " ")
+	}
+	if len(messages) == 0 {
+		messages = []string{"Horde job failed"}
+	}
+	b.WriteString(messages[0])
+	for _, message := range messages[1:] {
+		b.WriteString("\n" + message)
+	}
+	b.WriteString("\n\n" + commentJobLine(hordeHost, job) + "\n" + commentMarker(job))
+	return b.String()
+}
+
+// commentJobLine links the Horde job a comment reports on, identifying the job
+// the comment was posted for
+func commentJobLine(hordeHost string, job *models.JobMapping) string {
+	return fmt.Sprintf("Horde job: %s/job/%s", hordeHost, job.HordeJobID)
+}
+
+// commentMarker identifies the bridge's comments for a test, so later runs
+// find them again
+func commentMarker(job *models.JobMapping) string {
+	test := job.SwarmTest.Test
+	if test == "" {
+		test = "preflight"
+	}
+	if job.Target.Route != "" {
+		test += ", route " + job.Target.Route
+	}
+	return fmt.Sprintf("_Reported by swarm-horde-bridge for %s_", test)
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/swarm"
+)
+
+// fakeSwarmComments serves the Swarm review and comment API from memory
+type fakeSwarmComments struct {
+	mu       sync.Mutex
+	comments []swarm.Comment
+	// loseAdd fails the next added comment after posting it, as if the response was lost
+	loseAdd bool
+}
+
+func (f *fakeSwarmComments) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	respond := func(data interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": nil, "messages": []string{}, "data": data})
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v11/reviews/42":
+		respond(map[string][]swarm.Review{"reviews": {{ID: 42, Author: "reviewauthor"}}})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v11/comments":
+		respond(map[string][]swarm.Comment{"comments": f.comments})
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v11/comments":
+		var req swarm.AddCommentRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		comment := swarm.Comment{ID: len(f.comments) + 1, Topic: req.Topic, User: "bridge", Body: req.Body}
+		f.comments = append(f.comments, comment)
+		if f.loseAdd {
+			f.loseAdd = false
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		respond(map[string][]swarm.Comment{"comments": {comment}})
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/api/v11/comments/"):
+		var req swarm.EditCommentRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		for i := range f.comments {
+			if r.URL.Path == fmt.Sprintf("/api/v11/comments/%d", f.comments[i].ID) {
+				if req.Body != "" {
+					f.comments[i].Body = req.Body
+				}
+				if req.Flags != nil {
+					f.comments[i].Flags = req.Flags
+				}
+				respond(map[string][]swarm.Comment{"comments": {f.comments[i]}})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// open returns the bodies of the comments that are not archived
+func (f *fakeSwarmComments) open() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var bodies []string
+	for _, comment := range f.comments {
+		if !comment.IsArchived() {
+			bodies = append(bodies, comment.Body)
+		}
+	}
+	return bodies
+}
+
+func TestReviewCommenter(t *testing.T) {
+	newCommenter := func(t *testing.T, comments config.CommentConfig) (*ReviewCommenter, *fakeSwarmComments) {
+		fake := &fakeSwarmComments{
+			// Comments by other users or for other tests are left alone
+			comments: []swarm.Comment{
+				{ID: 100, User: "jdoe", Body: "Looks good"},
+				{ID: 101, User: "bridge", Body: "Lint failed\n\n_Reported by swarm-horde-bridge for lint_"},
+			},
+		}
+		server := httptest.NewServer(fake)
+		t.Cleanup(server.Close)
+
+		cfg := &config.Config{
+			Horde: config.HordeConfig{Host: "https://horde"},
+			Swarm: config.SwarmConfig{Host: server.URL, User: "bridge", Ticket: "ticket", Comments: comments},
+			Retry: config.RetryConfig{MaxAttempts: 1},
+		}
+		return NewReviewCommenter(cfg, zerolog.Nop(), NewSwarmService(cfg, zerolog.Nop())), fake
+	}
+
+	job := func(id string) *models.JobMapping {
+		return &models.JobMapping{HordeJobID: id, SwarmTest: models.SwarmTestRequest{ReviewID: "42", Test: "preflight"}}
+	}
+	ctx := context.Background()
+
+	t.Run("edits previous comment", func(t *testing.T) {
+		commenter, fake := newCommenter(t, config.CommentConfig{Enabled: true, Previous: config.CommentPreviousEdit})
+
+		commenter.Report(ctx, job("job-1"), models.StatusFailed, []string{"Horde job failed: 1 of 2 steps failed", "Compile: Failure"})
+		commenter.Report(ctx, job("job-2"), models.StatusFailed, []string{"Horde job failed: 2 of 2 steps failed"})
+
+		open := fake.open()
+		want := "@reviewauthor Horde job failed: 2 of 2 steps failed\n\nHorde job: https://horde/job/job-2\n_Reported by swarm-horde-bridge for preflight_"
+		if len(open) != 3 || open[2] != want {
+			t.Errorf("open comments = %q, want the first failure comment edited to\n%s", open, want)
+		}
+
+		commenter.Report(ctx, job("job-3"), models.StatusCompleted, nil)
+		if open := fake.open(); len(open) != 2 {
+			t.Errorf("open comments after pass = %q, want bridge comment archived", open)
+		}
+	})
+
+	t.Run("archives previous comment", func(t *testing.T) {
+		commenter, fake := newCommenter(t, config.CommentConfig{Enabled: true, Previous: config.CommentPreviousArchive})
+
+		first := job("job-1")
+		first.SwarmTest.Author = "jdoe"
+		commenter.Report(ctx, first, models.StatusFailed, []string{"Horde job failed"})
+		commenter.Report(ctx, job("job-2"), models.StatusFailed, []string{"Horde job failed again"})
+
+		open := fake.open()
+		if len(open) != 3 || !strings.HasPrefix(open[2], "@reviewauthor Horde job failed again") {
+			t.Errorf("open comments = %q, want only the latest failure comment open", open)
+		}
+		if len(fake.comments) != 4 || !strings.HasPrefix(fake.comments[2].Body, "@jdoe ") || !fake.comments[2].IsArchived() {
+			t.Errorf("comments = %+v, want the first failure comment tagging jdoe archived", fake.comments)
+		}
+	})
+
+	t.Run("does not post twice after a lost response", func(t *testing.T) {
+		commenter, fake := newCommenter(t, config.CommentConfig{Enabled: true, Previous: config.CommentPreviousArchive})
+		fake.loseAdd = true
+
+		if err := commenter.Report(ctx, job("job-1"), models.StatusFailed, []string{"Horde job failed"}); err == nil {
+			t.Fatal("Report() error = nil, want the lost response reported")
+		}
+		if err := commenter.Report(ctx, job("job-1"), models.StatusFailed, []string{"Horde job failed"}); err != nil {
+			t.Fatalf("Report() retry error = %v", err)
+		}
+		if len(fake.comments) != 3 || fake.comments[2].IsArchived() {
+			t.Errorf("comments = %+v, want the comment posted once and left open", fake.comments)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		commenter, fake := newCommenter(t, config.CommentConfig{Previous: config.CommentPreviousEdit})
+		commenter.Report(ctx, job("job-1"), models.StatusFailed, []string{"Horde job failed"})
+		if len(fake.comments) != 2 {
+			t.Errorf("comments = %+v, want none added", fake.comments)
+		}
+	})
+}
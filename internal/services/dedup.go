@@ -0,0 +1,117 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+// Deduplicator recognises repeated webhook calls, such as Swarm retrying after
+// a timeout, so that they return the job already started instead of a new one
+type Deduplicator struct {
+	cfg        *config.Config
+	jobStorage JobStorage
+	intake     IntakeQueue
+
+	mu    sync.Mutex
+	locks map[string]*dedupLock
+}
+
+type dedupLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewDeduplicator creates a new instance of Deduplicator
+func NewDeduplicator(cfg *config.Config, jobStorage JobStorage, intake IntakeQueue) *Deduplicator {
+	return &Deduplicator{
+		cfg:        cfg,
+		jobStorage: jobStorage,
+		intake:     intake,
+		locks:      make(map[string]*dedupLock),
+	}
+}
+
+// DedupKey identifies the calls that are considered the same. An idempotency
+// key wins; otherwise the Swarm test run, or its update URL, plus changelist.
+func DedupKey(req models.SwarmTestRequest, idempotencyKey string) string {
+	switch {
+	case idempotencyKey != "":
+		return "key:" + idempotencyKey
+	case req.TestRunID != "":
+		return fmt.Sprintf("run:%s:%s", req.TestRunID, req.Changelist)
+	default:
+		return fmt.Sprintf("url:%s:%s", req.UpdateURL, req.Changelist)
+	}
+}
+
+// Lock serialises calls with the same key, so a retry arriving while the
+// original call is still creating its job waits and then finds that job.
+// The returned function releases the lock.
+func (d *Deduplicator) Lock(key string) func() {
+	d.mu.Lock()
+	lock, exists := d.locks[key]
+	if !exists {
+		lock = &dedupLock{}
+		d.locks[key] = lock
+	}
+	lock.refs++
+	d.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		d.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(d.locks, key)
+		}
+		d.mu.Unlock()
+	}
+}
+
+// Find returns the request still queued, or else the job started within the
+// deduplication window and not yet finished, for the same key
+func (d *Deduplicator) Find(key string) (models.SwarmTestResponse, bool, error) {
+	requests, err := d.intake.Pending()
+	if err != nil {
+		return models.SwarmTestResponse{}, false, fmt.Errorf("listing intake requests: %w", err)
+	}
+	for _, req := range requests {
+		if DedupKey(req.SwarmTest, req.IdempotencyKey) == key {
+			return models.SwarmTestResponse{
+				RequestID:  req.ID,
+				Duplicate:  true,
+				LastError:  req.LastError,
+				HordeError: req.HordeError,
+			}, true, nil
+		}
+	}
+
+	jobs, err := d.jobStorage.List()
+	if err != nil {
+		return models.SwarmTestResponse{}, false, fmt.Errorf("listing jobs: %w", err)
+	}
+
+	cutoff := d.cfg.Clock.Now().Add(-d.cfg.GetDedupWindow())
+	var found *models.JobMapping
+	for _, job := range jobs {
+		if job.CreatedAt.Before(cutoff) || DedupKey(job.SwarmTest, job.IdempotencyKey) != key {
+			continue
+		}
+		// A test whose job has reported its result may be run again
+		if job.Status.IsFinal() && job.Status != models.StatusSuperseded {
+			continue
+		}
+		if found == nil || job.CreatedAt.After(found.CreatedAt) {
+			found = job
+		}
+	}
+	if found == nil {
+		return models.SwarmTestResponse{}, false, nil
+	}
+	return models.SwarmTestResponse{RequestID: found.RequestID, JobID: found.HordeJobID, Duplicate: true}, true, nil
+}
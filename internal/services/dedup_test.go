@@ -0,0 +1,127 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+func TestDedupKey(t *testing.T) {
+	req := models.SwarmTestRequest{Changelist: "123", UpdateURL: "http://swarm/update/abc"}
+
+	tests := []struct {
+		name           string
+		req            models.SwarmTestRequest
+		idempotencyKey string
+		want           string
+	}{
+		{name: "idempotency key", req: req, idempotencyKey: "k1", want: "key:k1"},
+		{name: "test run", req: models.SwarmTestRequest{Changelist: "123", TestRunID: "42"}, want: "run:42:123"},
+		{name: "update url", req: req, want: "url:http://swarm/update/abc:123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DedupKey(tt.req, tt.idempotencyKey); got != tt.want {
+				t.Errorf("DedupKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeduplicatorFind(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cfg := &config.Config{Webhook: config.WebhookConfig{DedupWindow: 3600}, Clock: &fakeClock{now: now}}
+
+	storage := NewMemoryJobStorage()
+	jobs := []*models.JobMapping{
+		{HordeJobID: "old", SwarmTest: models.SwarmTestRequest{Changelist: "1", TestRunID: "7"}, CreatedAt: now.Add(-2 * time.Hour)},
+		{HordeJobID: "recent", SwarmTest: models.SwarmTestRequest{Changelist: "1", TestRunID: "7"}, CreatedAt: now.Add(-10 * time.Minute)},
+		{HordeJobID: "other-change", SwarmTest: models.SwarmTestRequest{Changelist: "2", TestRunID: "7"}, CreatedAt: now},
+		{HordeJobID: "keyed", SwarmTest: models.SwarmTestRequest{Changelist: "3"}, IdempotencyKey: "k1", CreatedAt: now},
+		{HordeJobID: "finished", SwarmTest: models.SwarmTestRequest{Changelist: "5", TestRunID: "7"}, Status: models.StatusCompleted, CreatedAt: now},
+		{HordeJobID: "superseded", SwarmTest: models.SwarmTestRequest{Changelist: "6", TestRunID: "7"}, Status: models.StatusSuperseded, CreatedAt: now},
+	}
+	for _, job := range jobs {
+		if err := storage.Store(job.HordeJobID, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	intake := NewMemoryIntakeQueue()
+	queued := &models.IntakeRequest{SwarmTest: models.SwarmTestRequest{Changelist: "4", TestRunID: "7"}, ReceivedAt: now}
+	if err := intake.Add(queued); err != nil {
+		t.Fatal(err)
+	}
+	dedup := NewDeduplicator(cfg, storage, intake)
+
+	tests := []struct {
+		key           string
+		wantID        string
+		wantRequestID string
+	}{
+		{key: "run:7:1", wantID: "recent"},
+		{key: "run:7:2", wantID: "other-change"},
+		{key: "key:k1", wantID: "keyed"},
+		{key: "run:7:4", wantRequestID: queued.ID},
+		{key: "run:8:1"},
+		// A finished job's test may run again, a superseded one's may not
+		{key: "run:7:5"},
+		{key: "run:7:6", wantID: "superseded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			resp, found, err := dedup.Find(tt.key)
+			if err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			if tt.wantID == "" && tt.wantRequestID == "" {
+				if found {
+					t.Errorf("Find() = %+v, want nothing", resp)
+				}
+				return
+			}
+			if !found || !resp.Duplicate || resp.JobID != tt.wantID || resp.RequestID != tt.wantRequestID {
+				t.Errorf("Find() = %+v, %v, want job %q request %q", resp, found, tt.wantID, tt.wantRequestID)
+			}
+		})
+	}
+}
+
+func TestDeduplicatorLock(t *testing.T) {
+	dedup := NewDeduplicator(&config.Config{}, NewMemoryJobStorage(), NewMemoryIntakeQueue())
+
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := dedup.Lock("run:1:1")
+			defer unlock()
+
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxActive != 1 {
+		t.Errorf("%d calls with the same key ran concurrently, want 1", maxActive)
+	}
+	if len(dedup.locks) != 0 {
+		t.Errorf("%d locks left after all calls finished, want 0", len(dedup.locks))
+	}
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/metrics"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/retry"
+)
+
+// intakePollInterval is how often the dispatcher looks for queued requests
+const intakePollInterval = time.Second
+
+// JobDispatcher creates the Horde jobs of accepted Swarm test requests in the
+// background. When job creation fails transiently, Horde is assumed to be
+// unavailable and all requests are held, in the order they arrived, until a
+// retry succeeds. Requests Horde rejects outright are failed.
+type JobDispatcher struct {
+	cfg          *config.Config
+	logger       zerolog.Logger
+	hordeService *HordeService
+	swarm        StatusUpdater
+	jobStorage   JobStorage
+	intake       IntakeQueue
+	jobBuilder   *JobBuilder
+	canceller    *Canceller
+	wake         chan struct{}
+
+	// failures and holdUntil are only used by the dispatch loop
+	failures  int
+	holdUntil time.Time
+}
+
+// NewJobDispatcher creates a new instance of JobDispatcher
+func NewJobDispatcher(
+	cfg *config.Config,
+	logger zerolog.Logger,
+	hordeService *HordeService,
+	swarm StatusUpdater,
+	jobStorage JobStorage,
+	intake IntakeQueue,
+) (*JobDispatcher, error) {
+	jobBuilder, err := NewJobBuilder(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("configuring job templates: %w", err)
+	}
+
+	return &JobDispatcher{
+		cfg:          cfg,
+		logger:       logger,
+		hordeService: hordeService,
+		swarm:        swarm,
+		jobStorage:   jobStorage,
+		intake:       intake,
+		jobBuilder:   jobBuilder,
+		canceller:    NewCanceller(cfg, logger, hordeService, swarm, jobStorage, intake),
+		wake:         make(chan struct{}, 1),
+	}, nil
+}
+
+// Submit checks that a job can be built for the request, queues it and
+// reports the test run as queued to Swarm
+func (d *JobDispatcher) Submit(ctx context.Context, req models.SwarmTestRequest, target models.JobTarget, idempotencyKey string) (*models.IntakeRequest, error) {
+	if _, err := d.jobBuilder.Build(req, target); err != nil {
+		return nil, fmt.Errorf("building horde job request: %w", err)
+	}
+
+	intakeReq := &models.IntakeRequest{
+		SwarmTest:      req,
+		Target:         target,
+		IdempotencyKey: idempotencyKey,
+		ReceivedAt:     d.cfg.Clock.Now(),
+	}
+	if err := d.intake.Add(intakeReq); err != nil {
+		return nil, err
+	}
+
+	if err := d.swarm.UpdateStatus(ctx, req.TestRunStatus(intakeReq.ID, models.SwarmStatusQueued, []string{"Queued for Horde"}, "")); err != nil {
+		d.logger.Error().Err(err).Str("request_id", intakeReq.ID).Msg("failed to report queued request to swarm")
+	}
+
+	d.notify()
+	return intakeReq, nil
+}
+
+// Pending returns the requests still waiting for a Horde job
+func (d *JobDispatcher) Pending() ([]*models.IntakeRequest, error) {
+	return d.intake.Pending()
+}
+
+// Start creates jobs for queued requests until ctx is canceled
+func (d *JobDispatcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(intakePollInterval)
+	defer ticker.Stop()
+
+	// Dispatch requests accepted before a restart
+	d.dispatch(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatch(ctx)
+		case <-d.wake:
+			d.dispatch(ctx)
+		}
+	}
+}
+
+func (d *JobDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch creates jobs for queued requests, oldest first, unless requests are being held
+func (d *JobDispatcher) dispatch(ctx context.Context) {
+	requests, err := d.intake.Pending()
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to list intake requests")
+		return
+	}
+	metrics.IntakePending.Set(float64(len(requests)))
+	if len(requests) == 0 {
+		return
+	}
+	dispatched, err := d.dispatchedRequests()
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to list job mappings")
+		return
+	}
+
+	for _, req := range requests {
+		if ctx.Err() != nil {
+			return
+		}
+		if jobID, ok := dispatched[req.ID]; ok {
+			// The job was stored, but removing the request failed; creating it
+			// again would start a duplicate job
+			if err := d.intake.Remove(req.ID); err != nil {
+				d.logger.Error().Err(err).Str("request_id", req.ID).Str("job_id", jobID).Msg("failed to remove dispatched intake request")
+			}
+			continue
+		}
+		if d.cfg.Clock.Now().Sub(req.ReceivedAt) > d.cfg.GetIntakeMaxAge() {
+			metrics.IntakeExpired.Inc()
+			message := fmt.Sprintf("No Horde job could be created within %s", d.cfg.GetIntakeMaxAge())
+			if req.LastError != "" {
+				message += ": " + req.LastError
+			}
+			d.fail(ctx, req, message)
+			continue
+		}
+		if d.cfg.Clock.Now().Before(d.holdUntil) {
+			d.hold(ctx, req)
+			continue
+		}
+		d.create(ctx, req)
+	}
+}
+
+// dispatchedRequests maps the intake requests that already have a job mapping to their job IDs
+func (d *JobDispatcher) dispatchedRequests() (map[string]string, error) {
+	mappings, err := d.jobStorage.List()
+	if err != nil {
+		return nil, err
+	}
+	dispatched := make(map[string]string, len(mappings))
+	for _, mapping := range mappings {
+		if mapping.RequestID != "" {
+			dispatched[mapping.RequestID] = mapping.HordeJobID
+		}
+	}
+	return dispatched, nil
+}
+
+// untrackedJobReason is recorded in Horde for jobs aborted because their mapping could not be stored
+const untrackedJobReason = "The Swarm-Horde bridge could not track this job"
+
+// create starts the Horde job of a request and hands it over to the job monitor
+func (d *JobDispatcher) create(ctx context.Context, req *models.IntakeRequest) {
+	logger := d.logger.With().Str("request_id", req.ID).Str("changelist", req.SwarmTest.Changelist).Logger()
+
+	spec, err := d.jobBuilder.Build(req.SwarmTest, req.Target)
+	if err != nil {
+		// Templates do not change at runtime, so retrying cannot help
+		logger.Error().Err(err).Msg("failed to build horde job request")
+		d.fail(ctx, req, "Failed to build the Horde job request: "+err.Error())
+		return
+	}
+
+	jobID, err := d.hordeService.CreateJob(ctx, spec)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		switch {
+		case horde.IsUnauthorized(err):
+			// Every request would be rejected; hold them until the API key is fixed
+			horde.LogAPIError(logger.Error(), err).Msg("horde rejected the API key, holding requests")
+		case errors.Is(err, ErrCircuitOpen), connectFailed(err):
+			// The request never reached Horde, so it can safely be sent again
+		case retry.IsPermanent(err):
+			// Horde answered but rejected the job; holding will not change that
+			d.failures = 0
+			horde.LogAPIError(logger.Error().Err(err), err).Msg("horde rejected job creation")
+			d.fail(ctx, req, "Horde rejected the job: "+hordeErrorMessage(err))
+			return
+		default:
+			// Horde may have created the job before failing, e.g. on a server
+			// error or timeout, so creating it again could start a duplicate
+			horde.LogAPIError(logger.Error().Err(err), err).Msg("horde job creation failed after reaching horde")
+			d.fail(ctx, req, "Creating the Horde job failed, and it is not retried as Horde may have started it: "+hordeErrorMessage(err))
+			return
+		}
+		d.failures++
+		delay := exponentialBackoff(d.failures, d.cfg.Intake.InitialDelay, d.cfg.Intake.MaxDelay)
+		d.holdUntil = d.cfg.Clock.Now().Add(delay)
+
+		req.Attempts++
+		req.LastError = err.Error()
+		req.HordeError, _ = horde.AsAPIError(err)
+		if err := d.intake.Update(req); err != nil {
+			logger.Error().Err(err).Msg("failed to save intake request")
+		}
+		horde.LogAPIError(logger.Warn().Err(err), err).
+			Int("attempts", req.Attempts).
+			Dur("hold_for", delay).
+			Msg("failed to create horde job, holding requests")
+		d.hold(ctx, req)
+		return
+	}
+	d.failures = 0
+
+	logger.Info().Msgf("Created Horde job with ID: %s for change: %s", jobID, req.SwarmTest.Changelist)
+
+	mapping := &models.JobMapping{
+		SwarmTest:      req.SwarmTest,
+		HordeJobID:     jobID,
+		Target:         req.Target,
+		Status:         models.StatusPending,
+		RequestID:      req.ID,
+		IdempotencyKey: req.IdempotencyKey,
+		CreatedAt:      d.cfg.Clock.Now(),
+		UpdatedAt:      d.cfg.Clock.Now(),
+	}
+	if err := d.jobStorage.Store(jobID, mapping); err != nil {
+		// An untracked job would never be reported, and retrying would start a
+		// duplicate, so stop the job and fail the request
+		logger.Error().Err(err).Str("job_id", jobID).Msg("failed to store job mapping, aborting job")
+		if err := d.hordeService.AbortJob(ctx, jobID, untrackedJobReason); err != nil {
+			horde.LogAPIError(logger.Error().Err(err), err).Str("job_id", jobID).Msg("failed to abort untracked job")
+		}
+		d.fail(ctx, req, "The bridge could not track Horde job "+jobID+" and aborted it")
+		return
+	}
+	if err := d.intake.Remove(req.ID); err != nil {
+		logger.Error().Err(err).Msg("failed to remove dispatched intake request")
+	}
+
+	// Cancel jobs started for earlier versions of the same review
+	if err := d.canceller.Supersede(ctx, mapping); err != nil {
+		logger.Error().Err(err).Str("job_id", jobID).Msg("failed to supersede previous jobs")
+	}
+
+	// The job waits for agents; the monitor reports it running once Horde starts it
+	messages := []string{"Created Horde job " + d.cfg.Horde.Host + "/job/" + jobID}
+	if err := d.swarm.UpdateStatus(ctx, req.SwarmTest.TestRunStatus(req.ID, models.SwarmStatusQueued, messages, jobID)); err != nil {
+		logger.Error().Err(err).Msg("failed to update swarm status")
+	}
+}
+
+// hordeErrorMessage describes a Horde error for a Swarm test run, preferring
+// Horde's own message over the full error chain
+func hordeErrorMessage(err error) string {
+	if apiErr, ok := horde.AsAPIError(err); ok && apiErr.Message != "" {
+		return fmt.Sprintf("%s (HTTP %d)", apiErr.Message, apiErr.StatusCode)
+	}
+	return err.Error()
+}
+
+// hold tells Swarm, once per request, that its job waits for Horde to recover
+func (d *JobDispatcher) hold(ctx context.Context, req *models.IntakeRequest) {
+	if req.Held {
+		return
+	}
+	req.Held = true
+	if err := d.intake.Update(req); err != nil {
+		d.logger.Error().Err(err).Str("request_id", req.ID).Msg("failed to save intake request")
+		return
+	}
+
+	messages := []string{"Horde is unavailable, the job will be created once it recovers"}
+	if err := d.swarm.UpdateStatus(ctx, req.SwarmTest.TestRunStatus(req.ID, models.SwarmStatusQueued, messages, "")); err != nil {
+		d.logger.Error().Err(err).Str("request_id", req.ID).Msg("failed to report held request to swarm")
+	}
+}
+
+// fail drops a request that will not get a job and reports the reason to Swarm
+func (d *JobDispatcher) fail(ctx context.Context, req *models.IntakeRequest, message string) {
+	d.logger.Error().Str("request_id", req.ID).Str("reason", message).Msg("giving up on intake request")
+
+	if err := d.intake.Remove(req.ID); err != nil {
+		d.logger.Error().Err(err).Str("request_id", req.ID).Msg("failed to remove intake request")
+		return
+	}
+	if err := d.swarm.UpdateStatus(ctx, req.SwarmTest.TestRunStatus(req.ID, models.SwarmStatusFail, []string{message}, "")); err != nil {
+		d.logger.Error().Err(err).Str("request_id", req.ID).Msg("failed to report failed request to swarm")
+	}
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+// recordingUpdater records the Swarm updates it is asked to send
+type recordingUpdater struct {
+	mu      sync.Mutex
+	updates []string
+	// messages are those of the last update
+	messages []string
+}
+
+func (u *recordingUpdater) UpdateStatus(ctx context.Context, status models.TestRunStatus) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.updates = append(u.updates, status.UpdateURL+"="+status.Status+":"+status.JobID)
+	u.messages = status.Messages
+	return nil
+}
+
+func (u *recordingUpdater) sent() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.updates...)
+}
+
+// failingStorage is a job storage whose writes fail
+type failingStorage struct {
+	JobStorage
+}
+
+func (failingStorage) Store(jobID string, job *models.JobMapping) error {
+	return errors.New("disk full")
+}
+
+// flakyIntake is an intake queue whose first Remove fails
+type flakyIntake struct {
+	IntakeQueue
+	failed bool
+}
+
+func (q *flakyIntake) Remove(id string) error {
+	if !q.failed {
+		q.failed = true
+		return errors.New("disk full")
+	}
+	return q.IntakeQueue.Remove(id)
+}
+
+func TestJobDispatcher(t *testing.T) {
+	created := 0
+	hordeServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		created++
+		resp := horde.CreateJobResponse{ID: fmt.Sprintf("job-%d", created), State: "Pending"}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("encoding response: %v", err)
+		}
+	}))
+	defer hordeServer.Close()
+	// Horde is down until the server is started on its address
+	hordeAddr := hordeServer.Listener.Addr().String()
+	hordeServer.Listener.Close()
+	startHorde := func() {
+		listener, err := net.Listen("tcp", hordeAddr)
+		if err != nil {
+			t.Fatalf("listening on %s: %v", hordeAddr, err)
+		}
+		hordeServer.Listener = listener
+		hordeServer.Start()
+	}
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cfg := &config.Config{
+		Horde:  config.HordeConfig{Host: "http://" + hordeAddr},
+		Retry:  config.RetryConfig{MaxAttempts: 1},
+		Intake: config.IntakeConfig{MaxAge: 3600, InitialDelay: 5, MaxDelay: 60},
+		Clock:  clock,
+	}
+	logger := zerolog.Nop()
+	updater := &recordingUpdater{}
+	storage := NewMemoryJobStorage()
+	intake := NewMemoryIntakeQueue()
+	dispatcher, err := NewJobDispatcher(cfg, logger, NewHordeService(cfg, logger), updater, storage, intake)
+	if err != nil {
+		t.Fatalf("NewJobDispatcher() error = %v", err)
+	}
+	ctx := context.Background()
+
+	first, err := dispatcher.Submit(ctx, models.SwarmTestRequest{Changelist: "1", UpdateURL: "run-1"}, models.JobTarget{}, "k1")
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	second, err := dispatcher.Submit(ctx, models.SwarmTestRequest{Changelist: "2", UpdateURL: "run-2"}, models.JobTarget{}, "")
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	// Horde is down: the first failure holds every request
+	dispatcher.dispatch(ctx)
+	pending, _ := dispatcher.Pending()
+	if len(pending) != 2 || pending[0].Attempts != 1 || pending[0].LastError == "" || pending[1].Attempts != 0 {
+		t.Fatalf("Pending() after failure = %+v, want both held after one attempt", pending)
+	}
+	if !pending[0].Held || !pending[1].Held {
+		t.Errorf("Pending() after failure = %+v, want Swarm told both are held", pending)
+	}
+
+	// Still held until the backoff has passed
+	dispatcher.dispatch(ctx)
+	if pending, _ := dispatcher.Pending(); pending[0].Attempts != 1 {
+		t.Fatalf("request retried during hold, attempts = %d", pending[0].Attempts)
+	}
+
+	clock.now = clock.now.Add(5 * time.Second)
+	dispatcher.dispatch(ctx)
+	startHorde()
+	clock.now = clock.now.Add(10 * time.Second)
+	dispatcher.dispatch(ctx)
+
+	if pending, _ := dispatcher.Pending(); len(pending) != 0 {
+		t.Fatalf("Pending() after Horde recovered = %+v, want none", pending)
+	}
+
+	job, exists, err := storage.Get("job-1")
+	if err != nil || !exists {
+		t.Fatalf("Get(job-1) = %v, %v, want stored mapping", exists, err)
+	}
+	if job.RequestID != first.ID || job.IdempotencyKey != "k1" || job.SwarmTest.Changelist != "1" {
+		t.Errorf("job-1 mapping = %+v, want first request", job)
+	}
+	if job, _, _ := storage.Get("job-2"); job == nil || job.RequestID != second.ID {
+		t.Errorf("job-2 mapping = %+v, want second request", job)
+	}
+
+	// Queued on submit, again once held while Horde is down, then running
+	want := []string{"run-1=queued:", "run-2=queued:", "run-1=queued:", "run-2=queued:", "run-1=queued:job-1", "run-2=queued:job-2"}
+	if got := updater.sent(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Swarm updates = %v, want %v", got, want)
+	}
+
+	t.Run("expires requests after max age", func(t *testing.T) {
+		hordeServer.Close()
+
+		if _, err := dispatcher.Submit(ctx, models.SwarmTestRequest{Changelist: "3", UpdateURL: "run-3"}, models.JobTarget{}, ""); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		dispatcher.dispatch(ctx)
+
+		clock.now = clock.now.Add(2 * time.Hour)
+		dispatcher.dispatch(ctx)
+
+		if pending, _ := dispatcher.Pending(); len(pending) != 0 {
+			t.Fatalf("Pending() after max age = %+v, want none", pending)
+		}
+		got := updater.sent()
+		if last := got[len(got)-1]; last != "run-3=fail:" {
+			t.Errorf("last Swarm update = %s, want run-3=fail:", last)
+		}
+	})
+
+	t.Run("fails requests Horde rejects", func(t *testing.T) {
+		rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer rejecting.Close()
+
+		cfg := *cfg
+		cfg.Horde.Host = rejecting.URL
+		dispatcher, err := NewJobDispatcher(&cfg, logger, NewHordeService(&cfg, logger), updater, storage, intake)
+		if err != nil {
+			t.Fatalf("NewJobDispatcher() error = %v", err)
+		}
+
+		if _, err := dispatcher.Submit(ctx, models.SwarmTestRequest{Changelist: "4", UpdateURL: "run-4"}, models.JobTarget{}, ""); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		dispatcher.dispatch(ctx)
+
+		if pending, _ := dispatcher.Pending(); len(pending) != 0 {
+			t.Fatalf("Pending() after rejection = %+v, want none", pending)
+		}
+		if !dispatcher.holdUntil.IsZero() {
+			t.Errorf("holdUntil = %v, want requests not held", dispatcher.holdUntil)
+		}
+		got := updater.sent()
+		if last := got[len(got)-1]; last != "run-4=fail:" {
+			t.Errorf("last Swarm update = %s, want run-4=fail:", last)
+		}
+	})
+
+	t.Run("aborts jobs that cannot be tracked", func(t *testing.T) {
+		var aborted []string
+		hordeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				_ = json.NewEncoder(w).Encode(horde.CreateJobResponse{ID: "job-untracked"})
+				return
+			}
+			aborted = append(aborted, r.Method+" "+r.URL.Path)
+		}))
+		defer hordeServer.Close()
+
+		cfg := *cfg
+		cfg.Horde.Host = hordeServer.URL
+		dispatcher, err := NewJobDispatcher(&cfg, logger, NewHordeService(&cfg, logger), updater, failingStorage{storage}, intake)
+		if err != nil {
+			t.Fatalf("NewJobDispatcher() error = %v", err)
+		}
+
+		if _, err := dispatcher.Submit(ctx, models.SwarmTestRequest{Changelist: "6", UpdateURL: "run-6"}, models.JobTarget{}, ""); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		dispatcher.dispatch(ctx)
+
+		if pending, _ := dispatcher.Pending(); len(pending) != 0 {
+			t.Fatalf("Pending() = %+v, want the request failed", pending)
+		}
+		if len(aborted) != 1 || !strings.Contains(aborted[0], "job-untracked") {
+			t.Errorf("Horde calls after create = %v, want the job aborted", aborted)
+		}
+		got := updater.sent()
+		if last := got[len(got)-1]; last != "run-6=fail:" {
+			t.Errorf("last Swarm update = %s, want run-6=fail:", last)
+		}
+	})
+
+	t.Run("holds requests while the API key is rejected", func(t *testing.T) {
+		unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"Token expired"}`))
+		}))
+		defer unauthorized.Close()
+
+		cfg := *cfg
+		cfg.Horde.Host = unauthorized.URL
+		dispatcher, err := NewJobDispatcher(&cfg, logger, NewHordeService(&cfg, logger), updater, storage, intake)
+		if err != nil {
+			t.Fatalf("NewJobDispatcher() error = %v", err)
+		}
+
+		if _, err := dispatcher.Submit(ctx, models.SwarmTestRequest{Changelist: "5", UpdateURL: "run-5"}, models.JobTarget{}, ""); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		dispatcher.dispatch(ctx)
+
+		pending, _ := dispatcher.Pending()
+		if len(pending) != 1 || !pending[0].Held {
+			t.Fatalf("Pending() = %+v, want the request held", pending)
+		}
+		if hordeErr := pending[0].HordeError; hordeErr == nil || hordeErr.StatusCode != http.StatusUnauthorized || hordeErr.Message != "Token expired" {
+			t.Errorf("HordeError = %+v, want 401 Token expired", hordeErr)
+		}
+		if err := intake.Remove(pending[0].ID); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("fails requests that may have reached Horde", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer failing.Close()
+
+		cfg := *cfg
+		cfg.Horde.Host = failing.URL
+		dispatcher, err := NewJobDispatcher(&cfg, logger, NewHordeService(&cfg, logger), updater, storage, intake)
+		if err != nil {
+			t.Fatalf("NewJobDispatcher() error = %v", err)
+		}
+
+		if _, err := dispatcher.Submit(ctx, models.SwarmTestRequest{Changelist: "8", UpdateURL: "run-8"}, models.JobTarget{}, ""); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		dispatcher.dispatch(ctx)
+
+		// Creating the job again could start a second one
+		if pending, _ := dispatcher.Pending(); len(pending) != 0 {
+			t.Fatalf("Pending() = %+v, want the request failed", pending)
+		}
+		if !dispatcher.holdUntil.IsZero() {
+			t.Errorf("holdUntil = %v, want requests not held", dispatcher.holdUntil)
+		}
+		got := updater.sent()
+		if last := got[len(got)-1]; last != "run-8=fail:" {
+			t.Errorf("last Swarm update = %s, want run-8=fail:", last)
+		}
+	})
+
+	t.Run("fails requests Horde forbids", func(t *testing.T) {
+		forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message":"User does not have CreateJob permission for stream"}`))
+		}))
+		defer forbidden.Close()
+
+		cfg := *cfg
+		cfg.Horde.Host = forbidden.URL
+		dispatcher, err := NewJobDispatcher(&cfg, logger, NewHordeService(&cfg, logger), updater, storage, intake)
+		if err != nil {
+			t.Fatalf("NewJobDispatcher() error = %v", err)
+		}
+
+		if _, err := dispatcher.Submit(ctx, models.SwarmTestRequest{Changelist: "7", UpdateURL: "run-7"}, models.JobTarget{}, ""); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		dispatcher.dispatch(ctx)
+
+		// Only this request is rejected; the others are not held
+		if pending, _ := dispatcher.Pending(); len(pending) != 0 {
+			t.Fatalf("Pending() = %+v, want the request failed", pending)
+		}
+		if !dispatcher.holdUntil.IsZero() {
+			t.Errorf("holdUntil = %v, want requests not held", dispatcher.holdUntil)
+		}
+		got := updater.sent()
+		if last := got[len(got)-1]; last != "run-7=fail:" {
+			t.Errorf("last Swarm update = %s, want run-7=fail:", last)
+		}
+		want := "Horde rejected the job: User does not have CreateJob permission for stream (HTTP 403)"
+		if updater.messages[0] != want {
+			t.Errorf("messages = %q, want %q", updater.messages, want)
+		}
+	})
+
+	t.Run("skips requests that already have a job", func(t *testing.T) {
+		creates := 0
+		hordeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			creates++
+			_ = json.NewEncoder(w).Encode(horde.CreateJobResponse{ID: "job-stored"})
+		}))
+		defer hordeServer.Close()
+
+		cfg := *cfg
+		cfg.Horde.Host = hordeServer.URL
+		dispatcher, err := NewJobDispatcher(&cfg, logger, NewHordeService(&cfg, logger), updater, storage, &flakyIntake{IntakeQueue: intake})
+		if err != nil {
+			t.Fatalf("NewJobDispatcher() error = %v", err)
+		}
+
+		if _, err := dispatcher.Submit(ctx, models.SwarmTestRequest{Changelist: "9", UpdateURL: "run-9"}, models.JobTarget{}, ""); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		// The job is stored, but the request stays queued
+		dispatcher.dispatch(ctx)
+		if pending, _ := dispatcher.Pending(); len(pending) != 1 {
+			t.Fatalf("Pending() = %+v, want the request left queued", pending)
+		}
+
+		dispatcher.dispatch(ctx)
+		if creates != 1 {
+			t.Errorf("Horde job creations = %d, want 1", creates)
+		}
+		if pending, _ := dispatcher.Pending(); len(pending) != 0 {
+			t.Errorf("Pending() = %+v, want the dispatched request removed", pending)
+		}
+	})
+}
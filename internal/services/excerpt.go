@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+// excerptPrefix marks log lines quoted in test run messages
+const excerptPrefix = "> "
+
+// GetLogEvents retrieves the errors and warnings Horde detected in a log
+func (s *HordeService) GetLogEvents(ctx context.Context, logID string) ([]horde.LogEvent, error) {
+	events, err := callHorde(ctx, s, "get_log_events", func(ctx context.Context) ([]horde.LogEvent, error) {
+		return s.client.GetLogEvents(ctx, logID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting horde log events: %w", err)
+	}
+	return events, nil
+}
+
+// GetLogLines retrieves count lines of a log starting at index
+func (s *HordeService) GetLogLines(ctx context.Context, logID string, index, count int) (horde.GetLogLinesResponse, error) {
+	lines, err := callHorde(ctx, s, "get_log_lines", func(ctx context.Context) (horde.GetLogLinesResponse, error) {
+		return s.client.GetLogLines(ctx, logID, index, count)
+	})
+	if err != nil {
+		return horde.GetLogLinesResponse{}, fmt.Errorf("getting horde log lines: %w", err)
+	}
+	return lines, nil
+}
+
+// StepExcerpts returns the first error lines from the logs of a job's failed
+// steps, keyed by step ID, within the configured line and size limits. Logs
+// that cannot be read are logged and left out.
+func (s *HordeService) StepExcerpts(ctx context.Context, job horde.GetJobResponse) map[string][]string {
+	limits := s.cfg.Swarm.LogExcerpt
+	if limits.Disabled || limits.MaxLines <= 0 {
+		return nil
+	}
+
+	excerpts := make(map[string][]string)
+	remaining := limits.MaxBytes
+	for _, batch := range job.Batches {
+		batchCanceled := batchResult(batch.Error) == models.StatusCanceled
+		for _, step := range batch.Steps {
+			if remaining <= 0 || ctx.Err() != nil {
+				return excerpts
+			}
+			if step.LogId == "" || stepResult(step, batchCanceled) != models.StatusFailed {
+				continue
+			}
+
+			lines, err := s.errorLines(ctx, step.LogId, limits.MaxLines)
+			if err != nil {
+				horde.LogAPIError(s.logger.Warn().Err(err), err).
+					Str("job_id", job.ID).
+					Str("step_id", step.Id).
+					Msg("failed to read step log, reporting the step without an excerpt")
+			}
+			if lines, remaining = capExcerpt(lines, remaining); len(lines) > 0 {
+				excerpts[step.Id] = lines
+			}
+		}
+	}
+	return excerpts
+}
+
+// errorLines returns up to maxLines lines of the error events of a log,
+// fetching the lines of events Horde reports without them
+func (s *HordeService) errorLines(ctx context.Context, logID string, maxLines int) ([]string, error) {
+	events, err := s.GetLogEvents(ctx, logID)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, event := range events {
+		if len(lines) >= maxLines {
+			break
+		}
+		if !strings.EqualFold(event.Severity, horde.SeverityError) {
+			continue
+		}
+
+		eventLines := event.Lines
+		if len(eventLines) == 0 && event.LineCount > 0 {
+			resp, err := s.GetLogLines(ctx, logID, event.LineIndex, min(event.LineCount, maxLines-len(lines)))
+			if err != nil {
+				return lines, err
+			}
+			eventLines = resp.Lines
+		}
+		lines = appendLogLines(lines, eventLines, maxLines)
+	}
+	return lines, nil
+}
+
+// appendLogLines adds the non-empty messages of log lines to lines, up to maxLines
+func appendLogLines(lines []string, logLines []horde.LogLine, maxLines int) []string {
+	for _, line := range logLines {
+		if len(lines) >= maxLines {
+			break
+		}
+		if message := strings.TrimSpace(line.Message); message != "" {
+			lines = append(lines, message)
+		}
+	}
+	return lines
+}
+
+// capExcerpt keeps the lines that fit in remaining bytes, cutting the first
+// line that does not, and returns the bytes left afterwards
+func capExcerpt(lines []string, remaining int) ([]string, int) {
+	var kept []string
+	for _, line := range lines {
+		if remaining <= 0 {
+			break
+		}
+		if len(line) > remaining {
+			line = truncateBytes(line, remaining)
+		}
+		kept = append(kept, line)
+		remaining -= len(line)
+	}
+	return kept, remaining
+}
+
+// truncateBytes shortens message to at most maxBytes bytes without splitting
+// a UTF-8 sequence, marking the cut with "..." where there is room
+func truncateBytes(message string, maxBytes int) string {
+	if len(message) <= maxBytes {
+		return message
+	}
+	suffix := "..."
+	if maxBytes <= len(suffix) {
+		suffix = ""
+	}
+	cut := maxBytes - len(suffix)
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+	return message[:cut] + suffix
+}
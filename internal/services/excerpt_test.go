@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+)
+
+func TestStepExcerpts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/logs/log-1/events":
+			_, _ = w.Write([]byte(`[
+				{"severity":"Warning","lineIndex":3,"lineCount":1,"lines":[{"message":"warning: deprecated"}]},
+				{"severity":"Error","lineIndex":10,"lineCount":2,"lines":[{"message":"  error C2065: 'x': undeclared identifier  "},{"message":""}]},
+				{"severity":"Error","lineIndex":20,"lineCount":3}
+			]`))
+		case "/api/v1/logs/log-1/lines":
+			if r.URL.Query().Get("index") != "20" || r.URL.Query().Get("count") != "2" {
+				t.Errorf("lines query = %s, want index 20 and the 2 lines still allowed", r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(`{"index":20,"count":2,"lines":[{"message":"error: link failed"},{"message":"error: 1 unresolved external"}]}`))
+		case "/api/v1/logs/log-2/events":
+			http.Error(w, "log expired", http.StatusNotFound)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	job := horde.GetJobResponse{
+		ID: "job-1",
+		Batches: []horde.Batch{{
+			Id:    "b1",
+			Error: horde.BatchErrorNone,
+			Steps: []horde.Step{
+				{Id: "s1", Outcome: horde.OutcomeSuccess, LogId: "log-0"},
+				{Id: "s2", Outcome: horde.OutcomeFailure, LogId: "log-1"},
+				{Id: "s3", Outcome: horde.OutcomeFailure, LogId: "log-2"},
+			},
+		}},
+	}
+
+	newService := func(limits config.LogExcerptConfig) *HordeService {
+		return NewHordeService(&config.Config{
+			Horde: config.HordeConfig{Host: server.URL, APIKey: "key"},
+			Swarm: config.SwarmConfig{LogExcerpt: limits},
+			Retry: config.RetryConfig{MaxAttempts: 1},
+		}, zerolog.Nop())
+	}
+
+	t.Run("first error lines", func(t *testing.T) {
+		got := newService(config.LogExcerptConfig{MaxLines: 3, MaxBytes: 1024}).StepExcerpts(context.Background(), job)
+		want := map[string][]string{"s2": {"error C2065: 'x': undeclared identifier", "error: link failed", "error: 1 unresolved external"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("StepExcerpts() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		got := newService(config.LogExcerptConfig{MaxLines: 1, MaxBytes: 15}).StepExcerpts(context.Background(), job)
+		want := map[string][]string{"s2": {"error C2065:..."}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("StepExcerpts() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		got := newService(config.LogExcerptConfig{Disabled: true, MaxLines: 3, MaxBytes: 1024}).StepExcerpts(context.Background(), job)
+		if len(got) != 0 {
+			t.Errorf("StepExcerpts() = %q, want none", got)
+		}
+	})
+}
+
+func TestTruncateBytes(t *testing.T) {
+	tests := []struct {
+		message  string
+		maxBytes int
+		want     string
+	}{
+		{message: "short", maxBytes: 10, want: "short"},
+		{message: "exactly ten", maxBytes: 8, want: "exact..."},
+		{message: "héllo wörld", maxBytes: 5, want: "h..."},
+		{message: "abcdef", maxBytes: 2, want: "ab"},
+	}
+
+	for _, tt := range tests {
+		if got := truncateBytes(tt.message, tt.maxBytes); got != tt.want {
+			t.Errorf("truncateBytes(%q, %d) = %q, want %q", tt.message, tt.maxBytes, got, tt.want)
+		}
+	}
+}
@@ -2,21 +2,27 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/metrics"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/retry"
 )
 
 // HordeService manages interactions with the Horde CI system
 type HordeService struct {
-	client *horde.Client
-	cfg    *config.Config
-	logger zerolog.Logger
+	client  *horde.Client
+	breaker *CircuitBreaker
+	cfg     *config.Config
+	logger  zerolog.Logger
 }
 
 // NewHordeService creates a new instance of HordeService
@@ -29,36 +35,45 @@ func NewHordeService(cfg *config.Config, logger zerolog.Logger) *HordeService {
 	)
 
 	return &HordeService{
-		client: client,
-		cfg:    cfg,
-		logger: logger,
+		client:  client,
+		breaker: NewCircuitBreaker(cfg, logger),
+		cfg:     cfg,
+		logger:  logger,
 	}
 }
 
-// CreateJob creates a new job in the Horde system
-func (s *HordeService) CreateJob(ctx context.Context, change string) (string, error) {
+// BreakerState returns the state of the circuit breaker around Horde calls
+func (s *HordeService) BreakerState() BreakerState {
+	return s.breaker.State()
+}
+
+// CreateJob creates a new job in the Horde system from a job specification
+func (s *HordeService) CreateJob(ctx context.Context, spec JobSpec) (string, error) {
+	change := spec.Change
 	s.logger.Debug().Msgf("Preparing job creation request for change: %s", change)
 
 	req := horde.CreateJobRequest{
-		TemplateId:      s.cfg.Horde.TemplateId,
-		StreamId:        s.cfg.Horde.StreamId,
-		Name:            "swarm-preflight",
+		TemplateId:      spec.Target.TemplateId,
+		StreamId:        spec.Target.StreamId,
+		Name:            spec.Name,
 		PreflightChange: change,
 		AutoSubmit:      false,
+		Arguments:       spec.Arguments,
 	}
 	s.logger.Debug().Msgf("Job creation request payload: %+v", req)
 
-	jobID, err := s.withRetry(ctx, func() (string, error) {
+	// Creating a job is not idempotent: a request that reached Horde may have
+	// created the job even though it failed, so only failures to connect are retried
+	policy := retryPolicy(s.cfg, s.logger, "horde", "create_job")
+	policy.Retryable = connectFailed
+	jobIDStr, err := callHordeWith(ctx, s, policy, "create_job", func(ctx context.Context) (string, error) {
 		return s.client.CreateJob(ctx, req)
 	})
 	if err != nil {
+		metrics.HordeJobCreateFailures.Inc()
 		return "", fmt.Errorf("creating horde job: %w", err)
 	}
-
-	jobIDStr, ok := jobID.(string)
-	if !ok {
-		return "", fmt.Errorf("expected jobID to be a string")
-	}
+	metrics.HordeJobsCreated.Inc()
 
 	s.logger.Info().Msgf("Horde job created with ID: %s for change: %s", jobIDStr, change)
 	s.logger.Debug().Msgf("Job ID returned from Horde: %s", jobIDStr)
@@ -71,157 +86,142 @@ func (s *HordeService) CreateJob(ctx context.Context, change string) (string, er
 	return jobIDStr, nil
 }
 
-// GetJobStatus retrieves the current status of a job
-func (s *HordeService) GetJobStatus(ctx context.Context, jobID string) (models.JobStatus, error) {
-	s.logger.Debug().Str("job_id", jobID).Msg("Starting GetJobStatus for job.")
+// GetJob retrieves the full details of a job from Horde
+func (s *HordeService) GetJob(ctx context.Context, jobID string) (horde.GetJobResponse, error) {
+	s.logger.Debug().Str("job_id", jobID).Msg("Starting GetJob for job.")
 
-	resp, err := s.withRetry(ctx, func() (horde.GetJobResponse, error) {
+	respTyped, err := callHorde(ctx, s, "get_job", func(ctx context.Context) (horde.GetJobResponse, error) {
 		s.logger.Debug().Str("job_id", jobID).Msg("Sending request to Horde to get job status.")
 		return s.client.GetJobStatus(ctx, jobID)
 	})
 
 	if err != nil {
-		s.logger.Error().Err(err).
+		horde.LogAPIError(s.logger.Error().Err(err), err).
 			Str("job_id", jobID).
 			Msg("Error retrieving job status from Horde.")
-		return models.StatusUnknown, fmt.Errorf("getting horde job status: %w", err)
-	}
-
-	respTyped, ok := resp.(horde.GetJobResponse)
-	if !ok {
-		s.logger.Error().
-			Str("job_id", jobID).
-			Msg("Failed to assert response as GetJobResponse.")
-		return models.StatusUnknown, fmt.Errorf("expected response to be of type horde.GetJobResponse")
+		return horde.GetJobResponse{}, fmt.Errorf("getting horde job status: %w", err)
 	}
 
 	s.logger.Debug().
 		Interface("response", respTyped).
 		Msg("Detailed job response from Horde")
 
-	// Check for cancellation
-	if wasCancelled(respTyped) {
-		s.logger.Info().Str("job_id", jobID).Msg("Job was cancelled.")
-		return models.StatusFailed, nil
+	return respTyped, nil
+}
+
+// GetJobGraph retrieves the graph of a job from Horde
+func (s *HordeService) GetJobGraph(ctx context.Context, jobID string) (horde.GetGraphResponse, error) {
+	graph, err := callHorde(ctx, s, "get_graph", func(ctx context.Context) (horde.GetGraphResponse, error) {
+		return s.client.GetJobGraph(ctx, jobID)
+	})
+	if err != nil {
+		return horde.GetGraphResponse{}, fmt.Errorf("getting horde job graph: %w", err)
+	}
+	return graph, nil
+}
+
+// GetStep retrieves the details of a single step of a job from Horde
+func (s *HordeService) GetStep(ctx context.Context, jobID, batchID, stepID string) (horde.Step, error) {
+	step, err := callHorde(ctx, s, "get_step", func(ctx context.Context) (horde.Step, error) {
+		return s.client.GetStep(ctx, jobID, batchID, stepID)
+	})
+	if err != nil {
+		return horde.Step{}, fmt.Errorf("getting horde step: %w", err)
+	}
+	return step, nil
+}
+
+// NameSteps names the steps of a job from its graph so reports show node
+// names rather than step IDs. A graph that cannot be fetched is logged and
+// leaves the job unchanged.
+func (s *HordeService) NameSteps(ctx context.Context, job *horde.GetJobResponse) {
+	graph, err := s.GetJobGraph(ctx, job.ID)
+	if err != nil {
+		horde.LogAPIError(s.logger.Warn().Err(err), err).
+			Str("job_id", job.ID).
+			Msg("failed to get job graph, reporting steps by ID")
+		return
 	}
+	job.NameSteps(graph)
+}
 
-	// Check for errors in batches
-	if hasErrors(respTyped) {
-		s.logger.Info().Str("job_id", jobID).Msg("Job has errors in batches.")
-		return models.StatusFailed, nil
+// GetJobStatus retrieves the current status of a job
+func (s *HordeService) GetJobStatus(ctx context.Context, jobID string) (models.JobStatus, error) {
+	job, err := s.GetJob(ctx, jobID)
+	if err != nil {
+		return models.StatusUnknown, err
 	}
+	return s.JobStatus(job), nil
+}
 
-	// Map job state to internal status
-	jobStatus := mapHordeState(respTyped.State)
+// JobStatus maps a Horde job response to the internal job status
+func (s *HordeService) JobStatus(job horde.GetJobResponse) models.JobStatus {
+	jobStatus := EvaluateJob(job)
 	s.logger.Debug().
-		Str("job_id", jobID).
-		Str("state", respTyped.State).
+		Str("job_id", job.ID).
+		Str("state", job.State).
 		Str("mapped_status", string(jobStatus)).
 		Msg("Retrieved and mapped job status from Horde.")
 
-	return jobStatus, nil
+	return jobStatus
 }
 
-// wasCancelled checks if the job or any step in its batches was canceled
-func wasCancelled(job horde.GetJobResponse) bool {
-	if job.AbortedByUserId != nil {
-		return true
-	}
-	for _, batch := range job.Batches {
-		for _, step := range batch.Steps {
-			if step.AbortedByUserId != nil {
-				return true
-			}
-		}
+// AbortJob cancels a Horde job
+func (s *HordeService) AbortJob(ctx context.Context, jobID string, reason string) error {
+	s.logger.Debug().Str("job_id", jobID).Str("reason", reason).Msg("Aborting Horde job.")
+
+	_, err := callHorde(ctx, s, "abort_job", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.client.AbortJob(ctx, jobID, reason)
+	})
+	if err != nil {
+		return fmt.Errorf("aborting horde job: %w", err)
 	}
-	return false
+
+	s.logger.Info().Str("job_id", jobID).Msg("Horde job aborted")
+	return nil
 }
 
-// hasErrors checks if any batch and steps in the job have errors
-func hasErrors(job horde.GetJobResponse) bool {
-	for _, batch := range job.Batches {
-		if batch.Error != "None" {
-			return true
-		}
-		for _, step := range batch.Steps {
-			if step.Outcome == "Failure" {
-				return true
-			}
-		}
-	}
-	return false
+// callHorde makes a Horde API call through the circuit breaker, retrying
+// transient failures
+func callHorde[T any](ctx context.Context, s *HordeService, operation string, call func(ctx context.Context) (T, error)) (T, error) {
+	return callHordeWith(ctx, s, retryPolicy(s.cfg, s.logger, "horde", operation), operation, call)
 }
 
-// withRetry implements retry logic for operations
-func (s *HordeService) withRetry(ctx context.Context, op interface{}) (interface{}, error) {
-	var lastErr error
-	var result interface{}
-
-	for attempt := 0; attempt < s.cfg.Retry.MaxAttempts; attempt++ {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
-			switch fn := op.(type) {
-			case func() (string, error):
-				if r, err := fn(); err == nil {
-					return r, nil
-				} else {
-					lastErr = err
-				}
-			case func() (horde.GetJobResponse, error):
-				if r, err := fn(); err == nil {
-					return r, nil
-				} else {
-					lastErr = err
-				}
-			default:
-				return nil, fmt.Errorf("unsupported operation type")
-			}
-
-			if attempt < s.cfg.Retry.MaxAttempts-1 {
-				delay := getBackoffDelay(attempt, s.cfg)
-				s.logger.Debug().
-					Int("attempt", attempt+1).
-					Dur("delay", delay).
-					Msg("retrying operation")
-
-				select {
-				case <-ctx.Done():
-					return nil, ctx.Err()
-				case <-time.After(delay):
-					continue
-				}
-			}
+// callHordeWith makes a Horde API call through the circuit breaker, retrying
+// as policy allows
+func callHordeWith[T any](ctx context.Context, s *HordeService, policy retry.Policy, operation string, call func(ctx context.Context) (T, error)) (T, error) {
+	return retry.Do(ctx, policy, func(ctx context.Context) (T, error) {
+		// Fail fast instead of retrying while Horde is known to be down
+		if err := s.breaker.Allow(); err != nil {
+			var zero T
+			return zero, retry.Permanent(err)
 		}
-	}
 
-	if lastErr == nil {
-		return nil, fmt.Errorf("max retries exceeded without specific error")
-	}
-	return result, fmt.Errorf("max retries exceeded: %w", lastErr)
+		timer := prometheus.NewTimer(metrics.HordeRequestDuration.WithLabelValues(operation))
+		result, err := call(ctx)
+		timer.ObserveDuration()
+		s.recordOutcome(ctx, err)
+		return result, err
+	})
 }
 
-// getBackoffDelay calculates the exponential backoff delay
-func getBackoffDelay(attempt int, cfg *config.Config) time.Duration {
-	delay := time.Duration(cfg.Retry.InitialDelay) * time.Second * (1 << uint(attempt))
-	maxDelay := time.Duration(cfg.Retry.MaxDelay) * time.Second
-	if delay > maxDelay {
-		delay = maxDelay
-	}
-	return delay
+// connectFailed reports whether err is a failure to connect to Horde, which
+// proves the request was never sent
+func connectFailed(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
 }
 
-// mapHordeState maps Horde's job state to the internal job status
-func mapHordeState(state string) models.JobStatus {
-	switch state {
-	case "Running":
-		return models.StatusRunning
-	case "Complete":
-		return models.StatusCompleted
-	case "Waiting":
-		return models.StatusPending
+// recordOutcome tells the circuit breaker whether a call reached Horde. Calls
+// canceled by the caller say nothing about Horde and are not counted, and
+// permanent errors such as 404 mean Horde is answering.
+func (s *HordeService) recordOutcome(ctx context.Context, err error) {
+	switch {
+	case err == nil || retry.IsPermanent(err):
+		s.breaker.Success()
+	case ctx.Err() != nil:
+		s.breaker.Release()
 	default:
-		return models.StatusUnknown
+		s.breaker.Failure()
 	}
 }
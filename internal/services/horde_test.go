@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,6 +11,7 @@ import (
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/retry"
 	"github.com/rs/zerolog"
 )
 
@@ -27,6 +29,16 @@ func TestHordeService(t *testing.T) {
 			if r.Header.Get("Authorization") != "ServiceAccount test-key" {
 				t.Errorf("Expected Authorization header, got %s", r.Header.Get("Authorization"))
 			}
+			var req horde.CreateJobRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("failed to decode request body: %v", err)
+			}
+			if req.StreamId != "test-stream" || req.TemplateId != "test-template" {
+				t.Errorf("Expected routed stream and template, got %s/%s", req.StreamId, req.TemplateId)
+			}
+			if req.Name != "Review 42 v2 - CL test-change" || len(req.Arguments) != 1 || req.Arguments[0] != "-set:ReviewId=42" {
+				t.Errorf("Expected job name and arguments from spec, got %q %v", req.Name, req.Arguments)
+			}
 
 			// Return test response
 			resp := horde.GetJobResponse{
@@ -52,7 +64,13 @@ func TestHordeService(t *testing.T) {
 		}
 
 		service := NewHordeService(cfg, logger)
-		jobID, err := service.CreateJob(context.Background(), "test-change")
+		spec := JobSpec{
+			Change:    "test-change",
+			Target:    models.JobTarget{StreamId: "test-stream", TemplateId: "test-template"},
+			Name:      "Review 42 v2 - CL test-change",
+			Arguments: []string{"-set:ReviewId=42"},
+		}
+		jobID, err := service.CreateJob(context.Background(), spec)
 		if err != nil {
 			t.Fatalf("CreateJob() error = %v", err)
 		}
@@ -61,6 +79,32 @@ func TestHordeService(t *testing.T) {
 		}
 	})
 
+	t.Run("CreateJob retries only unsent requests", func(t *testing.T) {
+		// Horde may have created the job before failing, so a retry could start it twice
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		cfg := &config.Config{
+			Horde: config.HordeConfig{Host: server.URL},
+			Retry: config.RetryConfig{MaxAttempts: 3, InitialDelay: 0.001, MaxDelay: 0.001},
+		}
+		if _, err := NewHordeService(cfg, logger).CreateJob(context.Background(), JobSpec{}); err == nil || calls != 1 {
+			t.Errorf("CreateJob() error = %v after %d calls, want a failure after 1", err, calls)
+		}
+
+		// Nothing listens on a closed server, so the request never reached Horde
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		cfg.Horde.Host = closed.URL
+		if _, err := NewHordeService(cfg, logger).CreateJob(context.Background(), JobSpec{}); retry.Attempts(err) != 3 {
+			t.Errorf("CreateJob() error = %v after %d attempts, want 3 attempts", err, retry.Attempts(err))
+		}
+	})
+
 	t.Run("GetJobStatus", func(t *testing.T) {
 		tests := []struct {
 			name     string
@@ -124,4 +168,72 @@ func TestHordeService(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("circuit breaker fails fast", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		cfg := &config.Config{
+			Horde: config.HordeConfig{
+				Host:    server.URL,
+				APIKey:  "test-key",
+				Breaker: config.BreakerConfig{FailureThreshold: 2, OpenTimeout: 60},
+			},
+			Retry: config.RetryConfig{MaxAttempts: 3},
+			Clock: config.RealClock{},
+		}
+
+		service := NewHordeService(cfg, logger)
+		_, err := service.GetJob(context.Background(), "test-job-id")
+		if !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("GetJob() error = %v, want ErrCircuitOpen once the breaker opened", err)
+		}
+		if calls != 2 {
+			t.Errorf("Horde called %d times, want 2 before the breaker opened", calls)
+		}
+		if state := service.BreakerState(); state != BreakerOpen {
+			t.Errorf("BreakerState() = %s, want open", state)
+		}
+
+		if _, err := service.CreateJob(context.Background(), JobSpec{}); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("CreateJob() error = %v, want ErrCircuitOpen", err)
+		}
+		if calls != 2 {
+			t.Errorf("Horde called %d times while the breaker was open, want none", calls-2)
+		}
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		cfg := &config.Config{
+			Horde: config.HordeConfig{
+				Host:    server.URL,
+				APIKey:  "test-key",
+				Breaker: config.BreakerConfig{FailureThreshold: 1, OpenTimeout: 60},
+			},
+			Retry: config.RetryConfig{MaxAttempts: 3},
+			Clock: config.RealClock{},
+		}
+
+		service := NewHordeService(cfg, logger)
+		if _, err := service.GetJob(context.Background(), "missing-job"); err == nil {
+			t.Fatal("GetJob() expected error for missing job")
+		}
+		if calls != 1 {
+			t.Errorf("Horde called %d times, want 1", calls)
+		}
+		if state := service.BreakerState(); state != BreakerClosed {
+			t.Errorf("BreakerState() = %s, want closed as Horde answered", state)
+		}
+	})
 }
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+// IntakeQueue holds accepted Swarm test requests until their Horde job is created
+type IntakeQueue interface {
+	// Add assigns the request an ID and queues it
+	Add(req *models.IntakeRequest) error
+	// Pending returns the queued requests, oldest first
+	Pending() ([]*models.IntakeRequest, error)
+	// Update saves the attempts of a queued request
+	Update(req *models.IntakeRequest) error
+	// Remove drops a request from the queue
+	Remove(id string) error
+}
+
+// NewIntakeQueue creates an intake queue kept alongside the job storage, so
+// requests are persisted whenever job mappings are
+func NewIntakeQueue(jobStorage JobStorage) (IntakeQueue, error) {
+	if storage, ok := jobStorage.(*BoltJobStorage); ok {
+		return newBoltIntakeQueue(storage.db)
+	}
+	return NewMemoryIntakeQueue(), nil
+}
+
+// MemoryIntakeQueue keeps queued requests in memory
+type MemoryIntakeQueue struct {
+	mu       sync.Mutex
+	seq      uint64
+	requests map[string]*models.IntakeRequest
+}
+
+// NewMemoryIntakeQueue creates a new in-memory intake queue
+func NewMemoryIntakeQueue() *MemoryIntakeQueue {
+	return &MemoryIntakeQueue{
+		requests: make(map[string]*models.IntakeRequest),
+	}
+}
+
+// Add queues a request
+func (q *MemoryIntakeQueue) Add(req *models.IntakeRequest) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	req.ID = strconv.FormatUint(q.seq, 10)
+	c := *req
+	q.requests[req.ID] = &c
+	return nil
+}
+
+// Pending returns the queued requests, oldest first
+func (q *MemoryIntakeQueue) Pending() ([]*models.IntakeRequest, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return sortedRequests(q.requests), nil
+}
+
+// Update saves the attempts of a queued request
+func (q *MemoryIntakeQueue) Update(req *models.IntakeRequest) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, exists := q.requests[req.ID]; exists {
+		c := *req
+		q.requests[req.ID] = &c
+	}
+	return nil
+}
+
+// Remove drops a request from the queue
+func (q *MemoryIntakeQueue) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.requests, id)
+	return nil
+}
+
+// sortedRequests returns copies of the requests in the order they were queued
+func sortedRequests(requests map[string]*models.IntakeRequest) []*models.IntakeRequest {
+	sorted := make([]*models.IntakeRequest, 0, len(requests))
+	for _, req := range requests {
+		c := *req
+		sorted = append(sorted, &c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, _ := strconv.ParseUint(sorted[i].ID, 10, 64)
+		b, _ := strconv.ParseUint(sorted[j].ID, 10, 64)
+		return a < b
+	})
+	return sorted
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+var intakeBucket = []byte("intake")
+
+// BoltIntakeQueue persists queued requests in the bolt job database so that
+// requests accepted while Horde is unavailable survive bridge restarts
+type BoltIntakeQueue struct {
+	db *bolt.DB
+}
+
+func newBoltIntakeQueue(db *bolt.DB) (*BoltIntakeQueue, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(intakeBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating intake bucket: %w", err)
+	}
+	return &BoltIntakeQueue{db: db}, nil
+}
+
+// Add queues a request
+func (q *BoltIntakeQueue) Add(req *models.IntakeRequest) error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(intakeBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		req.ID = strconv.FormatUint(seq, 10)
+		return putRequest(bucket, req)
+	})
+	if err != nil {
+		return fmt.Errorf("queueing intake request: %w", err)
+	}
+	return nil
+}
+
+// Pending returns the queued requests, oldest first
+func (q *BoltIntakeQueue) Pending() ([]*models.IntakeRequest, error) {
+	requests := make(map[string]*models.IntakeRequest)
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(intakeBucket).ForEach(func(k, v []byte) error {
+			req := &models.IntakeRequest{}
+			if err := json.Unmarshal(v, req); err != nil {
+				return fmt.Errorf("decoding intake request %s: %w", k, err)
+			}
+			requests[req.ID] = req
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing intake requests: %w", err)
+	}
+	return sortedRequests(requests), nil
+}
+
+// Update saves the attempts of a queued request
+func (q *BoltIntakeQueue) Update(req *models.IntakeRequest) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(intakeBucket)
+		if bucket.Get([]byte(req.ID)) == nil {
+			return nil
+		}
+		return putRequest(bucket, req)
+	})
+}
+
+// Remove drops a request from the queue
+func (q *BoltIntakeQueue) Remove(id string) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(intakeBucket).Delete([]byte(id))
+	})
+}
+
+func putRequest(bucket *bolt.Bucket, req *models.IntakeRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshaling intake request: %w", err)
+	}
+	return bucket.Put([]byte(req.ID), data)
+}
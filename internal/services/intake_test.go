@@ -0,0 +1,97 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+func TestIntakeQueue(t *testing.T) {
+	backends := map[string]func(t *testing.T) IntakeQueue{
+		"memory": func(t *testing.T) IntakeQueue {
+			return NewMemoryIntakeQueue()
+		},
+		"bolt": func(t *testing.T) IntakeQueue {
+			storage, err := NewBoltJobStorage(filepath.Join(t.TempDir(), "jobs.db"))
+			if err != nil {
+				t.Fatalf("NewBoltJobStorage() error = %v", err)
+			}
+			t.Cleanup(func() { storage.Close() })
+
+			intake, err := NewIntakeQueue(storage)
+			if err != nil {
+				t.Fatalf("NewIntakeQueue() error = %v", err)
+			}
+			return intake
+		},
+	}
+
+	received := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, newIntake := range backends {
+		t.Run(name, func(t *testing.T) {
+			intake := newIntake(t)
+
+			// Enough requests that string ordering of IDs would differ
+			var ids []string
+			for i := 0; i < 11; i++ {
+				req := &models.IntakeRequest{
+					SwarmTest:  models.SwarmTestRequest{Changelist: "1"},
+					ReceivedAt: received,
+				}
+				if err := intake.Add(req); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+				if req.ID == "" {
+					t.Fatal("Add() did not assign an ID")
+				}
+				ids = append(ids, req.ID)
+			}
+
+			pending, err := intake.Pending()
+			if err != nil {
+				t.Fatalf("Pending() error = %v", err)
+			}
+			if len(pending) != len(ids) {
+				t.Fatalf("Pending() returned %d requests, want %d", len(pending), len(ids))
+			}
+			for i, req := range pending {
+				if req.ID != ids[i] {
+					t.Fatalf("Pending()[%d] = %s, want %s", i, req.ID, ids[i])
+				}
+			}
+
+			first := pending[0]
+			first.Attempts = 2
+			first.LastError = "horde unavailable"
+			if err := intake.Update(first); err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+			if err := intake.Remove(ids[1]); err != nil {
+				t.Fatalf("Remove() error = %v", err)
+			}
+
+			pending, err = intake.Pending()
+			if err != nil {
+				t.Fatalf("Pending() error = %v", err)
+			}
+			if len(pending) != len(ids)-1 || pending[1].ID != ids[2] {
+				t.Fatalf("Pending() after Remove() = %d requests starting %s, %s", len(pending), pending[0].ID, pending[1].ID)
+			}
+			if pending[0].Attempts != 2 || pending[0].LastError != "horde unavailable" || !pending[0].ReceivedAt.Equal(received) {
+				t.Errorf("Pending()[0] = %+v, want updated attempts", pending[0])
+			}
+
+			// Updating a removed request does not queue it again
+			removed := &models.IntakeRequest{ID: ids[1], Attempts: 1}
+			if err := intake.Update(removed); err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+			if pending, _ := intake.Pending(); len(pending) != len(ids)-1 {
+				t.Errorf("Update() of removed request queued it again")
+			}
+		})
+	}
+}
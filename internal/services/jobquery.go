@@ -0,0 +1,221 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+// Fields jobs can be sorted by
+const (
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+)
+
+// MaxJobPageSize bounds the number of jobs returned in one page
+const MaxJobPageSize = 1000
+
+// ErrInvalidCursor is returned for a cursor that was not issued for the query's sort and order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// JobQuery selects, sorts and pages tracked jobs. Empty fields match every job.
+type JobQuery struct {
+	Statuses   []models.JobStatus
+	Changelist string
+	ReviewID   string
+	TemplateID string
+	// CreatedAfter and CreatedBefore bound the creation time of the jobs
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Sort is SortCreatedAt or SortUpdatedAt; Descending lists the newest jobs first
+	Sort       string
+	Descending bool
+	// Limit is the page size, or 0 for every matching job; Cursor continues
+	// after the last job of the previous page
+	Limit  int
+	Cursor string
+}
+
+// JobPage is one page of jobs matching a query
+type JobPage struct {
+	Jobs []*models.JobMapping
+	// NextCursor fetches the next page, or is empty on the last page
+	NextCursor string
+}
+
+// ParseJobQuery reads a query from the status, changelist, review_id,
+// template_id, created_after, created_before, sort, order, limit and cursor
+// parameters. Statuses may be repeated or comma-separated and times are RFC 3339.
+func ParseJobQuery(values url.Values) (JobQuery, error) {
+	q := JobQuery{
+		Changelist: values.Get("changelist"),
+		ReviewID:   values.Get("review_id"),
+		TemplateID: values.Get("template_id"),
+		Sort:       SortCreatedAt,
+		Descending: true,
+		Cursor:     values.Get("cursor"),
+	}
+
+	for _, value := range values["status"] {
+		for _, status := range strings.Split(value, ",") {
+			if !isJobStatus(models.JobStatus(status)) {
+				return JobQuery{}, fmt.Errorf("invalid status: %s", status)
+			}
+			q.Statuses = append(q.Statuses, models.JobStatus(status))
+		}
+	}
+
+	for name, t := range map[string]*time.Time{"created_after": &q.CreatedAfter, "created_before": &q.CreatedBefore} {
+		if value := values.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return JobQuery{}, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*t = parsed
+		}
+	}
+
+	if sortBy := values.Get("sort"); sortBy != "" {
+		if sortBy != SortCreatedAt && sortBy != SortUpdatedAt {
+			return JobQuery{}, fmt.Errorf("invalid sort: %s", sortBy)
+		}
+		q.Sort = sortBy
+	}
+	switch order := values.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		q.Descending = false
+	default:
+		return JobQuery{}, fmt.Errorf("invalid order: %s", order)
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxJobPageSize {
+			return JobQuery{}, fmt.Errorf("invalid limit: must be between 1 and %d", MaxJobPageSize)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+func isJobStatus(status models.JobStatus) bool {
+	for _, s := range models.JobStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether a job passes the query's filters
+func (q JobQuery) Matches(job *models.JobMapping) bool {
+	if len(q.Statuses) > 0 && !hasStatus(q.Statuses, job.Status) {
+		return false
+	}
+	return (q.Changelist == "" || job.SwarmTest.Changelist == q.Changelist) &&
+		(q.ReviewID == "" || job.SwarmTest.ReviewID == q.ReviewID) &&
+		(q.TemplateID == "" || job.Target.TemplateId == q.TemplateID) &&
+		(q.CreatedAfter.IsZero() || !job.CreatedAt.Before(q.CreatedAfter)) &&
+		(q.CreatedBefore.IsZero() || job.CreatedAt.Before(q.CreatedBefore))
+}
+
+func hasStatus(statuses []models.JobStatus, status models.JobStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryJobs filters, sorts and pages jobs. Jobs with the same sort time are
+// ordered by job ID, so pages are stable while jobs are added or removed.
+func QueryJobs(jobs []*models.JobMapping, q JobQuery) (JobPage, error) {
+	matched := make([]*models.JobMapping, 0, len(jobs))
+	for _, job := range jobs {
+		if q.Matches(job) {
+			matched = append(matched, job)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return q.before(matched[i], matched[j])
+	})
+
+	if q.Cursor != "" {
+		after, err := q.decodeCursor(q.Cursor)
+		if err != nil {
+			return JobPage{}, err
+		}
+		// Skip to the first job sorted after the cursor
+		start := sort.Search(len(matched), func(i int) bool {
+			return q.before(after, matched[i])
+		})
+		matched = matched[start:]
+	}
+
+	page := JobPage{Jobs: matched}
+	if q.Limit > 0 && len(matched) > q.Limit {
+		page.Jobs = matched[:q.Limit]
+		page.NextCursor = q.encodeCursor(page.Jobs[q.Limit-1])
+	}
+	return page, nil
+}
+
+// before reports whether job a sorts before job b
+func (q JobQuery) before(a, b *models.JobMapping) bool {
+	ta, tb := q.sortTime(a), q.sortTime(b)
+	if !ta.Equal(tb) {
+		return ta.Before(tb) != q.Descending
+	}
+	return a.HordeJobID < b.HordeJobID
+}
+
+func (q JobQuery) sortTime(job *models.JobMapping) time.Time {
+	if q.Sort == SortUpdatedAt {
+		return job.UpdatedAt
+	}
+	return job.CreatedAt
+}
+
+func (q JobQuery) order() string {
+	if q.Descending {
+		return "desc"
+	}
+	return "asc"
+}
+
+// encodeCursor identifies a job by the query's sort and order, the job's sort
+// time and its ID
+func (q JobQuery) encodeCursor(job *models.JobMapping) string {
+	parts := []string{q.Sort, q.order(), strconv.FormatInt(q.sortTime(job).UnixNano(), 10), job.HordeJobID}
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(parts, ":")))
+}
+
+// decodeCursor returns a placeholder job at the position a cursor identifies.
+// A cursor issued for another sort or order is rejected, as its position
+// means nothing in this one.
+func (q JobQuery) decodeCursor(cursor string) (*models.JobMapping, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(data), ":", 4)
+	if len(parts) != 4 || parts[0] != q.Sort || parts[1] != q.order() {
+		return nil, ErrInvalidCursor
+	}
+	nanos, jobID := parts[2], parts[3]
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	t := time.Unix(0, n)
+	return &models.JobMapping{HordeJobID: jobID, CreatedAt: t, UpdatedAt: t}, nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+func TestQueryJobs(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	job := func(id, review string, status models.JobStatus, created int) *models.JobMapping {
+		return &models.JobMapping{
+			HordeJobID: id,
+			SwarmTest:  models.SwarmTestRequest{Changelist: "100", ReviewID: review},
+			Target:     models.JobTarget{TemplateId: "preflight"},
+			Status:     status,
+			CreatedAt:  base.Add(time.Duration(created) * time.Hour),
+			UpdatedAt:  base.Add(time.Duration(10-created) * time.Hour),
+		}
+	}
+	jobs := []*models.JobMapping{
+		job("job-c", "42", models.StatusRunning, 2),
+		job("job-a", "42", models.StatusPending, 1),
+		job("job-b", "42", models.StatusRunning, 2),
+		job("job-d", "43", models.StatusRunning, 3),
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr string
+	}{
+		{name: "newest first by default", query: "", want: "job-d job-b job-c job-a"},
+		{name: "oldest first", query: "order=asc", want: "job-a job-b job-c job-d"},
+		{name: "by update time", query: "sort=updated_at", want: "job-a job-b job-c job-d"},
+		{name: "by review and status", query: "review_id=42&status=running,pending", want: "job-b job-c job-a"},
+		{name: "by creation time", query: "created_after=2024-01-01T02:00:00Z&created_before=2024-01-01T03:00:00Z", want: "job-b job-c"},
+		{name: "by template", query: "template_id=nightly", want: ""},
+		{name: "invalid status", query: "status=done", wantErr: "invalid status"},
+		{name: "invalid limit", query: "limit=0", wantErr: "invalid limit"},
+		{name: "invalid time", query: "created_after=yesterday", wantErr: "invalid created_after"},
+		{name: "invalid cursor", query: "cursor=!", wantErr: "invalid cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			q, err := ParseJobQuery(values)
+			var page JobPage
+			if err == nil {
+				page, err = QueryJobs(jobs, q)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if got := jobIDs(page.Jobs); got != tt.want || page.NextCursor != "" {
+				t.Errorf("jobs = %q (next cursor %q), want %q on one page", got, page.NextCursor, tt.want)
+			}
+		})
+	}
+
+	t.Run("pages with cursor", func(t *testing.T) {
+		q := JobQuery{Sort: SortCreatedAt, Descending: true, Limit: 2}
+		var pages []string
+		for i := 0; i < 3; i++ {
+			page, err := QueryJobs(jobs, q)
+			if err != nil {
+				t.Fatalf("QueryJobs() error = %v", err)
+			}
+			pages = append(pages, jobIDs(page.Jobs))
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+		if len(pages) != 2 || pages[0] != "job-d job-b" || pages[1] != "job-c job-a" {
+			t.Errorf("pages = %q, want [job-d job-b] [job-c job-a]", pages)
+		}
+
+		// A job removed since the previous page does not shift the next one
+		q = JobQuery{Sort: SortCreatedAt, Descending: true, Limit: 2}
+		q.Cursor = q.encodeCursor(jobs[2])
+		page, _ := QueryJobs(jobs[1:], q)
+		if got := jobIDs(page.Jobs); got != "job-a" {
+			t.Errorf("page after removal = %q, want job-a", got)
+		}
+	})
+
+	t.Run("rejects cursor of another sort or order", func(t *testing.T) {
+		first, err := QueryJobs(jobs, JobQuery{Sort: SortCreatedAt, Descending: true, Limit: 2})
+		if err != nil {
+			t.Fatalf("QueryJobs() error = %v", err)
+		}
+		for _, q := range []JobQuery{
+			{Sort: SortUpdatedAt, Descending: true, Limit: 2, Cursor: first.NextCursor},
+			{Sort: SortCreatedAt, Descending: false, Limit: 2, Cursor: first.NextCursor},
+		} {
+			if _, err := QueryJobs(jobs, q); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("QueryJobs(sort %s, descending %v) error = %v, want ErrInvalidCursor", q.Sort, q.Descending, err)
+			}
+		}
+	})
+}
+
+func jobIDs(jobs []*models.JobMapping) string {
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.HordeJobID
+	}
+	return strings.Join(ids, " ")
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+// JobSpec describes a Horde job to create for a Swarm test
+type JobSpec struct {
+	Change    string
+	Target    models.JobTarget
+	Name      string
+	Arguments []string
+}
+
+// jobTemplateData is the data job name and argument templates are executed against
+type jobTemplateData struct {
+	models.SwarmTestRequest
+	Route      string
+	StreamId   string
+	TemplateId string
+}
+
+// jobTemplates holds the parsed templates of one job configuration
+type jobTemplates struct {
+	name      *template.Template
+	arguments []*template.Template
+}
+
+// JobBuilder turns Swarm test requests into Horde job specifications using the
+// configured name and argument templates
+type JobBuilder struct {
+	global *jobTemplates
+	routes map[string]*jobTemplates
+}
+
+// NewJobBuilder parses the global and per-route job templates. Templates are
+// test-executed so references to unknown fields are reported at startup.
+func NewJobBuilder(cfg *config.Config) (*JobBuilder, error) {
+	global, err := parseJobTemplates(cfg.Job)
+	if err != nil {
+		return nil, fmt.Errorf("job: %w", err)
+	}
+
+	b := &JobBuilder{
+		global: global,
+		routes: make(map[string]*jobTemplates, len(cfg.Routes)),
+	}
+	for _, route := range cfg.Routes {
+		tmpl, err := parseJobTemplates(route.Job)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Name, err)
+		}
+		b.routes[route.Name] = tmpl
+	}
+
+	return b, nil
+}
+
+func parseJobTemplates(job config.JobConfig) (*jobTemplates, error) {
+	t := &jobTemplates{}
+
+	if job.Name != "" {
+		tmpl, err := template.New("name").Option("missingkey=error").Parse(job.Name)
+		if err != nil {
+			return nil, fmt.Errorf("parsing name template: %w", err)
+		}
+		t.name = tmpl
+	}
+
+	for i, arg := range job.Arguments {
+		tmpl, err := template.New(fmt.Sprintf("argument %d", i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("parsing argument template %d: %w", i, err)
+		}
+		t.arguments = append(t.arguments, tmpl)
+	}
+
+	// Catch references to fields that do not exist before the first webhook arrives
+	if _, _, err := t.render(jobTemplateData{}); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// render executes the templates, dropping arguments that render empty
+func (t *jobTemplates) render(data jobTemplateData) (string, []string, error) {
+	var name string
+	if t.name != nil {
+		var buf strings.Builder
+		if err := t.name.Execute(&buf, data); err != nil {
+			return "", nil, fmt.Errorf("executing name template: %w", err)
+		}
+		name = strings.TrimSpace(buf.String())
+	}
+
+	args := make([]string, 0, len(t.arguments))
+	for _, tmpl := range t.arguments {
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", nil, fmt.Errorf("executing %s template: %w", tmpl.Name(), err)
+		}
+		if arg := strings.TrimSpace(buf.String()); arg != "" {
+			args = append(args, arg)
+		}
+	}
+
+	return name, args, nil
+}
+
+// Build creates the job specification for a request routed to target. Route
+// arguments are appended to the global ones and a route name replaces the global name.
+func (b *JobBuilder) Build(req models.SwarmTestRequest, target models.JobTarget) (JobSpec, error) {
+	data := jobTemplateData{
+		SwarmTestRequest: req,
+		Route:            target.Route,
+		StreamId:         target.StreamId,
+		TemplateId:       target.TemplateId,
+	}
+
+	name, args, err := b.global.render(data)
+	if err != nil {
+		return JobSpec{}, err
+	}
+
+	if route, ok := b.routes[target.Route]; ok {
+		routeName, routeArgs, err := route.render(data)
+		if err != nil {
+			return JobSpec{}, fmt.Errorf("route %s: %w", target.Route, err)
+		}
+		if routeName != "" {
+			name = routeName
+		}
+		args = append(args, routeArgs...)
+	}
+
+	if name == "" {
+		name = "swarm-preflight"
+	}
+
+	return JobSpec{
+		Change:    req.Changelist,
+		Target:    target,
+		Name:      name,
+		Arguments: args,
+	}, nil
+}
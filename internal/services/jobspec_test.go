@@ -0,0 +1,101 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+func TestJobBuilder(t *testing.T) {
+	cfg := &config.Config{
+		Job: config.JobConfig{
+			Name: config.DefaultJobName,
+			Arguments: []string{
+				"-set:SwarmChange={{.Changelist}}",
+				"{{with .ReviewID}}-set:SwarmReview={{.}}{{end}}",
+				"{{with .Author}}-set:SwarmAuthor={{.}}{{end}}",
+			},
+		},
+		Routes: []config.RouteConfig{
+			{
+				Name:       "release",
+				StreamId:   "release-stream",
+				TemplateId: "release-preflight",
+				Job: config.JobConfig{
+					Name:      "{{.Project}} release preflight r{{.ReviewID}}",
+					Arguments: []string{"-set:Stream={{.StreamId}}"},
+				},
+			},
+		},
+	}
+
+	builder, err := NewJobBuilder(cfg)
+	if err != nil {
+		t.Fatalf("NewJobBuilder() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		req      models.SwarmTestRequest
+		target   models.JobTarget
+		wantName string
+		wantArgs []string
+	}{
+		{
+			name: "full review metadata",
+			req: models.SwarmTestRequest{
+				Changelist: "1234",
+				ReviewID:   "42",
+				Version:    "3",
+				Author:     "jdoe",
+				Test:       "preflight",
+			},
+			target:   models.JobTarget{StreamId: "main", TemplateId: "pf"},
+			wantName: "Review 42 v3 - CL 1234 (preflight)",
+			wantArgs: []string{"-set:SwarmChange=1234", "-set:SwarmReview=42", "-set:SwarmAuthor=jdoe"},
+		},
+		{
+			name:     "changelist only drops empty arguments",
+			req:      models.SwarmTestRequest{Changelist: "1234"},
+			target:   models.JobTarget{StreamId: "main", TemplateId: "pf"},
+			wantName: "Preflight - CL 1234",
+			wantArgs: []string{"-set:SwarmChange=1234"},
+		},
+		{
+			name:     "route overrides name and appends arguments",
+			req:      models.SwarmTestRequest{Changelist: "1234", ReviewID: "42", Project: "game"},
+			target:   models.JobTarget{Route: "release", StreamId: "release-stream", TemplateId: "release-preflight"},
+			wantName: "game release preflight r42",
+			wantArgs: []string{"-set:SwarmChange=1234", "-set:SwarmReview=42", "-set:Stream=release-stream"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := builder.Build(tt.req, tt.target)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if spec.Name != tt.wantName {
+				t.Errorf("Build() name = %q, want %q", spec.Name, tt.wantName)
+			}
+			if !reflect.DeepEqual(spec.Arguments, tt.wantArgs) {
+				t.Errorf("Build() arguments = %v, want %v", spec.Arguments, tt.wantArgs)
+			}
+			if spec.Change != tt.req.Changelist || spec.Target != tt.target {
+				t.Errorf("Build() = %+v, want change %s and target %+v", spec, tt.req.Changelist, tt.target)
+			}
+		})
+	}
+
+	t.Run("unknown field is rejected at startup", func(t *testing.T) {
+		_, err := NewJobBuilder(&config.Config{
+			Job: config.JobConfig{Arguments: []string{"-set:X={{.NoSuchField}}"}},
+		})
+		if err == nil {
+			t.Error("NewJobBuilder() expected error for unknown template field")
+		}
+	})
+}
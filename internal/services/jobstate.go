@@ -0,0 +1,135 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+// EvaluateJob translates a Horde job, including its batches and steps, into
+// the internal job status. The outcome is only decided once the job has
+// finished, as failed steps may still be retried: a failure anywhere fails
+// the job, otherwise cancellation takes precedence over warnings, and
+// warnings over success.
+func EvaluateJob(job horde.GetJobResponse) models.JobStatus {
+	if jobCanceled(job) {
+		return models.StatusCanceled
+	}
+
+	state := jobState(job.State)
+	if state != models.StatusCompleted {
+		return state
+	}
+
+	failed, canceled, warnings := false, false, false
+	for _, batch := range job.Batches {
+		batchStatus := batchResult(batch.Error)
+		switch batchStatus {
+		case models.StatusFailed:
+			failed = true
+		case models.StatusCanceled:
+			canceled = true
+		}
+
+		for _, step := range batch.Steps {
+			switch stepResult(step, batchStatus == models.StatusCanceled) {
+			case models.StatusFailed:
+				failed = true
+			case models.StatusCanceled:
+				canceled = true
+			case models.StatusWarnings:
+				warnings = true
+			}
+		}
+	}
+
+	switch {
+	case failed:
+		return models.StatusFailed
+	case canceled:
+		return models.StatusCanceled
+	case warnings:
+		return models.StatusWarnings
+	default:
+		return models.StatusCompleted
+	}
+}
+
+// jobCanceled reports whether the whole job was aborted
+func jobCanceled(job horde.GetJobResponse) bool {
+	return job.AbortedByUserId != nil || isCanceled(job.State)
+}
+
+// jobState maps a Horde job state on its own
+func jobState(state string) models.JobStatus {
+	switch {
+	case strings.EqualFold(state, horde.StateWaiting),
+		strings.EqualFold(state, horde.StateQueued),
+		strings.EqualFold(state, horde.StateInitializing):
+		return models.StatusPending
+	case strings.EqualFold(state, horde.StateRunning):
+		return models.StatusRunning
+	case strings.EqualFold(state, horde.StateComplete),
+		strings.EqualFold(state, horde.StateFinished):
+		return models.StatusCompleted
+	case strings.EqualFold(state, horde.StateFailed):
+		return models.StatusFailed
+	case isCanceled(state):
+		return models.StatusCanceled
+	default:
+		return models.StatusUnknown
+	}
+}
+
+// batchResult classifies a batch error. Errors that only mean the batch was
+// not needed are ignored, and agent or infrastructure errors count as failures.
+func batchResult(batchError string) models.JobStatus {
+	switch {
+	case batchError == "",
+		strings.EqualFold(batchError, horde.BatchErrorNone),
+		strings.EqualFold(batchError, horde.BatchErrorNoLongerNeeded):
+		return models.StatusCompleted
+	case isCanceled(batchError):
+		return models.StatusCanceled
+	default:
+		return models.StatusFailed
+	}
+}
+
+// stepResult classifies a step by its state and outcome. Skipped steps, steps
+// that have not finished and retried steps, whose retry counts instead, do not
+// affect the result.
+func stepResult(step horde.Step, batchCanceled bool) models.JobStatus {
+	if step.RetriedByUserInfo != nil {
+		return models.StatusCompleted
+	}
+	if step.AbortedByUserId != nil {
+		return models.StatusCanceled
+	}
+
+	switch {
+	case isFailedOutcome(step.Outcome):
+		return models.StatusFailed
+	case strings.EqualFold(step.Outcome, horde.OutcomeCanceled):
+		return models.StatusCanceled
+	case strings.EqualFold(step.State, horde.StepStateAborted):
+		if batchCanceled {
+			return models.StatusCanceled
+		}
+		// Aborted without a user or canceled batch, e.g. when the step timed out
+		return models.StatusFailed
+	case strings.EqualFold(step.Outcome, horde.OutcomeWarnings):
+		return models.StatusWarnings
+	default:
+		return models.StatusCompleted
+	}
+}
+
+func isFailedOutcome(outcome string) bool {
+	return strings.EqualFold(outcome, horde.OutcomeFailure) || strings.EqualFold(outcome, horde.OutcomeFailed)
+}
+
+func isCanceled(value string) bool {
+	return strings.EqualFold(value, horde.StateCanceled) || strings.EqualFold(value, horde.BatchErrorCancelled)
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+func TestEvaluateJob(t *testing.T) {
+	user := "user-1"
+
+	step := func(state, outcome string) horde.Step {
+		return horde.Step{Id: "s", State: state, Outcome: outcome, Error: "None"}
+	}
+	batch := func(batchError string, steps ...horde.Step) horde.Batch {
+		return horde.Batch{Id: "b", State: horde.BatchStateComplete, Error: batchError, Steps: steps}
+	}
+
+	tests := []struct {
+		name string
+		job  horde.GetJobResponse
+		want models.JobStatus
+	}{
+		// Job states
+		{name: "waiting", job: horde.GetJobResponse{State: horde.StateWaiting}, want: models.StatusPending},
+		{name: "queued", job: horde.GetJobResponse{State: horde.StateQueued}, want: models.StatusPending},
+		{name: "initializing", job: horde.GetJobResponse{State: horde.StateInitializing}, want: models.StatusPending},
+		{name: "running", job: horde.GetJobResponse{State: horde.StateRunning}, want: models.StatusRunning},
+		{name: "complete", job: horde.GetJobResponse{State: horde.StateComplete}, want: models.StatusCompleted},
+		{name: "finished", job: horde.GetJobResponse{State: horde.StateFinished}, want: models.StatusCompleted},
+		{name: "failed state", job: horde.GetJobResponse{State: horde.StateFailed}, want: models.StatusFailed},
+		{name: "canceled state", job: horde.GetJobResponse{State: horde.StateCanceled}, want: models.StatusCanceled},
+		{name: "case insensitive", job: horde.GetJobResponse{State: "running"}, want: models.StatusRunning},
+		{name: "unrecognized state", job: horde.GetJobResponse{State: "Paused"}, want: models.StatusUnknown},
+
+		// Job cancellation
+		{
+			name: "aborted by user while running",
+			job:  horde.GetJobResponse{State: horde.StateRunning, AbortedByUserId: &user},
+			want: models.StatusCanceled,
+		},
+		{
+			name: "aborted by user with failed steps",
+			job: horde.GetJobResponse{State: horde.StateComplete, AbortedByUserId: &user, Batches: []horde.Batch{
+				batch(horde.BatchErrorCancelled, step(horde.StepStateAborted, horde.OutcomeFailure)),
+			}},
+			want: models.StatusCanceled,
+		},
+
+		// Step outcomes
+		{
+			name: "all steps succeeded",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, step(horde.StepStateCompleted, horde.OutcomeSuccess), step(horde.StepStateCompleted, horde.OutcomeSucceeded)),
+			}},
+			want: models.StatusCompleted,
+		},
+		{
+			name: "step failure",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, step(horde.StepStateCompleted, horde.OutcomeFailure)),
+			}},
+			want: models.StatusFailed,
+		},
+		{
+			name: "legacy failed outcome",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, step(horde.StepStateCompleted, horde.OutcomeFailed)),
+			}},
+			want: models.StatusFailed,
+		},
+		{
+			// Other steps are still running, and the failed one may be retried
+			name: "failure reported while still running",
+			job: horde.GetJobResponse{State: horde.StateRunning, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, step(horde.StepStateCompleted, horde.OutcomeFailure), step(horde.StepStateRunning, horde.OutcomeUnspecified)),
+			}},
+			want: models.StatusRunning,
+		},
+		{
+			name: "failed step succeeded on retry",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, horde.Step{State: horde.StepStateCompleted, Outcome: horde.OutcomeFailure, RetriedByUserInfo: &horde.UserInfo{Name: "jdoe"}}),
+				batch(horde.BatchErrorNone, step(horde.StepStateCompleted, horde.OutcomeSuccess)),
+			}},
+			want: models.StatusCompleted,
+		},
+		{
+			name: "warnings",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, step(horde.StepStateCompleted, horde.OutcomeSuccess), step(horde.StepStateCompleted, horde.OutcomeWarnings)),
+			}},
+			want: models.StatusWarnings,
+		},
+		{
+			name: "warnings while running",
+			job: horde.GetJobResponse{State: horde.StateRunning, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, step(horde.StepStateCompleted, horde.OutcomeWarnings)),
+			}},
+			want: models.StatusRunning,
+		},
+		{
+			name: "failure beats warnings",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, step(horde.StepStateCompleted, horde.OutcomeWarnings), step(horde.StepStateCompleted, horde.OutcomeFailure)),
+			}},
+			want: models.StatusFailed,
+		},
+		{
+			name: "skipped steps are ignored",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, step(horde.StepStateCompleted, horde.OutcomeSuccess), step(horde.StepStateSkipped, horde.OutcomeUnspecified)),
+			}},
+			want: models.StatusCompleted,
+		},
+		{
+			name: "step aborted by user",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, horde.Step{State: horde.StepStateAborted, Outcome: horde.OutcomeUnspecified, AbortedByUserId: &user}),
+			}},
+			want: models.StatusCanceled,
+		},
+		{
+			name: "step aborted without user",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, step(horde.StepStateAborted, horde.OutcomeUnspecified)),
+			}},
+			want: models.StatusFailed,
+		},
+
+		// Batch errors
+		{
+			name: "agent lost connection",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorLostConnection, step(horde.StepStateAborted, horde.OutcomeUnspecified)),
+			}},
+			want: models.StatusFailed,
+		},
+		{
+			name: "no agents in pool",
+			job:  horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{batch(horde.BatchErrorNoAgentsInPool)}},
+			want: models.StatusFailed,
+		},
+		{
+			name: "syncing failed",
+			job:  horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{batch(horde.BatchErrorSyncingFailed)}},
+			want: models.StatusFailed,
+		},
+		{
+			name: "batch no longer needed",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, step(horde.StepStateCompleted, horde.OutcomeSuccess)),
+				batch(horde.BatchErrorNoLongerNeeded, step(horde.StepStateSkipped, horde.OutcomeUnspecified)),
+			}},
+			want: models.StatusCompleted,
+		},
+		{
+			name: "batch cancelled with aborted steps",
+			job: horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{
+				batch(horde.BatchErrorNone, step(horde.StepStateCompleted, horde.OutcomeSuccess)),
+				batch(horde.BatchErrorCancelled, step(horde.StepStateAborted, horde.OutcomeUnspecified)),
+			}},
+			want: models.StatusCanceled,
+		},
+		{
+			name: "empty batch error",
+			job:  horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{batch("")}},
+			want: models.StatusCompleted,
+		},
+		{
+			name: "unrecognized batch error",
+			job:  horde.GetJobResponse{State: horde.StateComplete, Batches: []horde.Batch{batch("Some error occurred")}},
+			want: models.StatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EvaluateJob(tt.job); got != tt.want {
+				t.Errorf("EvaluateJob() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
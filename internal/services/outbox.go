@@ -0,0 +1,219 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+// ErrDeadLetterNotFound is returned when replaying an unknown dead-lettered update
+var ErrDeadLetterNotFound = errors.New("dead-lettered update not found")
+
+// SwarmOutbox queues Swarm status updates until they are delivered. Each test
+// run, identified by its update URL, has at most one pending update: a newer
+// update replaces the pending one, except that a final result is never
+// replaced by a non-final status of the same request. Once a final result is
+// delivered, the outbox remembers it for the configured retention and drops
+// non-final updates the same request sends for the test run.
+type SwarmOutbox interface {
+	// Enqueue assigns the update an ID and queues it, reporting false if it was
+	// dropped because a final result is already pending or delivered for the test run
+	Enqueue(update *models.SwarmUpdate) (bool, error)
+	// Pending returns all queued updates
+	Pending() ([]*models.SwarmUpdate, error)
+	// Complete removes a delivered update unless it was replaced meanwhile
+	Complete(update *models.SwarmUpdate) error
+	// Reschedule saves the attempts and next attempt time of an update unless it was replaced meanwhile
+	Reschedule(update *models.SwarmUpdate) error
+	// Bury moves an update that cannot be delivered to the dead-letter list unless it was replaced meanwhile
+	Bury(update *models.SwarmUpdate) error
+	// DeadLetters returns the updates that could not be delivered, oldest first
+	DeadLetters() ([]*models.SwarmUpdate, error)
+	// Replay moves a dead-lettered update back into the queue, reporting
+	// false if it was dropped in favour of a pending or delivered final result
+	Replay(id string) (bool, error)
+}
+
+// NewSwarmOutbox creates an outbox kept alongside the job storage, so updates
+// are persisted whenever job mappings are
+func NewSwarmOutbox(cfg *config.Config, jobStorage JobStorage) (SwarmOutbox, error) {
+	if storage, ok := jobStorage.(*BoltJobStorage); ok {
+		return newBoltSwarmOutbox(storage.db, cfg.GetOutboxDeliveredRetention())
+	}
+	return NewMemorySwarmOutbox(cfg.GetOutboxDeliveredRetention()), nil
+}
+
+// replaces reports whether update may replace the pending update for its test
+// run, given whether a final result was already delivered for its request. A
+// final result pending for an earlier request gives way to the rerun.
+func replaces(pending, update *models.SwarmUpdate, finalDelivered bool) bool {
+	if update.IsFinal() {
+		return true
+	}
+	if finalDelivered {
+		return false
+	}
+	return pending == nil || !pending.IsFinal() || pending.RequestID != update.RequestID
+}
+
+// deliveredKey identifies the request whose final result was delivered to a
+// test run, so reruns reusing the update URL are not taken for stale updates
+func deliveredKey(update *models.SwarmUpdate) string {
+	return update.UpdateURL + "\x00" + update.RequestID
+}
+
+// MemorySwarmOutbox keeps queued Swarm updates in memory
+type MemorySwarmOutbox struct {
+	mu      sync.Mutex
+	seq     uint64
+	pending map[string]*models.SwarmUpdate
+	dead    map[string]*models.SwarmUpdate
+	// delivered holds when the final result delivered for each test run and
+	// request was queued, for deliveredRetention
+	delivered          map[string]time.Time
+	deliveredRetention time.Duration
+}
+
+// NewMemorySwarmOutbox creates a new in-memory outbox remembering delivered
+// final results for deliveredRetention
+func NewMemorySwarmOutbox(deliveredRetention time.Duration) *MemorySwarmOutbox {
+	return &MemorySwarmOutbox{
+		pending:            make(map[string]*models.SwarmUpdate),
+		dead:               make(map[string]*models.SwarmUpdate),
+		delivered:          make(map[string]time.Time),
+		deliveredRetention: deliveredRetention,
+	}
+}
+
+// Enqueue queues an update, replacing any pending update for the same test run
+func (o *MemorySwarmOutbox) Enqueue(update *models.SwarmUpdate) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.enqueue(update), nil
+}
+
+func (o *MemorySwarmOutbox) enqueue(update *models.SwarmUpdate) bool {
+	_, finalDelivered := o.delivered[deliveredKey(update)]
+	if !replaces(o.pending[update.UpdateURL], update, finalDelivered) {
+		return false
+	}
+	o.seq++
+	update.ID = strconv.FormatUint(o.seq, 10)
+	o.pending[update.UpdateURL] = copyUpdate(update)
+	return true
+}
+
+// Pending returns all queued updates
+func (o *MemorySwarmOutbox) Pending() ([]*models.SwarmUpdate, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return sortedUpdates(o.pending), nil
+}
+
+// Complete removes a delivered update
+func (o *MemorySwarmOutbox) Complete(update *models.SwarmUpdate) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.isCurrent(update) {
+		delete(o.pending, update.UpdateURL)
+		if update.IsFinal() {
+			o.delivered[deliveredKey(update)] = update.CreatedAt
+			for key, queuedAt := range o.delivered {
+				if update.CreatedAt.Sub(queuedAt) > o.deliveredRetention {
+					delete(o.delivered, key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Reschedule saves a failed delivery attempt
+func (o *MemorySwarmOutbox) Reschedule(update *models.SwarmUpdate) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.isCurrent(update) {
+		o.pending[update.UpdateURL] = copyUpdate(update)
+	}
+	return nil
+}
+
+// Bury moves an update to the dead-letter list
+func (o *MemorySwarmOutbox) Bury(update *models.SwarmUpdate) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.isCurrent(update) {
+		delete(o.pending, update.UpdateURL)
+		o.dead[update.ID] = copyUpdate(update)
+	}
+	return nil
+}
+
+// DeadLetters returns the updates that could not be delivered
+func (o *MemorySwarmOutbox) DeadLetters() ([]*models.SwarmUpdate, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return sortedUpdates(o.dead), nil
+}
+
+// Replay moves a dead-lettered update back into the queue
+func (o *MemorySwarmOutbox) Replay(id string) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	update, exists := o.dead[id]
+	if !exists {
+		return false, ErrDeadLetterNotFound
+	}
+	delete(o.dead, id)
+	return o.enqueue(resetUpdate(update)), nil
+}
+
+func (o *MemorySwarmOutbox) isCurrent(update *models.SwarmUpdate) bool {
+	pending, exists := o.pending[update.UpdateURL]
+	return exists && pending.ID == update.ID
+}
+
+// copyUpdate keeps stored updates independent of the caller's copy
+func copyUpdate(update *models.SwarmUpdate) *models.SwarmUpdate {
+	c := *update
+	c.Messages = append([]string(nil), update.Messages...)
+	return &c
+}
+
+// resetUpdate prepares a dead-lettered update for a fresh round of delivery attempts
+func resetUpdate(update *models.SwarmUpdate) *models.SwarmUpdate {
+	c := copyUpdate(update)
+	c.Attempts = 0
+	c.NextAttempt = time.Time{}
+	c.LastError = ""
+	return c
+}
+
+// sortedUpdates returns copies of the updates in the order they were queued
+func sortedUpdates(updates map[string]*models.SwarmUpdate) []*models.SwarmUpdate {
+	sorted := make([]*models.SwarmUpdate, 0, len(updates))
+	for _, update := range updates {
+		sorted = append(sorted, copyUpdate(update))
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return updateSeq(sorted[i]) < updateSeq(sorted[j])
+	})
+	return sorted
+}
+
+func updateSeq(update *models.SwarmUpdate) uint64 {
+	seq, _ := strconv.ParseUint(update.ID, 10, 64)
+	return seq
+}
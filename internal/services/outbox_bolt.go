@@ -0,0 +1,224 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+var (
+	outboxBucket      = []byte("swarm_outbox")
+	deadLettersBucket = []byte("swarm_dead_letters")
+	// deliveredBucket maps the test runs and requests whose final result was
+	// delivered, keyed by deliveredKey, to the time that result was queued
+	deliveredBucket = []byte("swarm_delivered")
+)
+
+// BoltSwarmOutbox persists queued Swarm updates in the bolt job database so
+// that undelivered results survive bridge restarts
+type BoltSwarmOutbox struct {
+	db                 *bolt.DB
+	deliveredRetention time.Duration
+}
+
+func newBoltSwarmOutbox(db *bolt.DB, deliveredRetention time.Duration) (*BoltSwarmOutbox, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{outboxBucket, deadLettersBucket, deliveredBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating outbox buckets: %w", err)
+	}
+	return &BoltSwarmOutbox{db: db, deliveredRetention: deliveredRetention}, nil
+}
+
+// Enqueue queues an update, replacing any pending update for the same test run
+func (o *BoltSwarmOutbox) Enqueue(update *models.SwarmUpdate) (bool, error) {
+	var queued bool
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		queued, err = enqueueBolt(tx, update)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("queueing swarm update: %w", err)
+	}
+	return queued, nil
+}
+
+func enqueueBolt(tx *bolt.Tx, update *models.SwarmUpdate) (bool, error) {
+	bucket := tx.Bucket(outboxBucket)
+
+	pending, err := decodeUpdate(bucket.Get([]byte(update.UpdateURL)))
+	if err != nil {
+		return false, err
+	}
+	finalDelivered := tx.Bucket(deliveredBucket).Get([]byte(deliveredKey(update))) != nil
+	if !replaces(pending, update, finalDelivered) {
+		return false, nil
+	}
+
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return false, err
+	}
+	update.ID = strconv.FormatUint(seq, 10)
+	return true, putUpdate(bucket, []byte(update.UpdateURL), update)
+}
+
+// Pending returns all queued updates
+func (o *BoltSwarmOutbox) Pending() ([]*models.SwarmUpdate, error) {
+	updates, err := o.list(outboxBucket)
+	if err != nil {
+		return nil, fmt.Errorf("listing queued swarm updates: %w", err)
+	}
+	return updates, nil
+}
+
+// Complete removes a delivered update
+func (o *BoltSwarmOutbox) Complete(update *models.SwarmUpdate) error {
+	return o.ifCurrent(update, func(tx *bolt.Tx) error {
+		if err := tx.Bucket(outboxBucket).Delete([]byte(update.UpdateURL)); err != nil {
+			return err
+		}
+		if !update.IsFinal() {
+			return nil
+		}
+		return markDelivered(tx.Bucket(deliveredBucket), update, o.deliveredRetention)
+	})
+}
+
+// markDelivered remembers the delivered final result of a test run, forgetting
+// those older than retention
+func markDelivered(bucket *bolt.Bucket, update *models.SwarmUpdate, retention time.Duration) error {
+	var expired [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var queuedAt time.Time
+		if err := queuedAt.UnmarshalText(v); err != nil || update.CreatedAt.Sub(queuedAt) > retention {
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range expired {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	queuedAt, err := update.CreatedAt.MarshalText()
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(deliveredKey(update)), queuedAt)
+}
+
+// Reschedule saves a failed delivery attempt
+func (o *BoltSwarmOutbox) Reschedule(update *models.SwarmUpdate) error {
+	return o.ifCurrent(update, func(tx *bolt.Tx) error {
+		return putUpdate(tx.Bucket(outboxBucket), []byte(update.UpdateURL), update)
+	})
+}
+
+// Bury moves an update to the dead-letter list
+func (o *BoltSwarmOutbox) Bury(update *models.SwarmUpdate) error {
+	return o.ifCurrent(update, func(tx *bolt.Tx) error {
+		if err := tx.Bucket(outboxBucket).Delete([]byte(update.UpdateURL)); err != nil {
+			return err
+		}
+		return putUpdate(tx.Bucket(deadLettersBucket), []byte(update.ID), update)
+	})
+}
+
+// DeadLetters returns the updates that could not be delivered
+func (o *BoltSwarmOutbox) DeadLetters() ([]*models.SwarmUpdate, error) {
+	updates, err := o.list(deadLettersBucket)
+	if err != nil {
+		return nil, fmt.Errorf("listing dead-lettered swarm updates: %w", err)
+	}
+	return updates, nil
+}
+
+// Replay moves a dead-lettered update back into the queue
+func (o *BoltSwarmOutbox) Replay(id string) (bool, error) {
+	var queued bool
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		dead := tx.Bucket(deadLettersBucket)
+		update, err := decodeUpdate(dead.Get([]byte(id)))
+		if err != nil {
+			return err
+		}
+		if update == nil {
+			return ErrDeadLetterNotFound
+		}
+		if err := dead.Delete([]byte(id)); err != nil {
+			return err
+		}
+		queued, err = enqueueBolt(tx, resetUpdate(update))
+		return err
+	})
+	return queued, err
+}
+
+// ifCurrent runs fn in a write transaction if update is still the pending update of its test run
+func (o *BoltSwarmOutbox) ifCurrent(update *models.SwarmUpdate, fn func(tx *bolt.Tx) error) error {
+	return o.db.Update(func(tx *bolt.Tx) error {
+		pending, err := decodeUpdate(tx.Bucket(outboxBucket).Get([]byte(update.UpdateURL)))
+		if err != nil {
+			return err
+		}
+		if pending == nil || pending.ID != update.ID {
+			return nil
+		}
+		return fn(tx)
+	})
+}
+
+func (o *BoltSwarmOutbox) list(name []byte) ([]*models.SwarmUpdate, error) {
+	updates := make(map[string]*models.SwarmUpdate)
+	err := o.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(name).ForEach(func(k, v []byte) error {
+			update, err := decodeUpdate(v)
+			if err != nil {
+				return fmt.Errorf("decoding swarm update %s: %w", k, err)
+			}
+			updates[string(k)] = update
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortedUpdates(updates), nil
+}
+
+func putUpdate(bucket *bolt.Bucket, key []byte, update *models.SwarmUpdate) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("marshaling swarm update: %w", err)
+	}
+	return bucket.Put(key, data)
+}
+
+// decodeUpdate returns nil for a missing value
+func decodeUpdate(data []byte) (*models.SwarmUpdate, error) {
+	if data == nil {
+		return nil, nil
+	}
+	update := &models.SwarmUpdate{}
+	if err := json.Unmarshal(data, update); err != nil {
+		return nil, err
+	}
+	return update, nil
+}
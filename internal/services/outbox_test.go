@@ -0,0 +1,200 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+func TestSwarmOutbox(t *testing.T) {
+	cfg := &config.Config{Swarm: config.SwarmConfig{Outbox: config.OutboxConfig{DeliveredRetention: 168}}}
+	backends := map[string]func(t *testing.T) SwarmOutbox{
+		"memory": func(t *testing.T) SwarmOutbox {
+			return NewMemorySwarmOutbox(cfg.GetOutboxDeliveredRetention())
+		},
+		"bolt": func(t *testing.T) SwarmOutbox {
+			storage, err := NewBoltJobStorage(filepath.Join(t.TempDir(), "jobs.db"))
+			if err != nil {
+				t.Fatalf("NewBoltJobStorage() error = %v", err)
+			}
+			t.Cleanup(func() { storage.Close() })
+
+			outbox, err := NewSwarmOutbox(cfg, storage)
+			if err != nil {
+				t.Fatalf("NewSwarmOutbox() error = %v", err)
+			}
+			return outbox
+		},
+	}
+
+	update := func(url, status string) *models.SwarmUpdate {
+		return &models.SwarmUpdate{TestRunStatus: models.TestRunStatus{UpdateURL: url, RequestID: "req-1", JobID: "job-1", Status: status, Messages: []string{status}}}
+	}
+	rerun := func(url, status string) *models.SwarmUpdate {
+		u := update(url, status)
+		u.RequestID, u.JobID = "req-2", "job-2"
+		return u
+	}
+
+	mustEnqueue := func(t *testing.T, outbox SwarmOutbox, u *models.SwarmUpdate) bool {
+		t.Helper()
+		queued, err := outbox.Enqueue(u)
+		if err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+		return queued
+	}
+
+	pendingStatuses := func(t *testing.T, outbox SwarmOutbox) []string {
+		t.Helper()
+		pending, err := outbox.Pending()
+		if err != nil {
+			t.Fatalf("Pending() error = %v", err)
+		}
+		var statuses []string
+		for _, u := range pending {
+			statuses = append(statuses, u.UpdateURL+"="+u.Status)
+		}
+		return statuses
+	}
+
+	for name, newOutbox := range backends {
+		t.Run(name, func(t *testing.T) {
+			t.Run("newer update replaces pending one", func(t *testing.T) {
+				outbox := newOutbox(t)
+				mustEnqueue(t, outbox, update("run-1", models.SwarmStatusRunning))
+				mustEnqueue(t, outbox, update("run-2", models.SwarmStatusRunning))
+				mustEnqueue(t, outbox, update("run-1", models.SwarmStatusPass))
+
+				got := pendingStatuses(t, outbox)
+				if len(got) != 2 || got[0] != "run-2=running" || got[1] != "run-1=pass" {
+					t.Errorf("Pending() = %v, want [run-2=running run-1=pass]", got)
+				}
+			})
+
+			t.Run("running never replaces a final result", func(t *testing.T) {
+				outbox := newOutbox(t)
+				mustEnqueue(t, outbox, update("run-1", models.SwarmStatusFail))
+				if mustEnqueue(t, outbox, update("run-1", models.SwarmStatusRunning)) {
+					t.Error("Enqueue() queued running over a pending final result")
+				}
+
+				got := pendingStatuses(t, outbox)
+				if len(got) != 1 || got[0] != "run-1=fail" {
+					t.Errorf("Pending() = %v, want [run-1=fail]", got)
+				}
+			})
+
+			t.Run("final delivered, then replay running", func(t *testing.T) {
+				outbox := newOutbox(t)
+				stale := update("run-1", models.SwarmStatusRunning)
+				mustEnqueue(t, outbox, stale)
+				if err := outbox.Bury(stale); err != nil {
+					t.Fatalf("Bury() error = %v", err)
+				}
+
+				final := update("run-1", models.SwarmStatusPass)
+				mustEnqueue(t, outbox, final)
+				if err := outbox.Complete(final); err != nil {
+					t.Fatalf("Complete() error = %v", err)
+				}
+
+				queued, err := outbox.Replay(stale.ID)
+				if err != nil || queued {
+					t.Errorf("Replay() = %v, %v, want running dropped after the delivered result", queued, err)
+				}
+				if mustEnqueue(t, outbox, update("run-1", models.SwarmStatusQueued)) {
+					t.Error("Enqueue() queued queued after the delivered result")
+				}
+				if got := pendingStatuses(t, outbox); len(got) != 0 {
+					t.Errorf("Pending() = %v, want none", got)
+				}
+				if !mustEnqueue(t, outbox, update("run-1", models.SwarmStatusFail)) {
+					t.Error("Enqueue() dropped a newer final result")
+				}
+			})
+
+			t.Run("rerun with the same update URL", func(t *testing.T) {
+				outbox := newOutbox(t)
+				final := update("run-1", models.SwarmStatusPass)
+				mustEnqueue(t, outbox, final)
+				if err := outbox.Complete(final); err != nil {
+					t.Fatalf("Complete() error = %v", err)
+				}
+				if !mustEnqueue(t, outbox, rerun("run-1", models.SwarmStatusQueued)) {
+					t.Error("Enqueue() dropped the rerun after the delivered result")
+				}
+
+				// A result still pending for the earlier run gives way to the rerun too
+				mustEnqueue(t, outbox, update("run-2", models.SwarmStatusFail))
+				if !mustEnqueue(t, outbox, rerun("run-2", models.SwarmStatusRunning)) {
+					t.Error("Enqueue() dropped the rerun in favour of the earlier run's pending result")
+				}
+				if mustEnqueue(t, outbox, update("run-1", models.SwarmStatusRunning)) {
+					t.Error("Enqueue() queued a stale update of the earlier run")
+				}
+
+				got := pendingStatuses(t, outbox)
+				if len(got) != 2 || got[0] != "run-1=queued" || got[1] != "run-2=running" {
+					t.Errorf("Pending() = %v, want [run-1=queued run-2=running]", got)
+				}
+			})
+
+			t.Run("completing a replaced update keeps the newer one", func(t *testing.T) {
+				outbox := newOutbox(t)
+				delivering := update("run-1", models.SwarmStatusRunning)
+				mustEnqueue(t, outbox, delivering)
+				mustEnqueue(t, outbox, update("run-1", models.SwarmStatusPass))
+
+				if err := outbox.Complete(delivering); err != nil {
+					t.Fatalf("Complete() error = %v", err)
+				}
+				got := pendingStatuses(t, outbox)
+				if len(got) != 1 || got[0] != "run-1=pass" {
+					t.Errorf("Pending() = %v, want [run-1=pass]", got)
+				}
+			})
+
+			t.Run("bury and replay", func(t *testing.T) {
+				outbox := newOutbox(t)
+				failing := update("run-1", models.SwarmStatusPass)
+				mustEnqueue(t, outbox, failing)
+				failing.Attempts = 3
+				failing.LastError = "unexpected status: 500"
+				if err := outbox.Bury(failing); err != nil {
+					t.Fatalf("Bury() error = %v", err)
+				}
+
+				if got := pendingStatuses(t, outbox); len(got) != 0 {
+					t.Errorf("Pending() after Bury() = %v, want none", got)
+				}
+				dead, err := outbox.DeadLetters()
+				if err != nil {
+					t.Fatalf("DeadLetters() error = %v", err)
+				}
+				if len(dead) != 1 || dead[0].ID != failing.ID || dead[0].LastError != failing.LastError {
+					t.Fatalf("DeadLetters() = %+v, want the buried update", dead)
+				}
+
+				queued, err := outbox.Replay(failing.ID)
+				if err != nil || !queued {
+					t.Fatalf("Replay() = %v, %v, want true, nil", queued, err)
+				}
+				pending, _ := outbox.Pending()
+				if len(pending) != 1 || pending[0].Attempts != 0 || pending[0].LastError != "" {
+					t.Errorf("Pending() after Replay() = %+v, want a reset update", pending)
+				}
+				if dead, _ := outbox.DeadLetters(); len(dead) != 0 {
+					t.Errorf("DeadLetters() after Replay() = %+v, want none", dead)
+				}
+
+				if _, err := outbox.Replay("missing"); !errors.Is(err, ErrDeadLetterNotFound) {
+					t.Errorf("Replay(missing) error = %v, want ErrDeadLetterNotFound", err)
+				}
+			})
+		})
+	}
+}
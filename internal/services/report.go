@@ -0,0 +1,184 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+// FailureMessages describes the failing batches and steps of a Horde job as
+// Swarm test run messages, each step followed by its log excerpt, if any, and
+// a link to its log. Excerpts are keyed by step ID.
+func FailureMessages(hordeHost string, job horde.GetJobResponse, excerpts map[string][]string) []string {
+	var details []string
+	failedSteps, totalSteps := 0, 0
+
+	for _, batch := range job.Batches {
+		batchStatus := batchResult(batch.Error)
+		if batchStatus == models.StatusFailed {
+			details = append(details, fmt.Sprintf("Batch %s failed: %s", batchName(batch), batch.Error))
+			if link := logLink(hordeHost, job.ID, batch.LogId, ""); link != "" {
+				details = append(details, link)
+			}
+		}
+
+		for _, step := range batch.Steps {
+			totalSteps++
+			if stepResult(step, batchStatus == models.StatusCanceled) != models.StatusFailed {
+				continue
+			}
+			failedSteps++
+			details = append(details, stepMessage(batch, step))
+			for _, line := range excerpts[step.Id] {
+				details = append(details, excerptPrefix+line)
+			}
+			details = append(details, logLink(hordeHost, job.ID, step.LogId, step.Id))
+		}
+	}
+
+	summary := "Horde job failed"
+	if failedSteps > 0 {
+		summary = fmt.Sprintf("Horde job failed: %d of %d steps failed", failedSteps, totalSteps)
+	}
+	return append([]string{summary}, details...)
+}
+
+// WarningMessages lists the steps of a successful Horde job that reported warnings
+func WarningMessages(hordeHost string, job horde.GetJobResponse) []string {
+	messages := []string{"Horde job completed with warnings"}
+	for _, batch := range job.Batches {
+		for _, step := range batch.Steps {
+			if stepResult(step, false) == models.StatusWarnings {
+				messages = append(messages, stepMessage(batch, step), logLink(hordeHost, job.ID, step.LogId, step.Id))
+			}
+		}
+	}
+	return messages
+}
+
+// CanceledMessages explains that a Horde job was canceled rather than failing on its own
+func CanceledMessages(job horde.GetJobResponse) []string {
+	message := "Horde job was canceled"
+	switch {
+	case job.AbortedByUserInfo != nil && job.AbortedByUserInfo.Name != "":
+		message += " by " + job.AbortedByUserInfo.Name
+	case job.AbortedByUserId != nil && *job.AbortedByUserId != "":
+		message += " by " + *job.AbortedByUserId
+	}
+	messages := []string{message}
+	if job.CancellationReason != "" {
+		messages = append(messages, "Reason: "+job.CancellationReason)
+	}
+	return messages
+}
+
+// ArtifactMessages lists artifacts as test run messages, each name followed
+// by its download link
+func ArtifactMessages(hordeHost string, artifacts []horde.Artifact) []string {
+	var messages []string
+	for _, artifact := range artifacts {
+		messages = append(messages,
+			fmt.Sprintf("Artifact %s", artifact.Name),
+			hordeHost+horde.ArtifactDownloadPath(artifact.Id))
+	}
+	return messages
+}
+
+// WithArtifacts inserts artifact messages after the summary, the first
+// message, so message limits cut step details before artifact links
+func WithArtifacts(messages, artifacts []string) []string {
+	if len(messages) == 0 || len(artifacts) == 0 {
+		return append(messages, artifacts...)
+	}
+	combined := make([]string, 0, len(messages)+len(artifacts))
+	combined = append(combined, messages[0])
+	combined = append(combined, artifacts...)
+	return append(combined, messages[1:]...)
+}
+
+// LimitMessages enforces Swarm's limits on test run messages. Messages over
+// maxLength are truncated, except links which are dropped as a cut URL is
+// useless, and the list is capped at maxCount with a final overflow notice.
+func LimitMessages(messages []string, maxCount, maxLength int) []string {
+	limited := make([]string, 0, len(messages))
+	for _, message := range messages {
+		if maxLength > 0 && utf8.RuneCountInString(message) > maxLength {
+			if isLink(message) {
+				continue
+			}
+			message = truncate(message, maxLength)
+		}
+		limited = append(limited, message)
+	}
+
+	if maxCount > 0 && len(limited) > maxCount {
+		omitted := len(limited) - maxCount + 1
+		limited = append(limited[:maxCount-1], truncate(fmt.Sprintf("... %d more messages, see the Horde job", omitted), maxLength))
+	}
+	return limited
+}
+
+func batchName(batch horde.Batch) string {
+	if batch.AgentType != "" {
+		return fmt.Sprintf("%s (%s)", batch.Id, batch.AgentType)
+	}
+	return batch.Id
+}
+
+// stepMessage describes a step's outcome, followed by the agent pool it ran
+// on and how long it took when known
+func stepMessage(batch horde.Batch, step horde.Step) string {
+	message := fmt.Sprintf("%s: %s", stepName(step), step.Outcome)
+	if step.Error != "" && step.Error != "None" {
+		message += " - " + step.Error
+	}
+
+	var details []string
+	if batch.AgentType != "" {
+		details = append(details, batch.AgentType)
+	}
+	if duration, ok := step.Duration(); ok {
+		details = append(details, duration.Round(time.Second).String())
+	}
+	if len(details) > 0 {
+		message += " (" + strings.Join(details, ", ") + ")"
+	}
+	return message
+}
+
+func stepName(step horde.Step) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	return "Step " + step.Id
+}
+
+// logLink links to a log when known, falling back to the step within the job page
+func logLink(hordeHost, jobID, logID, stepID string) string {
+	switch {
+	case logID != "":
+		return fmt.Sprintf("%s/log/%s", hordeHost, logID)
+	case stepID != "":
+		return fmt.Sprintf("%s/job/%s?step=%s", hordeHost, jobID, stepID)
+	default:
+		return ""
+	}
+}
+
+func isLink(message string) bool {
+	return strings.HasPrefix(message, "http://") || strings.HasPrefix(message, "https://")
+}
+
+func truncate(message string, maxLength int) string {
+	if maxLength <= 0 || utf8.RuneCountInString(message) <= maxLength {
+		return message
+	}
+	if maxLength <= 3 {
+		return string([]rune(message)[:maxLength])
+	}
+	return string([]rune(message)[:maxLength-3]) + "..."
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/horde"
+)
+
+func TestFailureMessages(t *testing.T) {
+	started := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	finished := started.Add(12*time.Minute + 30*time.Second)
+	job := horde.GetJobResponse{
+		ID:    "job-1",
+		State: "Complete",
+		Batches: []horde.Batch{
+			{
+				Id:    "b1",
+				Error: "None",
+				Steps: []horde.Step{
+					{Id: "s1", Name: "Update Version Files", Outcome: "Success"},
+					{Id: "s2", Name: "Compile Editor Win64", Outcome: "Failure", Error: "None", LogId: "log-2", StartTime: &started, FinishTime: &finished},
+				},
+			},
+			{
+				Id:        "b2",
+				Error:     "LostConnection",
+				AgentType: "Win64",
+				LogId:     "log-b2",
+				Steps: []horde.Step{
+					{Id: "s3", Outcome: "Failure", Error: "ExecutionError"},
+				},
+			},
+		},
+	}
+
+	got := FailureMessages("https://horde", job, map[string][]string{"s2": {"error C2065: 'x': undeclared identifier"}})
+	want := []string{
+		"Horde job failed: 2 of 3 steps failed",
+		"Compile Editor Win64: Failure (12m30s)",
+		"> error C2065: 'x': undeclared identifier",
+		"https://horde/log/log-2",
+		"Batch b2 (Win64) failed: LostConnection",
+		"https://horde/log/log-b2",
+		"Step s3: Failure - ExecutionError (Win64)",
+		"https://horde/job/job-1?step=s3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FailureMessages() =\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	t.Run("no step details", func(t *testing.T) {
+		got := FailureMessages("https://horde", horde.GetJobResponse{ID: "job-2"}, nil)
+		if !reflect.DeepEqual(got, []string{"Horde job failed"}) {
+			t.Errorf("FailureMessages() = %v, want [Horde job failed]", got)
+		}
+	})
+}
+
+func TestLimitMessages(t *testing.T) {
+	tests := []struct {
+		name      string
+		messages  []string
+		maxCount  int
+		maxLength int
+		want      []string
+	}{
+		{
+			name:      "within limits",
+			messages:  []string{"one", "two"},
+			maxCount:  10,
+			maxLength: 80,
+			want:      []string{"one", "two"},
+		},
+		{
+			name:      "long message truncated",
+			messages:  []string{"Compile Editor Win64: Failure - a very long error"},
+			maxCount:  10,
+			maxLength: 20,
+			want:      []string{"Compile Editor Wi..."},
+		},
+		{
+			name:      "long link dropped",
+			messages:  []string{"failed", "https://horde.example.com/log/0123456789abcdef"},
+			maxCount:  10,
+			maxLength: 20,
+			want:      []string{"failed"},
+		},
+		{
+			name:      "too many messages",
+			messages:  []string{"1", "2", "3", "4", "5"},
+			maxCount:  3,
+			maxLength: 80,
+			want:      []string{"1", "2", "... 3 more messages, see the Horde job"},
+		},
+		{
+			name:      "no limits",
+			messages:  []string{"1", "2", "3"},
+			maxCount:  0,
+			maxLength: 0,
+			want:      []string{"1", "2", "3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LimitMessages(tt.messages, tt.maxCount, tt.maxLength)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LimitMessages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWarningAndCanceledMessages(t *testing.T) {
+	job := horde.GetJobResponse{
+		ID: "job-1",
+		Batches: []horde.Batch{{
+			Id:    "b1",
+			Error: horde.BatchErrorNone,
+			Steps: []horde.Step{
+				{Id: "s1", Name: "Compile", Outcome: horde.OutcomeSuccess},
+				{Id: "s2", Name: "Cook", Outcome: horde.OutcomeWarnings, LogId: "log-2"},
+			},
+		}},
+	}
+
+	got := WarningMessages("https://horde", job)
+	want := []string{"Horde job completed with warnings", "Cook: Warnings", "https://horde/log/log-2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WarningMessages() = %v, want %v", got, want)
+	}
+
+	user := "jdoe"
+	got = CanceledMessages(horde.GetJobResponse{AbortedByUserId: &user, CancellationReason: "Superseded by review version 3"})
+	want = []string{"Horde job was canceled by jdoe", "Reason: Superseded by review version 3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CanceledMessages() = %v, want %v", got, want)
+	}
+
+	got = CanceledMessages(horde.GetJobResponse{AbortedByUserId: &user, AbortedByUserInfo: &horde.UserInfo{Id: "u1", Name: "Jane Doe"}})
+	want = []string{"Horde job was canceled by Jane Doe"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CanceledMessages() = %v, want %v", got, want)
+	}
+}
+
+func TestArtifactMessages(t *testing.T) {
+	artifacts := ArtifactMessages("https://horde", []horde.Artifact{{Id: "a1", Name: "Editor-Win64"}})
+	got := WithArtifacts([]string{"Horde job failed", "Compile: Failure"}, artifacts)
+	want := []string{"Horde job failed", "Artifact Editor-Win64", "https://horde/api/v2/artifacts/a1/zip", "Compile: Failure"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WithArtifacts() = %v, want %v", got, want)
+	}
+
+	if got := WithArtifacts([]string{"Horde job completed successfully"}, nil); !reflect.DeepEqual(got, []string{"Horde job completed successfully"}) {
+		t.Errorf("WithArtifacts() without artifacts = %v, want messages unchanged", got)
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/swarm"
+)
+
+// ReviewVoter applies the outcome of finished jobs to their Swarm reviews, by
+// voting and moving reviews to another state as configured for the job's route
+type ReviewVoter struct {
+	cfg    *config.Config
+	logger zerolog.Logger
+	swarm  *SwarmService
+}
+
+// NewReviewVoter creates a new instance of ReviewVoter
+func NewReviewVoter(cfg *config.Config, logger zerolog.Logger, swarmService *SwarmService) *ReviewVoter {
+	return &ReviewVoter{
+		cfg:    cfg,
+		logger: logger,
+		swarm:  swarmService,
+	}
+}
+
+// Apply votes on the review of a finished job and changes its state: a pass
+// (with or without warnings) votes up and a failure votes down. Canceled jobs,
+// jobs without a review and routes without review actions are ignored. The
+// state of a review with a version newer than the job tested is left alone.
+// In a dry run the actions are only logged. Errors are logged.
+func (v *ReviewVoter) Apply(ctx context.Context, job *models.JobMapping, status models.JobStatus) {
+	settings := v.cfg.ReviewFor(job.Target.Route)
+	if !settings.Enabled() || job.SwarmTest.ReviewID == "" {
+		return
+	}
+
+	var vote, state string
+	switch status {
+	case models.StatusCompleted, models.StatusWarnings:
+		vote, state = swarm.VoteUp, settings.PassState
+	case models.StatusFailed:
+		vote, state = swarm.VoteDown, settings.FailState
+	default:
+		return
+	}
+	if !settings.Vote {
+		vote = ""
+	}
+
+	logger := v.logger.With().
+		Str("job_id", job.HordeJobID).
+		Str("review_id", job.SwarmTest.ReviewID).
+		Str("route", job.Target.Route).
+		Str("status", string(status)).
+		Logger()
+
+	if vote != "" {
+		if settings.DryRun {
+			logger.Info().Str("vote", vote).Msg("Dry run: would vote on swarm review")
+		} else if err := v.vote(ctx, job, vote); err != nil {
+			logger.Error().Err(err).Str("vote", vote).Msg("failed to vote on swarm review")
+		} else {
+			logger.Info().Str("vote", vote).Msg("Voted on swarm review")
+		}
+	}
+
+	if state != "" {
+		if settings.DryRun {
+			logger.Info().Str("state", state).Msg("Dry run: would change swarm review state")
+		} else if outdated, err := v.outdated(ctx, job); err != nil {
+			logger.Error().Err(err).Str("state", state).Msg("failed to check swarm review version, leaving its state")
+		} else if outdated {
+			logger.Info().Str("state", state).Msg("Swarm review has a newer version, leaving its state")
+		} else if err := v.swarm.TransitionReview(ctx, job.SwarmTest.ReviewID, swarm.TransitionRequest{Transition: state}); err != nil {
+			logger.Error().Err(err).Str("state", state).Msg("failed to change swarm review state")
+		} else {
+			logger.Info().Str("state", state).Msg("Changed swarm review state")
+		}
+	}
+}
+
+// outdated reports whether the review has a newer version than the one the job
+// tested. A job without a known version is taken to test the latest one.
+func (v *ReviewVoter) outdated(ctx context.Context, job *models.JobMapping) (bool, error) {
+	version, err := strconv.Atoi(job.SwarmTest.Version)
+	if err != nil {
+		return false, nil
+	}
+	review, err := v.swarm.GetReview(ctx, job.SwarmTest.ReviewID)
+	if err != nil {
+		return false, err
+	}
+	return version < review.LatestVersion(), nil
+}
+
+// vote casts a vote on the review version the job tested, or on the latest
+// version when the request did not name one
+func (v *ReviewVoter) vote(ctx context.Context, job *models.JobMapping, vote string) error {
+	version, _ := strconv.Atoi(job.SwarmTest.Version)
+	return v.swarm.Vote(ctx, job.SwarmTest.ReviewID, swarm.VoteRequest{Vote: vote, Version: version})
+}
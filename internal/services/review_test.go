@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/swarm"
+)
+
+// fakeSwarmReviews serves a review with latest versions and records the votes
+// and transitions sent to the Swarm API
+type fakeSwarmReviews struct {
+	mu      sync.Mutex
+	latest  int
+	actions []string
+}
+
+func (f *fakeSwarmReviews) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/api/v11/reviews/42":
+		review := swarm.Review{ID: 42, Versions: make([]swarm.ReviewVersion, f.latest)}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": nil, "messages": []string{}, "data": map[string][]swarm.Review{"reviews": {review}}})
+		return
+	case "/api/v11/reviews/42/vote":
+		var req swarm.VoteRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.actions = append(f.actions, "vote="+req.Vote)
+		if req.Version != 3 {
+			f.actions = append(f.actions, "unexpected version")
+		}
+	case "/api/v11/reviews/42/transitions":
+		var req swarm.TransitionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.actions = append(f.actions, "state="+req.Transition)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": nil, "messages": []string{}, "data": map[string]interface{}{}})
+}
+
+func (f *fakeSwarmReviews) sent() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.actions...)
+}
+
+func TestReviewVoter(t *testing.T) {
+	newVoter := func(t *testing.T, review config.ReviewConfig, routes ...config.RouteConfig) (*ReviewVoter, *fakeSwarmReviews) {
+		fake := &fakeSwarmReviews{latest: 3}
+		server := httptest.NewServer(fake)
+		t.Cleanup(server.Close)
+
+		cfg := &config.Config{
+			Swarm:  config.SwarmConfig{Host: server.URL, User: "bridge", Ticket: "ticket", Review: review},
+			Retry:  config.RetryConfig{MaxAttempts: 1},
+			Routes: routes,
+		}
+		return NewReviewVoter(cfg, zerolog.Nop(), NewSwarmService(cfg, zerolog.Nop())), fake
+	}
+
+	job := func(route string) *models.JobMapping {
+		return &models.JobMapping{
+			HordeJobID: "job-1",
+			SwarmTest:  models.SwarmTestRequest{ReviewID: "42", Version: "3"},
+			Target:     models.JobTarget{Route: route},
+		}
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		review config.ReviewConfig
+		routes []config.RouteConfig
+		route  string
+		// latest is the review's latest version when newer than the tested version 3
+		latest int
+		status models.JobStatus
+		want   []string
+	}{
+		{
+			name:   "votes down and requests revision on failure",
+			review: config.ReviewConfig{Vote: true, FailState: "needsRevision"},
+			status: models.StatusFailed,
+			want:   []string{"vote=down", "state=needsRevision"},
+		},
+		{
+			name:   "leaves the state of a newer review version",
+			review: config.ReviewConfig{Vote: true, FailState: "needsRevision"},
+			latest: 4,
+			status: models.StatusFailed,
+			want:   []string{"vote=down"},
+		},
+		{
+			name:   "votes up on warnings",
+			review: config.ReviewConfig{Vote: true, FailState: "needsRevision"},
+			status: models.StatusWarnings,
+			want:   []string{"vote=up"},
+		},
+		{
+			name:   "ignores canceled jobs",
+			review: config.ReviewConfig{Vote: true},
+			status: models.StatusCanceled,
+		},
+		{
+			name:   "dry run",
+			review: config.ReviewConfig{Vote: true, FailState: "needsRevision", DryRun: true},
+			status: models.StatusFailed,
+		},
+		{
+			name:   "route settings replace global ones",
+			review: config.ReviewConfig{Vote: true},
+			routes: []config.RouteConfig{{Name: "nightly", Review: &config.ReviewConfig{PassState: "approved"}}},
+			route:  "nightly",
+			status: models.StatusCompleted,
+			want:   []string{"state=approved"},
+		},
+		{
+			name:   "global dry run applies to routes",
+			review: config.ReviewConfig{DryRun: true},
+			routes: []config.RouteConfig{{Name: "nightly", Review: &config.ReviewConfig{Vote: true}}},
+			route:  "nightly",
+			status: models.StatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			voter, fake := newVoter(t, tt.review, tt.routes...)
+			if tt.latest != 0 {
+				fake.latest = tt.latest
+			}
+			voter.Apply(ctx, job(tt.route), tt.status)
+
+			got := fake.sent()
+			if len(got) != len(tt.want) {
+				t.Fatalf("actions = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("actions = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+var (
+	// ErrNoRoute is returned when no route matches a request and no default is configured
+	ErrNoRoute = errors.New("no route matches the request")
+	// ErrUnknownRoute is returned when a request names a route that does not exist
+	ErrUnknownRoute = errors.New("unknown route")
+)
+
+// Router selects the Horde stream and template for incoming Swarm test requests
+type Router struct {
+	routes   []config.RouteConfig
+	fallback *models.JobTarget
+}
+
+// NewRouter creates a router from the configured routes. The global Horde
+// stream and template, when both set, act as the default route.
+func NewRouter(cfg *config.Config) *Router {
+	r := &Router{routes: cfg.Routes}
+	if cfg.Horde.StreamId != "" && cfg.Horde.TemplateId != "" {
+		r.fallback = &models.JobTarget{
+			StreamId:   cfg.Horde.StreamId,
+			TemplateId: cfg.Horde.TemplateId,
+		}
+	}
+	return r
+}
+
+// Resolve returns the target for a request. A non-empty routeName selects
+// that route directly; otherwise the first route whose criteria match wins.
+func (r *Router) Resolve(req models.SwarmTestRequest, routeName string) (models.JobTarget, error) {
+	if routeName != "" {
+		for _, route := range r.routes {
+			if route.Name == routeName {
+				return targetFor(route), nil
+			}
+		}
+		return models.JobTarget{}, fmt.Errorf("%w: %s", ErrUnknownRoute, routeName)
+	}
+
+	for _, route := range r.routes {
+		if routeMatches(route.Match, req) {
+			return targetFor(route), nil
+		}
+	}
+
+	if r.fallback != nil {
+		return *r.fallback, nil
+	}
+	return models.JobTarget{}, ErrNoRoute
+}
+
+func targetFor(route config.RouteConfig) models.JobTarget {
+	return models.JobTarget{
+		Route:      route.Name,
+		StreamId:   route.StreamId,
+		TemplateId: route.TemplateId,
+	}
+}
+
+// routeMatches reports whether every non-empty criterion matches the request
+func routeMatches(match config.RouteMatch, req models.SwarmTestRequest) bool {
+	return matchDepotPath(match.DepotPath, req.DepotPath) &&
+		matchPattern(match.Branch, req.Branch) &&
+		matchPattern(match.Project, req.Project) &&
+		matchPattern(match.Test, req.Test)
+}
+
+func matchPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(pattern, value)
+	return err == nil && ok
+}
+
+// matchDepotPath matches using Perforce wildcards: "..." matches any
+// sequence of characters including slashes and "*" matches within a segment
+func matchDepotPath(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for rest := pattern; rest != ""; {
+		switch {
+		case strings.HasPrefix(rest, "..."):
+			expr.WriteString(".*")
+			rest = rest[3:]
+		case rest[0] == '*':
+			expr.WriteString("[^/]*")
+			rest = rest[1:]
+		default:
+			expr.WriteString(regexp.QuoteMeta(rest[:1]))
+			rest = rest[1:]
+		}
+	}
+	expr.WriteString("$")
+
+	ok, err := regexp.MatchString(expr.String(), value)
+	return err == nil && ok
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+func TestRouter(t *testing.T) {
+	routes := []config.RouteConfig{
+		{
+			Name:       "release",
+			Match:      config.RouteMatch{DepotPath: "//depot/release-*/..."},
+			StreamId:   "release-stream",
+			TemplateId: "release-preflight",
+		},
+		{
+			Name:       "game-tests",
+			Match:      config.RouteMatch{Project: "game", Test: "*-tests"},
+			StreamId:   "main-stream",
+			TemplateId: "game-tests",
+		},
+		{
+			Name:       "main",
+			Match:      config.RouteMatch{Branch: "main"},
+			StreamId:   "main-stream",
+			TemplateId: "main-preflight",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		fallback  bool
+		req       models.SwarmTestRequest
+		routeName string
+		want      models.JobTarget
+		wantErr   error
+	}{
+		{
+			name: "depot path wildcard",
+			req:  models.SwarmTestRequest{DepotPath: "//depot/release-5.4/Engine/Source/..."},
+			want: models.JobTarget{Route: "release", StreamId: "release-stream", TemplateId: "release-preflight"},
+		},
+		{
+			name:     "depot path star does not cross segments",
+			fallback: true,
+			req:      models.SwarmTestRequest{DepotPath: "//depot/dev/release-5.4/Engine/..."},
+			want:     models.JobTarget{StreamId: "default-stream", TemplateId: "default-template"},
+		},
+		{
+			name: "all criteria must match",
+			req:  models.SwarmTestRequest{Project: "game", Test: "unit-tests"},
+			want: models.JobTarget{Route: "game-tests", StreamId: "main-stream", TemplateId: "game-tests"},
+		},
+		{
+			name: "first match wins",
+			req:  models.SwarmTestRequest{Project: "game", Test: "unit-tests", Branch: "main"},
+			want: models.JobTarget{Route: "game-tests", StreamId: "main-stream", TemplateId: "game-tests"},
+		},
+		{
+			name: "partial criteria falls through",
+			req:  models.SwarmTestRequest{Project: "game", Test: "lint", Branch: "main"},
+			want: models.JobTarget{Route: "main", StreamId: "main-stream", TemplateId: "main-preflight"},
+		},
+		{
+			name:      "explicit route name",
+			req:       models.SwarmTestRequest{Branch: "main"},
+			routeName: "release",
+			want:      models.JobTarget{Route: "release", StreamId: "release-stream", TemplateId: "release-preflight"},
+		},
+		{
+			name:      "unknown route name",
+			routeName: "missing",
+			fallback:  true,
+			wantErr:   ErrUnknownRoute,
+		},
+		{
+			name:     "default fallback",
+			fallback: true,
+			req:      models.SwarmTestRequest{Branch: "dev"},
+			want:     models.JobTarget{StreamId: "default-stream", TemplateId: "default-template"},
+		},
+		{
+			name:    "no match without fallback",
+			req:     models.SwarmTestRequest{Branch: "dev"},
+			wantErr: ErrNoRoute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Routes: routes}
+			if tt.fallback {
+				cfg.Horde.StreamId = "default-stream"
+				cfg.Horde.TemplateId = "default-template"
+			}
+
+			got, err := NewRouter(cfg).Resolve(tt.req, tt.routeName)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
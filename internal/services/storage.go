@@ -1,65 +1,108 @@
 package services
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
 )
 
-// JobStorage provides thread-safe storage for job mappings
-type JobStorage struct {
+// JobStorage persists the mappings between Swarm tests and Horde jobs
+type JobStorage interface {
+	// Store saves a job mapping, refreshing its UpdatedAt timestamp
+	Store(jobID string, mapping *models.JobMapping) error
+	// Get retrieves a job mapping, reporting whether it exists
+	Get(jobID string) (*models.JobMapping, bool, error)
+	// Delete removes a job mapping
+	Delete(jobID string) error
+	// List returns all job mappings
+	List() ([]*models.JobMapping, error)
+	// CleanOld removes jobs that have not been updated within the specified duration
+	CleanOld(age time.Duration) error
+	// Close releases any resources held by the storage
+	Close() error
+}
+
+// NewJobStorage creates the job storage backend selected in the configuration
+func NewJobStorage(cfg *config.Config) (JobStorage, error) {
+	switch cfg.Storage.Type {
+	case "", config.StorageTypeMemory:
+		return NewMemoryJobStorage(), nil
+	case config.StorageTypeBolt:
+		return NewBoltJobStorage(cfg.Storage.Path)
+	default:
+		return nil, fmt.Errorf("unsupported storage type: %s", cfg.Storage.Type)
+	}
+}
+
+// MemoryJobStorage provides thread-safe in-memory storage for job mappings.
+// Mappings are copied in and out, so callers never share the stored ones.
+// Mappings are lost when the bridge restarts.
+type MemoryJobStorage struct {
 	mu   sync.RWMutex
 	jobs map[string]*models.JobMapping
 }
 
-// NewJobStorage creates a new job storage instance
-func NewJobStorage() *JobStorage {
-	return &JobStorage{
+// NewMemoryJobStorage creates a new in-memory job storage instance
+func NewMemoryJobStorage() *MemoryJobStorage {
+	return &MemoryJobStorage{
 		jobs: make(map[string]*models.JobMapping),
 	}
 }
 
 // Store saves a job mapping
-func (s *JobStorage) Store(jobID string, mapping *models.JobMapping) {
+func (s *MemoryJobStorage) Store(jobID string, mapping *models.JobMapping) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	mapping.UpdatedAt = time.Now()
-	s.jobs[jobID] = mapping
+	s.jobs[jobID] = copyMapping(mapping)
+	return nil
 }
 
 // Get retrieves a job mapping
-func (s *JobStorage) Get(jobID string) (*models.JobMapping, bool) {
+func (s *MemoryJobStorage) Get(jobID string) (*models.JobMapping, bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	mapping, exists := s.jobs[jobID]
-	return mapping, exists
+	if !exists {
+		return nil, false, nil
+	}
+	return copyMapping(mapping), true, nil
 }
 
 // Delete removes a job mapping
-func (s *JobStorage) Delete(jobID string) {
+func (s *MemoryJobStorage) Delete(jobID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	delete(s.jobs, jobID)
+	return nil
 }
 
 // List returns all job mappings
-func (s *JobStorage) List() []*models.JobMapping {
+func (s *MemoryJobStorage) List() ([]*models.JobMapping, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	mappings := make([]*models.JobMapping, 0, len(s.jobs))
 	for _, mapping := range s.jobs {
-		mappings = append(mappings, mapping)
+		mappings = append(mappings, copyMapping(mapping))
 	}
-	return mappings
+	return mappings, nil
+}
+
+func copyMapping(mapping *models.JobMapping) *models.JobMapping {
+	c := *mapping
+	c.CommentMessages = append([]string(nil), mapping.CommentMessages...)
+	return &c
 }
 
 // CleanOld removes jobs older than the specified duration
-func (s *JobStorage) CleanOld(age time.Duration) {
+func (s *MemoryJobStorage) CleanOld(age time.Duration) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -69,4 +112,10 @@ func (s *JobStorage) CleanOld(age time.Duration) {
 			delete(s.jobs, id)
 		}
 	}
+	return nil
+}
+
+// Close is a no-op for in-memory storage
+func (s *MemoryJobStorage) Close() error {
+	return nil
 }
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+var jobsBucket = []byte("jobs")
+
+// BoltJobStorage persists job mappings in an embedded bbolt database file so
+// that tracked Horde jobs survive bridge restarts
+type BoltJobStorage struct {
+	db *bolt.DB
+}
+
+// NewBoltJobStorage opens (or creates) the database file at path
+func NewBoltJobStorage(path string) (*BoltJobStorage, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening bolt database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating jobs bucket: %w", err)
+	}
+
+	return &BoltJobStorage{db: db}, nil
+}
+
+// Store saves a job mapping
+func (s *BoltJobStorage) Store(jobID string, mapping *models.JobMapping) error {
+	mapping.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(mapping)
+	if err != nil {
+		return fmt.Errorf("marshaling job mapping: %w", err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(jobID), data)
+	})
+}
+
+// Get retrieves a job mapping
+func (s *BoltJobStorage) Get(jobID string) (*models.JobMapping, bool, error) {
+	var mapping *models.JobMapping
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(jobID))
+		if data == nil {
+			return nil
+		}
+		mapping = &models.JobMapping{}
+		return json.Unmarshal(data, mapping)
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("reading job mapping %s: %w", jobID, err)
+	}
+
+	return mapping, mapping != nil, nil
+}
+
+// Delete removes a job mapping
+func (s *BoltJobStorage) Delete(jobID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(jobID))
+	})
+}
+
+// List returns all job mappings
+func (s *BoltJobStorage) List() ([]*models.JobMapping, error) {
+	var mappings []*models.JobMapping
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			mapping := &models.JobMapping{}
+			if err := json.Unmarshal(v, mapping); err != nil {
+				return fmt.Errorf("decoding job mapping %s: %w", k, err)
+			}
+			mappings = append(mappings, mapping)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing job mappings: %w", err)
+	}
+
+	return mappings, nil
+}
+
+// CleanOld removes jobs older than the specified duration
+func (s *BoltJobStorage) CleanOld(age time.Duration) error {
+	cutoff := time.Now().Add(-age)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+
+		// Collect keys first as deleting while iterating skips entries
+		var stale [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var mapping models.JobMapping
+			if err := json.Unmarshal(v, &mapping); err != nil {
+				return fmt.Errorf("decoding job mapping %s: %w", k, err)
+			}
+			if mapping.UpdatedAt.Before(cutoff) {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range stale {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the underlying database file
+func (s *BoltJobStorage) Close() error {
+	return s.db.Close()
+}
@@ -1,14 +1,18 @@
 package services
 
 import (
+	"encoding/json"
+	"path/filepath"
 	"testing"
 	"time"
 
+	bolt "go.etcd.io/bbolt"
+
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
 )
 
 func TestJobStorage(t *testing.T) {
-	storage := NewJobStorage()
+	storage := NewMemoryJobStorage()
 
 	// Test storing and retrieving a job
 	t.Run("Store and Get", func(t *testing.T) {
@@ -22,20 +26,32 @@ func TestJobStorage(t *testing.T) {
 			UpdatedAt:  time.Now(),
 		}
 
-		storage.Store(job.HordeJobID, job)
+		if err := storage.Store(job.HordeJobID, job); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
 
-		retrieved, exists := storage.Get(job.HordeJobID)
+		retrieved, exists, err := storage.Get(job.HordeJobID)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
 		if !exists {
 			t.Error("Job not found after storing")
 		}
 		if retrieved.HordeJobID != job.HordeJobID {
 			t.Errorf("Retrieved job ID = %v, want %v", retrieved.HordeJobID, job.HordeJobID)
 		}
+
+		// Changes to stored or retrieved mappings are only kept once stored
+		job.Status = models.StatusFailed
+		retrieved.Status = models.StatusRunning
+		if stored, _, _ := storage.Get(job.HordeJobID); stored.Status != models.StatusPending {
+			t.Errorf("stored status = %v, want %v", stored.Status, models.StatusPending)
+		}
 	})
 
 	// Test listing jobs
 	t.Run("List", func(t *testing.T) {
-		storage = NewJobStorage() // Start fresh
+		storage = NewMemoryJobStorage() // Start fresh
 		jobs := []*models.JobMapping{
 			{
 				HordeJobID: "job-1",
@@ -48,10 +64,15 @@ func TestJobStorage(t *testing.T) {
 		}
 
 		for _, job := range jobs {
-			storage.Store(job.HordeJobID, job)
+			if err := storage.Store(job.HordeJobID, job); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
 		}
 
-		list := storage.List()
+		list, err := storage.List()
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
 		if len(list) != len(jobs) {
 			t.Errorf("List() returned %d jobs, want %d", len(list), len(jobs))
 		}
@@ -65,10 +86,14 @@ func TestJobStorage(t *testing.T) {
 			Status:     models.StatusPending,
 		}
 
-		storage.Store(jobID, job)
-		storage.Delete(jobID)
+		if err := storage.Store(jobID, job); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+		if err := storage.Delete(jobID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
 
-		_, exists := storage.Get(jobID)
+		_, exists, _ := storage.Get(jobID)
 		if exists {
 			t.Error("Job still exists after deletion")
 		}
@@ -76,7 +101,7 @@ func TestJobStorage(t *testing.T) {
 
 	// Test cleaning old jobs
 	t.Run("CleanOld", func(t *testing.T) {
-		storage = NewJobStorage()
+		storage = NewMemoryJobStorage()
 
 		// Create an old job timestamp
 		oldTime := time.Now().Add(-2 * time.Hour)
@@ -100,16 +125,125 @@ func TestJobStorage(t *testing.T) {
 		storage.mu.Unlock()
 
 		// Clean jobs older than 1 hour
-		storage.CleanOld(1 * time.Hour)
+		if err := storage.CleanOld(1 * time.Hour); err != nil {
+			t.Fatalf("CleanOld() error = %v", err)
+		}
 
 		// Verify old job was removed
-		if _, exists := storage.Get(oldJob.HordeJobID); exists {
+		if _, exists, _ := storage.Get(oldJob.HordeJobID); exists {
 			t.Error("Old job still exists after cleanup")
 		}
 
 		// Verify new job remains
-		if _, exists := storage.Get(newJob.HordeJobID); !exists {
+		if _, exists, _ := storage.Get(newJob.HordeJobID); !exists {
 			t.Error("New job was incorrectly cleaned up")
 		}
 	})
 }
+
+func TestBoltJobStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+
+	storage, err := NewBoltJobStorage(path)
+	if err != nil {
+		t.Fatalf("NewBoltJobStorage() error = %v", err)
+	}
+
+	job := &models.JobMapping{
+		SwarmTest: models.SwarmTestRequest{
+			Changelist: "test-change",
+			UpdateURL:  "http://swarm/update",
+		},
+		HordeJobID: "job-123",
+		Status:     models.StatusRunning,
+		CreatedAt:  time.Now(),
+	}
+
+	t.Run("Store and Get", func(t *testing.T) {
+		if err := storage.Store(job.HordeJobID, job); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+
+		retrieved, exists, err := storage.Get(job.HordeJobID)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if !exists {
+			t.Fatal("Job not found after storing")
+		}
+		if retrieved.SwarmTest.UpdateURL != job.SwarmTest.UpdateURL {
+			t.Errorf("Retrieved update URL = %v, want %v", retrieved.SwarmTest.UpdateURL, job.SwarmTest.UpdateURL)
+		}
+
+		if _, exists, _ := storage.Get("missing"); exists {
+			t.Error("Get() reported a missing job as existing")
+		}
+	})
+
+	t.Run("Survives reopen", func(t *testing.T) {
+		if err := storage.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+
+		storage, err = NewBoltJobStorage(path)
+		if err != nil {
+			t.Fatalf("NewBoltJobStorage() error = %v", err)
+		}
+
+		list, err := storage.List()
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if len(list) != 1 || list[0].HordeJobID != job.HordeJobID || list[0].Status != models.StatusRunning {
+			t.Errorf("List() after reopen = %+v, want the stored job", list)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if err := storage.Delete(job.HordeJobID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if _, exists, _ := storage.Get(job.HordeJobID); exists {
+			t.Error("Job still exists after deletion")
+		}
+	})
+
+	t.Run("CleanOld", func(t *testing.T) {
+		// Write jobs directly so their timestamps are preserved
+		err := storage.db.Update(func(tx *bolt.Tx) error {
+			for id, updated := range map[string]time.Time{
+				"old-job-1": time.Now().Add(-3 * time.Hour),
+				"old-job-2": time.Now().Add(-2 * time.Hour),
+				"new-job":   time.Now(),
+			} {
+				data, err := json.Marshal(&models.JobMapping{HordeJobID: id, UpdatedAt: updated})
+				if err != nil {
+					return err
+				}
+				if err := tx.Bucket(jobsBucket).Put([]byte(id), data); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("seeding jobs: %v", err)
+		}
+
+		if err := storage.CleanOld(1 * time.Hour); err != nil {
+			t.Fatalf("CleanOld() error = %v", err)
+		}
+
+		list, err := storage.List()
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if len(list) != 1 || list[0].HordeJobID != "new-job" {
+			t.Errorf("List() after CleanOld = %+v, want only new-job", list)
+		}
+	})
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
@@ -1,63 +1,203 @@
 package services
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/metrics"
 	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/retry"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/swarm"
 )
 
+// StatusUpdater reports test run status updates to Swarm
+type StatusUpdater interface {
+	UpdateStatus(ctx context.Context, status models.TestRunStatus) error
+}
+
+// ErrNoSwarmCredentials is returned for Swarm API calls when no Swarm user
+// and ticket or password are configured
+var ErrNoSwarmCredentials = errors.New("no swarm credentials configured")
+
+// SwarmService manages interactions with Swarm
 type SwarmService struct {
-	client *http.Client
+	client *swarm.Client
 	config *config.Config
 	logger zerolog.Logger
 }
 
+// NewSwarmService creates a new instance of SwarmService
 func NewSwarmService(cfg *config.Config, logger zerolog.Logger) *SwarmService {
+	client := swarm.NewClient(
+		cfg.Swarm.Host,
+		cfg.Swarm.User,
+		cfg.Swarm.Secret(),
+		logger,
+		swarm.WithTimeout(time.Duration(cfg.Swarm.Timeout)*time.Second),
+	)
+
 	return &SwarmService{
-		client: &http.Client{},
+		client: client,
 		config: cfg,
 		logger: logger,
 	}
 }
 
-func (s *SwarmService) UpdateStatus(ctx context.Context, updateURL string, status string, messages []string, jobID string) error {
-	// Construct the JobUrl using the Horde URL and Job ID
-	jobURL := fmt.Sprintf("%s/job/%s", s.config.Horde.Host, jobID)
+// UpdateStatus sends a status update to a Swarm test run, retrying transient
+// failures. Errors Swarm will keep rejecting are marked permanent. The update
+// goes through the Swarm API when the test run ID is known and credentials
+// are configured, and to the test run's update URL otherwise.
+func (s *SwarmService) UpdateStatus(ctx context.Context, status models.TestRunStatus) error {
+	update := testRunUpdate(s.config.Horde.Host, status)
 
-	update := models.SwarmUpdateRequest{
-		Status:   status,
-		Messages: messages,
-		JobUrl:   jobURL,
+	var err error
+	if status.ReviewID != "" && status.TestRunID != "" && s.config.Swarm.HasCredentials() {
+		_, err = callSwarm(ctx, s, "update_test_run", func(ctx context.Context) (swarm.TestRun, error) {
+			return s.client.UpdateTestRun(ctx, status.ReviewID, status.TestRunID, update)
+		})
+	} else {
+		_, err = callSwarm(ctx, s, "update_status", func(ctx context.Context) (struct{}, error) {
+			return struct{}{}, s.client.PostTestRunUpdate(ctx, status.UpdateURL, update)
+		})
 	}
-
-	body, err := json.Marshal(update)
 	if err != nil {
+		metrics.SwarmUpdates.WithLabelValues(metrics.ResultFailure).Inc()
 		return err
 	}
+	metrics.SwarmUpdates.WithLabelValues(metrics.ResultSuccess).Inc()
+	return nil
+}
+
+// testRunUpdate builds the body of a status update, linking the Horde job if
+// one exists yet
+func testRunUpdate(hordeHost string, status models.TestRunStatus) swarm.TestRunUpdate {
+	update := swarm.TestRunUpdate{
+		Status:   status.Status,
+		Messages: status.Messages,
+	}
+	if status.JobID != "" {
+		update.URL = fmt.Sprintf("%s/job/%s", hordeHost, status.JobID)
+	}
+	if status.StartTime != nil {
+		update.StartTime = status.StartTime.Unix()
+	}
+	if status.CompletedTime != nil {
+		update.CompletedTime = status.CompletedTime.Unix()
+	}
+	return update
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", updateURL, bytes.NewBuffer(body))
+// GetReview retrieves a review from Swarm
+func (s *SwarmService) GetReview(ctx context.Context, reviewID string) (swarm.Review, error) {
+	if !s.config.Swarm.HasCredentials() {
+		return swarm.Review{}, ErrNoSwarmCredentials
+	}
+	review, err := callSwarm(ctx, s, "get_review", func(ctx context.Context) (swarm.Review, error) {
+		return s.client.GetReview(ctx, reviewID)
+	})
 	if err != nil {
-		return err
+		return swarm.Review{}, fmt.Errorf("getting swarm review: %w", err)
+	}
+	return review, nil
+}
+
+// UpdateTestRun updates a test run of a review by its ID through the Swarm API
+func (s *SwarmService) UpdateTestRun(ctx context.Context, reviewID, testRunID string, update swarm.TestRunUpdate) error {
+	if !s.config.Swarm.HasCredentials() {
+		return ErrNoSwarmCredentials
+	}
+	_, err := callSwarm(ctx, s, "update_test_run", func(ctx context.Context) (swarm.TestRun, error) {
+		return s.client.UpdateTestRun(ctx, reviewID, testRunID, update)
+	})
+	if err != nil {
+		return fmt.Errorf("updating swarm test run: %w", err)
+	}
+	return nil
+}
+
+// GetComments retrieves the comments on a Swarm topic
+func (s *SwarmService) GetComments(ctx context.Context, topic string) ([]swarm.Comment, error) {
+	if !s.config.Swarm.HasCredentials() {
+		return nil, ErrNoSwarmCredentials
+	}
+	comments, err := callSwarm(ctx, s, "get_comments", func(ctx context.Context) ([]swarm.Comment, error) {
+		return s.client.GetComments(ctx, topic)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting swarm comments: %w", err)
 	}
+	return comments, nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// AddComment adds a comment to a Swarm topic
+func (s *SwarmService) AddComment(ctx context.Context, req swarm.AddCommentRequest) (swarm.Comment, error) {
+	if !s.config.Swarm.HasCredentials() {
+		return swarm.Comment{}, ErrNoSwarmCredentials
+	}
+	// Adding is not idempotent, so it is not retried to avoid posting a comment twice
+	timer := prometheus.NewTimer(metrics.SwarmRequestDuration.WithLabelValues("add_comment"))
+	comment, err := s.client.AddComment(ctx, req)
+	timer.ObserveDuration()
+	if err != nil {
+		return swarm.Comment{}, fmt.Errorf("adding swarm comment: %w", err)
+	}
+	return comment, nil
+}
 
-	resp, err := s.client.Do(req)
+// EditComment changes the body or flags of a Swarm comment
+func (s *SwarmService) EditComment(ctx context.Context, commentID int, req swarm.EditCommentRequest) error {
+	if !s.config.Swarm.HasCredentials() {
+		return ErrNoSwarmCredentials
+	}
+	_, err := callSwarm(ctx, s, "edit_comment", func(ctx context.Context) (swarm.Comment, error) {
+		return s.client.EditComment(ctx, commentID, req)
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("editing swarm comment: %w", err)
 	}
-	defer resp.Body.Close()
+	return nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+// Vote casts a vote on a Swarm review as the bridge's Swarm user
+func (s *SwarmService) Vote(ctx context.Context, reviewID string, req swarm.VoteRequest) error {
+	if !s.config.Swarm.HasCredentials() {
+		return ErrNoSwarmCredentials
+	}
+	_, err := callSwarm(ctx, s, "vote", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.client.Vote(ctx, reviewID, req)
+	})
+	if err != nil {
+		return fmt.Errorf("voting on swarm review: %w", err)
 	}
+	return nil
+}
 
+// TransitionReview moves a Swarm review to another state
+func (s *SwarmService) TransitionReview(ctx context.Context, reviewID string, req swarm.TransitionRequest) error {
+	if !s.config.Swarm.HasCredentials() {
+		return ErrNoSwarmCredentials
+	}
+	_, err := callSwarm(ctx, s, "transition_review", func(ctx context.Context) (swarm.Review, error) {
+		return s.client.TransitionReview(ctx, reviewID, req)
+	})
+	if err != nil {
+		return fmt.Errorf("transitioning swarm review: %w", err)
+	}
 	return nil
 }
+
+// callSwarm makes a Swarm API call, retrying transient failures
+func callSwarm[T any](ctx context.Context, s *SwarmService, operation string, call func(ctx context.Context) (T, error)) (T, error) {
+	policy := retryPolicy(s.config, s.logger, "swarm", operation)
+	return retry.Do(ctx, policy, func(ctx context.Context) (T, error) {
+		timer := prometheus.NewTimer(metrics.SwarmRequestDuration.WithLabelValues(operation))
+		defer timer.ObserveDuration()
+		return call(ctx)
+	})
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/metrics"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/retry"
+)
+
+// outboxPollInterval is how often the queue looks for updates whose retry is due
+const outboxPollInterval = time.Second
+
+// SwarmQueue delivers Swarm status updates through the outbox, retrying
+// failed deliveries with backoff until they succeed or are dead-lettered.
+// Updates are delivered one at a time, so a test run never sees them out of order.
+type SwarmQueue struct {
+	cfg    *config.Config
+	logger zerolog.Logger
+	swarm  *SwarmService
+	outbox SwarmOutbox
+	wake   chan struct{}
+}
+
+// NewSwarmQueue creates a new instance of SwarmQueue
+func NewSwarmQueue(cfg *config.Config, logger zerolog.Logger, swarmService *SwarmService, outbox SwarmOutbox) *SwarmQueue {
+	return &SwarmQueue{
+		cfg:    cfg,
+		logger: logger,
+		swarm:  swarmService,
+		outbox: outbox,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// UpdateStatus queues a status update for delivery. An error means the update
+// could not be queued; delivery failures are retried by the queue.
+func (q *SwarmQueue) UpdateStatus(ctx context.Context, status models.TestRunStatus) error {
+	update := &models.SwarmUpdate{
+		TestRunStatus: status,
+		CreatedAt:     q.cfg.Clock.Now(),
+	}
+
+	queued, err := q.outbox.Enqueue(update)
+	if err != nil {
+		return err
+	}
+	if !queued {
+		q.logger.Info().
+			Str("job_id", status.JobID).
+			Str("status", status.Status).
+			Msg("Dropped swarm update as a final result is already queued or delivered for the test run.")
+		return nil
+	}
+
+	q.notify()
+	return nil
+}
+
+// DeadLetters returns the updates that could not be delivered
+func (q *SwarmQueue) DeadLetters() ([]*models.SwarmUpdate, error) {
+	return q.outbox.DeadLetters()
+}
+
+// Replay queues a dead-lettered update for delivery again, reporting false if
+// it was dropped because a final result is already queued for the test run
+func (q *SwarmQueue) Replay(id string) (bool, error) {
+	queued, err := q.outbox.Replay(id)
+	if err != nil {
+		return false, err
+	}
+	if queued {
+		q.notify()
+	}
+	return queued, nil
+}
+
+// Start delivers queued updates until ctx is canceled
+func (q *SwarmQueue) Start(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	// Deliver updates left over from before a restart
+	q.deliverDue(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.deliverDue(ctx)
+		case <-q.wake:
+			q.deliverDue(ctx)
+		}
+	}
+}
+
+func (q *SwarmQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDue attempts every queued update whose next attempt is due
+func (q *SwarmQueue) deliverDue(ctx context.Context) {
+	updates, err := q.outbox.Pending()
+	if err != nil {
+		q.logger.Error().Err(err).Msg("failed to list queued swarm updates")
+		return
+	}
+	metrics.SwarmOutboxPending.Set(float64(len(updates)))
+
+	now := q.cfg.Clock.Now()
+	for _, update := range updates {
+		if ctx.Err() != nil {
+			return
+		}
+		if now.Before(update.NextAttempt) {
+			continue
+		}
+		q.deliver(ctx, update)
+	}
+}
+
+func (q *SwarmQueue) deliver(ctx context.Context, update *models.SwarmUpdate) {
+	logger := q.logger.With().
+		Str("job_id", update.JobID).
+		Str("update_id", update.ID).
+		Str("status", update.Status).
+		Logger()
+
+	sendCtx, cancel := context.WithTimeout(ctx, time.Duration(q.cfg.Swarm.Timeout)*time.Second)
+	err := q.swarm.UpdateStatus(sendCtx, update.TestRunStatus)
+	cancel()
+
+	if err == nil {
+		if err := q.outbox.Complete(update); err != nil {
+			logger.Error().Err(err).Msg("failed to remove delivered swarm update")
+		}
+		logger.Debug().Msg("Delivered swarm update.")
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the update stays queued
+		return
+	}
+
+	update.Attempts++
+	update.LastError = err.Error()
+
+	// Swarm rejecting the update, e.g. for an unknown test run, is not retried
+	if update.Attempts >= q.cfg.Swarm.Outbox.MaxAttempts || retry.IsPermanent(err) {
+		if err := q.outbox.Bury(update); err != nil {
+			logger.Error().Err(err).Msg("failed to dead-letter swarm update")
+			return
+		}
+		metrics.SwarmUpdatesDeadLettered.Inc()
+		logger.Error().Err(err).Int("attempts", update.Attempts).Msg("giving up on swarm update, moved to dead letters")
+		return
+	}
+
+	delay := exponentialBackoff(update.Attempts, q.cfg.Swarm.Outbox.InitialDelay, q.cfg.Swarm.Outbox.MaxDelay)
+	if after, ok := retry.RetryAfter(err); ok && after > delay {
+		delay = after
+	}
+	update.NextAttempt = q.cfg.Clock.Now().Add(delay)
+	if err := q.outbox.Reschedule(update); err != nil {
+		logger.Error().Err(err).Msg("failed to reschedule swarm update")
+		return
+	}
+	logger.Warn().Err(err).
+		Int("attempts", update.Attempts).
+		Dur("retry_in", delay).
+		Msg("failed to deliver swarm update, will retry")
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/config"
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/models"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestSwarmQueue(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	failures := 2
+
+	swarm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var update models.SwarmUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			t.Errorf("decoding update: %v", err)
+		}
+		received = append(received, r.URL.Path+"="+update.Status)
+	}))
+	defer swarm.Close()
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cfg := &config.Config{
+		Horde: config.HordeConfig{Host: "https://horde"},
+		Swarm: config.SwarmConfig{
+			Timeout: 5,
+			Outbox:  config.OutboxConfig{MaxAttempts: 3, InitialDelay: 5, MaxDelay: 60},
+		},
+		Clock: clock,
+	}
+	logger := zerolog.Nop()
+	outbox := NewMemorySwarmOutbox(cfg.GetOutboxDeliveredRetention())
+	queue := NewSwarmQueue(cfg, logger, NewSwarmService(cfg, logger), outbox)
+	ctx := context.Background()
+
+	if err := queue.UpdateStatus(ctx, models.TestRunStatus{UpdateURL: swarm.URL + "/run-1", Status: models.SwarmStatusRunning, JobID: "job-1"}); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+
+	// First delivery fails and is retried after the initial delay
+	queue.deliverDue(ctx)
+	pending, _ := outbox.Pending()
+	if len(pending) != 1 || pending[0].Attempts != 1 || !pending[0].NextAttempt.Equal(clock.now.Add(5*time.Second)) {
+		t.Fatalf("Pending() after failure = %+v, want one update retried in 5s", pending)
+	}
+
+	// The final result replaces the pending running status
+	if err := queue.UpdateStatus(ctx, models.TestRunStatus{UpdateURL: swarm.URL + "/run-1", Status: models.SwarmStatusPass, JobID: "job-1"}); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+	queue.deliverDue(ctx)
+	clock.now = clock.now.Add(10 * time.Second)
+	queue.deliverDue(ctx)
+	queue.deliverDue(ctx)
+
+	mu.Lock()
+	if len(received) != 1 || received[0] != "/run-1=pass" {
+		t.Errorf("Swarm received %v, want only [/run-1=pass]", received)
+	}
+	mu.Unlock()
+	if pending, _ := outbox.Pending(); len(pending) != 0 {
+		t.Errorf("Pending() after delivery = %+v, want none", pending)
+	}
+
+	t.Run("dead letters after max attempts", func(t *testing.T) {
+		mu.Lock()
+		failures = 10
+		mu.Unlock()
+
+		if err := queue.UpdateStatus(ctx, models.TestRunStatus{UpdateURL: swarm.URL + "/run-2", Status: models.SwarmStatusFail, Messages: []string{"failed"}, JobID: "job-2"}); err != nil {
+			t.Fatalf("UpdateStatus() error = %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			queue.deliverDue(ctx)
+			clock.now = clock.now.Add(time.Minute)
+		}
+
+		dead, err := queue.DeadLetters()
+		if err != nil {
+			t.Fatalf("DeadLetters() error = %v", err)
+		}
+		if len(dead) != 1 || dead[0].JobID != "job-2" || dead[0].Attempts != 3 || dead[0].LastError == "" {
+			t.Fatalf("DeadLetters() = %+v, want job-2 after 3 attempts", dead)
+		}
+
+		mu.Lock()
+		failures = 0
+		mu.Unlock()
+		if queued, err := queue.Replay(dead[0].ID); err != nil || !queued {
+			t.Fatalf("Replay() = %v, %v, want true, nil", queued, err)
+		}
+		queue.deliverDue(ctx)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if last := received[len(received)-1]; last != "/run-2=fail" {
+			t.Errorf("last delivered update = %s, want /run-2=fail", last)
+		}
+	})
+
+	t.Run("dead letters rejected updates at once", func(t *testing.T) {
+		rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer rejecting.Close()
+
+		if err := queue.UpdateStatus(ctx, models.TestRunStatus{UpdateURL: rejecting.URL + "/run-3", Status: models.SwarmStatusPass, JobID: "job-3"}); err != nil {
+			t.Fatalf("UpdateStatus() error = %v", err)
+		}
+		queue.deliverDue(ctx)
+
+		if pending, _ := outbox.Pending(); len(pending) != 0 {
+			t.Errorf("Pending() = %+v, want rejected update not retried", pending)
+		}
+		dead, err := queue.DeadLetters()
+		if err != nil {
+			t.Fatalf("DeadLetters() error = %v", err)
+		}
+		if len(dead) != 1 || dead[0].JobID != "job-3" || dead[0].Attempts != 1 {
+			t.Errorf("DeadLetters() = %+v, want job-3 after 1 attempt", dead)
+		}
+	})
+}
@@ -118,7 +118,7 @@ func TestSwarmService(t *testing.T) {
 				}
 
 				service := NewSwarmService(cfg, logger)
-				err := service.UpdateStatus(context.Background(), server.URL+"/update", tt.status, tt.messages, "")
+				err := service.UpdateStatus(context.Background(), models.TestRunStatus{UpdateURL: server.URL + "/update", Status: tt.status, Messages: tt.messages})
 
 				if (err != nil) != tt.wantErr {
 					t.Errorf("UpdateStatus() error = %v, wantErr %v", err, tt.wantErr)
@@ -151,7 +151,7 @@ func TestSwarmService(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 		defer cancel()
 
-		err := service.UpdateStatus(ctx, server.URL+"/update", "running", []string{"test"}, "")
+		err := service.UpdateStatus(ctx, models.TestRunStatus{UpdateURL: server.URL + "/update", Status: "running", Messages: []string{"test"}})
 		if err == nil {
 			t.Error("Expected error due to context cancellation, got nil")
 		}
@@ -165,12 +165,59 @@ func TestSwarmService(t *testing.T) {
 		}
 
 		service := NewSwarmService(cfg, logger)
-		err := service.UpdateStatus(context.Background(), "://invalid-url", "running", []string{"test"}, "")
+		err := service.UpdateStatus(context.Background(), models.TestRunStatus{UpdateURL: "://invalid-url", Status: "running", Messages: []string{"test"}})
 		if err == nil {
 			t.Error("Expected error for invalid URL, got nil")
 		}
 	})
 
+	t.Run("Test run API", func(t *testing.T) {
+		var paths []string
+		var update models.SwarmUpdateRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.Method+" "+r.URL.Path)
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				t.Errorf("decoding update: %v", err)
+			}
+			_, _ = w.Write([]byte(`{"error":null,"messages":[],"data":{"testruns":[{"id":7,"status":"pass"}]}}`))
+		}))
+		defer server.Close()
+
+		started := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		completed := started.Add(time.Hour)
+		status := models.TestRunStatus{
+			UpdateURL:     server.URL + "/update",
+			ReviewID:      "42",
+			TestRunID:     "7",
+			JobID:         "job-1",
+			Status:        models.SwarmStatusPass,
+			Messages:      []string{"ok"},
+			StartTime:     &started,
+			CompletedTime: &completed,
+		}
+
+		cfg := &config.Config{
+			Horde: config.HordeConfig{Host: "https://horde"},
+			Swarm: config.SwarmConfig{Host: server.URL, User: "bridge", Ticket: "ticket"},
+		}
+		if err := NewSwarmService(cfg, logger).UpdateStatus(context.Background(), status); err != nil {
+			t.Fatalf("UpdateStatus() error = %v", err)
+		}
+		if update.StartTime != started.Unix() || update.CompletedTime != completed.Unix() || update.URL != "https://horde/job/job-1" {
+			t.Errorf("update = %+v, want start and completion times and job link", update)
+		}
+
+		// Without credentials the update URL is used
+		cfg.Swarm.User, cfg.Swarm.Ticket = "", ""
+		if err := NewSwarmService(cfg, logger).UpdateStatus(context.Background(), status); err != nil {
+			t.Fatalf("UpdateStatus() without credentials error = %v", err)
+		}
+		want := []string{"PATCH /api/v11/reviews/42/testruns/7", "POST /update"}
+		if len(paths) != 2 || paths[0] != want[0] || paths[1] != want[1] {
+			t.Errorf("requests = %q, want %q", paths, want)
+		}
+	})
+
 	t.Run("Request Timeout", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			time.Sleep(200 * time.Millisecond)
@@ -188,7 +235,7 @@ func TestSwarmService(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 		defer cancel()
 
-		err := service.UpdateStatus(ctx, server.URL+"/update", "running", []string{"test"}, "")
+		err := service.UpdateStatus(ctx, models.TestRunStatus{UpdateURL: server.URL + "/update", Status: "running", Messages: []string{"test"}})
 		if err == nil {
 			t.Error("Expected timeout error, got nil")
 		}
@@ -0,0 +1,272 @@
+package swarm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/retry"
+)
+
+// Client handles communication with the Swarm API
+type Client struct {
+	baseURL    string
+	user       string
+	password   string
+	httpClient *http.Client
+	logger     zerolog.Logger
+}
+
+// ClientOption allows customizing the Client during initialization
+type ClientOption func(*Client)
+
+// WithTimeout sets the HTTP client timeout
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithHTTPClient sets a custom HTTP client
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// NewClient creates a new Swarm API client. API calls authenticate as user
+// with password, which may be a Perforce ticket; without a user they are
+// sent anonymously.
+func NewClient(baseURL, user, password string, logger zerolog.Logger, opts ...ClientOption) *Client {
+	c := &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		user:     user,
+		password: password,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		logger: logger,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// envelope is the body of every Swarm API response
+type envelope struct {
+	Error    json.RawMessage `json:"error"`
+	Messages []struct {
+		Code string `json:"code"`
+		Text string `json:"text"`
+	} `json:"messages"`
+	Data json.RawMessage `json:"data"`
+}
+
+// message returns the error message of a response
+func (e envelope) message() string {
+	var texts []string
+	for _, m := range e.Messages {
+		if m.Text != "" {
+			texts = append(texts, m.Text)
+		}
+	}
+	if len(texts) > 0 {
+		return strings.Join(texts, "; ")
+	}
+	var text string
+	if err := json.Unmarshal(e.Error, &text); err == nil {
+		return text
+	}
+	return ""
+}
+
+// GetReview retrieves a review
+func (c *Client) GetReview(ctx context.Context, reviewID string) (Review, error) {
+	var data struct {
+		Reviews []Review `json:"reviews"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/reviews/"+url.PathEscape(reviewID), nil, &data); err != nil {
+		return Review{}, err
+	}
+	if len(data.Reviews) == 0 {
+		return Review{}, fmt.Errorf("review %s missing from response", reviewID)
+	}
+	return data.Reviews[0], nil
+}
+
+// GetTestRuns retrieves the test runs of a review
+func (c *Client) GetTestRuns(ctx context.Context, reviewID string) ([]TestRun, error) {
+	var data struct {
+		TestRuns []TestRun `json:"testruns"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/reviews/"+url.PathEscape(reviewID)+"/testruns", nil, &data); err != nil {
+		return nil, err
+	}
+	return data.TestRuns, nil
+}
+
+// UpdateTestRun updates a test run of a review by its ID
+func (c *Client) UpdateTestRun(ctx context.Context, reviewID, testRunID string, update TestRunUpdate) (TestRun, error) {
+	var data struct {
+		TestRuns []TestRun `json:"testruns"`
+	}
+	path := fmt.Sprintf("/reviews/%s/testruns/%s", url.PathEscape(reviewID), url.PathEscape(testRunID))
+	if err := c.do(ctx, http.MethodPatch, path, update, &data); err != nil {
+		return TestRun{}, err
+	}
+	if len(data.TestRuns) == 0 {
+		return TestRun{}, nil
+	}
+	return data.TestRuns[0], nil
+}
+
+// updateURLEndpoint stands in for update URLs in errors, as they carry the
+// token that authorizes updates of the test run
+const updateURLEndpoint = "{update_url}"
+
+// PostTestRunUpdate updates a test run through the tokenised update URL Swarm
+// passes to the test. The token authorizes the call, so no credentials are sent.
+func (c *Client) PostTestRunUpdate(ctx context.Context, updateURL string, update TestRunUpdate) error {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("marshaling request: %w", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, updateURL, bytes.NewBuffer(body))
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("creating request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = updateURLEndpoint
+		}
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := newAPIError(resp)
+		apiErr.Endpoint = updateURLEndpoint
+		return retry.HTTPStatus(resp.StatusCode, resp.Header, apiErr)
+	}
+	return nil
+}
+
+// Vote casts a vote on a review as the authenticated user
+func (c *Client) Vote(ctx context.Context, reviewID string, req VoteRequest) error {
+	path := fmt.Sprintf("/reviews/%s/vote", url.PathEscape(reviewID))
+	return c.do(ctx, http.MethodPost, path, req, nil)
+}
+
+// TransitionReview moves a review to another state, such as needsRevision
+func (c *Client) TransitionReview(ctx context.Context, reviewID string, req TransitionRequest) (Review, error) {
+	var data struct {
+		Review Review `json:"review"`
+	}
+	path := fmt.Sprintf("/reviews/%s/transitions", url.PathEscape(reviewID))
+	if err := c.do(ctx, http.MethodPost, path, req, &data); err != nil {
+		return Review{}, err
+	}
+	return data.Review, nil
+}
+
+// GetComments retrieves the comments on a topic, such as ReviewTopic
+func (c *Client) GetComments(ctx context.Context, topic string) ([]Comment, error) {
+	var data struct {
+		Comments []Comment `json:"comments"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/comments?topic="+url.QueryEscape(topic), nil, &data); err != nil {
+		return nil, err
+	}
+	return data.Comments, nil
+}
+
+// AddComment adds a comment to a topic
+func (c *Client) AddComment(ctx context.Context, req AddCommentRequest) (Comment, error) {
+	var data struct {
+		Comments []Comment `json:"comments"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/comments", req, &data); err != nil {
+		return Comment{}, err
+	}
+	if len(data.Comments) == 0 {
+		return Comment{}, fmt.Errorf("comment missing from response")
+	}
+	return data.Comments[0], nil
+}
+
+// EditComment changes the body or flags of a comment
+func (c *Client) EditComment(ctx context.Context, commentID int, req EditCommentRequest) (Comment, error) {
+	var data struct {
+		Comments []Comment `json:"comments"`
+	}
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/comments/%d", commentID), req, &data); err != nil {
+		return Comment{}, err
+	}
+	if len(data.Comments) == 0 {
+		return Comment{}, nil
+	}
+	return data.Comments[0], nil
+}
+
+// do sends an API request with an optional JSON body and decodes the data of
+// the response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return retry.Permanent(fmt.Errorf("marshaling request: %w", err))
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/api/"+APIVersion+path, body)
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("creating request: %w", err))
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return retry.HTTPStatus(resp.StatusCode, resp.Header, newAPIError(resp))
+	}
+
+	var env envelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	if out == nil || len(env.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return fmt.Errorf("decoding response data: %w", err)
+	}
+	return nil
+}
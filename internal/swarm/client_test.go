@@ -0,0 +1,130 @@
+package swarm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Cubit-Studios/swarm-horde-bridge/internal/retry"
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/update/token" {
+			if _, _, ok := r.BasicAuth(); ok {
+				t.Error("update URL call sent credentials, want none")
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if user, password, ok := r.BasicAuth(); !ok || user != "bridge" || password != "ticket" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"Unauthorized","messages":[{"code":"401","text":"User is not logged in."}],"data":null}`))
+			return
+		}
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v11/reviews/42":
+			_, _ = w.Write([]byte(`{"error":null,"messages":[],"data":{"reviews":[{"id":42,"author":"jdoe","state":"needsReview","changes":[100,101],"versions":[{"change":100,"user":"jdoe","time":1700000000},{"change":101,"user":"jdoe","time":1700003600}],"participants":{"jdoe":[],"reviewer":{"vote":{"value":-1,"version":2}}}}]}}`))
+		case "GET /api/v11/reviews/43":
+			_, _ = w.Write([]byte(`{"error":null,"messages":[],"data":{"reviews":[{"id":43,"author":"jdoe","state":"approved","participants":[]}]}}`))
+		case "PATCH /api/v11/reviews/42/testruns/7":
+			var update TestRunUpdate
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil || update.Status != TestRunPass {
+				t.Errorf("test run update = %+v, %v, want pass", update, err)
+			}
+			_, _ = w.Write([]byte(`{"error":null,"messages":[],"data":{"testruns":[{"id":7,"test":"preflight","status":"pass"}]}}`))
+		case "POST /api/v11/reviews/42/vote":
+			var req VoteRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Vote != VoteDown || req.Version != 2 {
+				t.Errorf("vote = %+v, %v, want down vote on version 2", req, err)
+			}
+			_, _ = w.Write([]byte(`{"error":null,"messages":[],"data":{}}`))
+		case "POST /api/v11/reviews/42/transitions":
+			var req TransitionRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Transition != ReviewStateNeedsRevision {
+				t.Errorf("transition = %+v, %v, want needsRevision", req, err)
+			}
+			_, _ = w.Write([]byte(`{"error":null,"messages":[],"data":{"review":{"id":42,"state":"needsRevision"}}}`))
+		case "POST /api/v11/comments":
+			var req AddCommentRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Topic != "reviews/42" {
+				t.Errorf("comment = %+v, %v, want comment on reviews/42", req, err)
+			}
+			_, _ = w.Write([]byte(`{"error":null,"messages":[],"data":{"comments":[{"id":5,"topic":"reviews/42","user":"bridge","body":"` + req.Body + `"}]}}`))
+		case "GET /api/v11/comments":
+			if r.URL.Query().Get("topic") != "reviews/42" {
+				t.Errorf("comments topic = %q, want reviews/42", r.URL.Query().Get("topic"))
+			}
+			_, _ = w.Write([]byte(`{"error":null,"messages":[],"data":{"comments":[{"id":5,"topic":"reviews/42","user":"bridge","body":"Preflight failed"}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"Not Found","messages":[{"code":"404","text":"Cannot fetch entry. Id does not exist."}],"data":null}`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewClient(server.URL+"/", "bridge", "ticket", zerolog.Nop(), WithTimeout(time.Second))
+
+	review, err := client.GetReview(ctx, "42")
+	if err != nil {
+		t.Fatalf("GetReview() error = %v", err)
+	}
+	if review.Author != "jdoe" || len(review.Changes) != 2 || review.LatestVersion() != 2 || review.Participants["reviewer"].Vote == nil || review.Participants["reviewer"].Vote.Value != -1 {
+		t.Errorf("GetReview() = %+v, want review by jdoe with a down vote", review)
+	}
+	if review, err := client.GetReview(ctx, "43"); err != nil || review.Participants != nil {
+		t.Errorf("GetReview() without participants = %+v, %v", review, err)
+	}
+
+	run, err := client.UpdateTestRun(ctx, "42", "7", TestRunUpdate{Status: TestRunPass, Messages: []string{"ok"}})
+	if err != nil || run.ID != 7 || run.Status != TestRunPass {
+		t.Errorf("UpdateTestRun() = %+v, %v, want test run 7 passed", run, err)
+	}
+
+	if err := client.Vote(ctx, "42", VoteRequest{Vote: VoteDown, Version: 2}); err != nil {
+		t.Errorf("Vote() error = %v", err)
+	}
+	if review, err := client.TransitionReview(ctx, "42", TransitionRequest{Transition: ReviewStateNeedsRevision}); err != nil || review.State != ReviewStateNeedsRevision {
+		t.Errorf("TransitionReview() = %+v, %v, want review needing revision", review, err)
+	}
+
+	comment, err := client.AddComment(ctx, AddCommentRequest{Topic: ReviewTopic("42"), Body: "Preflight failed"})
+	if err != nil || comment.ID != 5 {
+		t.Errorf("AddComment() = %+v, %v, want comment 5", comment, err)
+	}
+	if comments, err := client.GetComments(ctx, ReviewTopic("42")); err != nil || len(comments) != 1 {
+		t.Errorf("GetComments() = %+v, %v, want one comment", comments, err)
+	}
+
+	if err := client.PostTestRunUpdate(ctx, server.URL+"/update/token", TestRunUpdate{Status: TestRunRunning}); err != nil {
+		t.Errorf("PostTestRunUpdate() error = %v", err)
+	}
+	// Update URLs carry the token authorizing the update, so errors leave them out
+	err = client.PostTestRunUpdate(ctx, server.URL+"/update/secret", TestRunUpdate{Status: TestRunRunning})
+	if apiErr, ok := AsAPIError(err); !ok || apiErr.StatusCode != http.StatusUnauthorized || strings.Contains(err.Error(), "secret") {
+		t.Errorf("PostTestRunUpdate() error = %v, want unauthorized without the update URL", err)
+	}
+	err = client.PostTestRunUpdate(ctx, "http://127.0.0.1:0/update/secret", TestRunUpdate{Status: TestRunRunning})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("PostTestRunUpdate() to an unreachable host error = %v, want an error without the update URL", err)
+	}
+
+	_, err = client.GetTestRuns(ctx, "99")
+	if apiErr, ok := AsAPIError(err); !ok || !IsNotFound(err) || apiErr.Message != "Cannot fetch entry. Id does not exist." || !retry.IsPermanent(err) {
+		t.Errorf("GetTestRuns() error = %v, want permanent not found with Swarm's message", err)
+	}
+
+	_, err = NewClient(server.URL, "bridge", "wrong", zerolog.Nop()).GetReview(ctx, "42")
+	if apiErr, ok := AsAPIError(err); !ok || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "User is not logged in." {
+		t.Errorf("GetReview() with wrong ticket error = %v, want unauthorized", err)
+	}
+}
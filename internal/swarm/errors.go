@@ -0,0 +1,74 @@
+package swarm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody bounds how much of an error response is read, and
+// maxErrorMessage how much of a body that is not JSON is kept as the message
+const (
+	maxErrorBody    = 64 << 10
+	maxErrorMessage = 512
+)
+
+// APIError is returned when Swarm answers a request with an error status
+type APIError struct {
+	StatusCode int    `json:"status"`
+	Method     string `json:"method"`
+	Endpoint   string `json:"endpoint"`
+	// Message is Swarm's description of the error, or the raw response body
+	Message string `json:"message,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("swarm %s %s: %d %s", e.Method, e.Endpoint, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// newAPIError builds an APIError from an error response, reading its body
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     resp.Request.Method,
+		Endpoint:   resp.Request.URL.Path,
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil || len(data) == 0 {
+		return apiErr
+	}
+
+	var body envelope
+	if err := json.Unmarshal(data, &body); err != nil {
+		apiErr.Message = strings.TrimSpace(string(data))
+		if len(apiErr.Message) > maxErrorMessage {
+			apiErr.Message = apiErr.Message[:maxErrorMessage] + "..."
+		}
+		return apiErr
+	}
+	apiErr.Message = body.message()
+	return apiErr
+}
+
+// AsAPIError returns the APIError in err's chain, if any
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+// IsNotFound reports whether err is Swarm answering 404 Not Found
+func IsNotFound(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
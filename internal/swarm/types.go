@@ -0,0 +1,200 @@
+// Package swarm provides types and a client for the Helix Swarm REST API
+package swarm
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// APIVersion is the Swarm REST API version used by the client
+const APIVersion = "v11"
+
+// Review states
+const (
+	ReviewStateNeedsReview   = "needsReview"
+	ReviewStateNeedsRevision = "needsRevision"
+	ReviewStateApproved      = "approved"
+	ReviewStateRejected      = "rejected"
+	ReviewStateArchived      = "archived"
+)
+
+// Test run statuses
+const (
+	TestRunQueued  = "queued"
+	TestRunRunning = "running"
+	TestRunPass    = "pass"
+	TestRunFail    = "fail"
+)
+
+// Review is a Swarm code review
+type Review struct {
+	ID          int    `json:"id"`
+	Author      string `json:"author"`
+	Description string `json:"description,omitempty"`
+	State       string `json:"state"`
+	StateLabel  string `json:"stateLabel,omitempty"`
+	Changes     []int  `json:"changes,omitempty"`
+	Commits     []int  `json:"commits,omitempty"`
+	// Versions lists the review's versions, oldest first
+	Versions     []ReviewVersion `json:"versions,omitempty"`
+	Participants Participants    `json:"participants,omitempty"`
+	TestStatus   string          `json:"testStatus,omitempty"`
+	// Created and Updated are Unix timestamps
+	Created int64 `json:"created,omitempty"`
+	Updated int64 `json:"updated,omitempty"`
+}
+
+// LatestVersion returns the number of the review's latest version, or 0 when
+// the response did not list its versions
+func (r Review) LatestVersion() int {
+	return len(r.Versions)
+}
+
+// ReviewVersion is one version of a review, a change shelved or committed for it
+type ReviewVersion struct {
+	Change int    `json:"change"`
+	User   string `json:"user,omitempty"`
+	// Time is a Unix timestamp
+	Time int64 `json:"time,omitempty"`
+}
+
+// Participants maps the users taking part in a review to their votes
+type Participants map[string]Participant
+
+// UnmarshalJSON accepts the empty list Swarm sends for a review without participants
+func (p *Participants) UnmarshalJSON(data []byte) error {
+	if isEmptyList(data) {
+		*p = nil
+		return nil
+	}
+	var participants map[string]Participant
+	if err := json.Unmarshal(data, &participants); err != nil {
+		return err
+	}
+	*p = participants
+	return nil
+}
+
+// Participant is a reviewer or the author of a review
+type Participant struct {
+	Vote *Vote `json:"vote,omitempty"`
+}
+
+// UnmarshalJSON accepts the empty list Swarm sends for a participant without
+// a vote or requirement
+func (p *Participant) UnmarshalJSON(data []byte) error {
+	if isEmptyList(data) {
+		*p = Participant{}
+		return nil
+	}
+	type participant Participant
+	return json.Unmarshal(data, (*participant)(p))
+}
+
+// isEmptyList reports whether data is an empty JSON list, which Swarm's PHP
+// backend sends in place of an empty object
+func isEmptyList(data []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(data), []byte("[]"))
+}
+
+// Vote is a participant's vote on a version of a review
+type Vote struct {
+	// Value is 1 for an up vote and -1 for a down vote
+	Value   int  `json:"value"`
+	Version int  `json:"version"`
+	IsStale bool `json:"isStale,omitempty"`
+}
+
+// TestRun is a run of a Swarm test for a version of a review
+type TestRun struct {
+	ID       int      `json:"id"`
+	Change   int      `json:"change"`
+	Version  int      `json:"version"`
+	Test     string   `json:"test"`
+	Title    string   `json:"title,omitempty"`
+	UUID     string   `json:"uuid,omitempty"`
+	Status   string   `json:"status"`
+	Messages []string `json:"messages,omitempty"`
+	URL      string   `json:"url,omitempty"`
+	// StartTime and CompletedTime are Unix timestamps
+	StartTime     int64 `json:"startTime,omitempty"`
+	CompletedTime int64 `json:"completedTime,omitempty"`
+}
+
+// TestRunUpdate changes the status of a test run, either through the API or
+// through the tokenised update URL Swarm passes to the test
+type TestRunUpdate struct {
+	Status   string   `json:"status"`
+	URL      string   `json:"url,omitempty"`
+	Messages []string `json:"messages"`
+	// StartTime and CompletedTime are Unix timestamps
+	StartTime     int64 `json:"startTime,omitempty"`
+	CompletedTime int64 `json:"completedTime,omitempty"`
+}
+
+// Votes that can be cast on a review
+const (
+	VoteUp    = "up"
+	VoteDown  = "down"
+	VoteClear = "clear"
+)
+
+// VoteRequest casts a vote on a review as the authenticated user
+type VoteRequest struct {
+	Vote string `json:"vote"`
+	// Version is the review version voted on; Swarm uses the latest if it is 0
+	Version int `json:"version,omitempty"`
+}
+
+// TransitionRequest moves a review to another state
+type TransitionRequest struct {
+	Transition string `json:"transition"`
+	// Text, if set, is added to the review as a comment on the transition
+	Text string `json:"text,omitempty"`
+}
+
+// CommentFlagClosed marks an archived comment
+const CommentFlagClosed = "closed"
+
+// Comment is a comment on a Swarm topic, such as a review
+type Comment struct {
+	ID        int      `json:"id"`
+	Topic     string   `json:"topic"`
+	User      string   `json:"user"`
+	Body      string   `json:"body"`
+	Flags     []string `json:"flags,omitempty"`
+	TaskState string   `json:"taskState,omitempty"`
+	// Time and Updated are Unix timestamps
+	Time    int64 `json:"time,omitempty"`
+	Updated int64 `json:"updated,omitempty"`
+}
+
+// IsArchived reports whether the comment was archived
+func (c Comment) IsArchived() bool {
+	for _, flag := range c.Flags {
+		if flag == CommentFlagClosed {
+			return true
+		}
+	}
+	return false
+}
+
+// AddCommentRequest adds a comment to a topic
+type AddCommentRequest struct {
+	Topic     string `json:"topic"`
+	Body      string `json:"body"`
+	TaskState string `json:"taskState,omitempty"`
+	// Notify is "immediate", "delayed" or "silent"
+	Notify string `json:"notify,omitempty"`
+}
+
+// EditCommentRequest changes the body or flags of a comment
+type EditCommentRequest struct {
+	Body  string   `json:"body,omitempty"`
+	Flags []string `json:"flags,omitempty"`
+}
+
+// ReviewTopic is the comment topic of a review
+func ReviewTopic(reviewID string) string {
+	return "reviews/" + reviewID
+}